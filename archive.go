@@ -0,0 +1,186 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--archive"},
+		value: "FILE",
+		usage: "write the rendered files into FILE, a .tar, .tar.gz, .tgz or .zip, instead of onto disk, sorted and with fixed times (--deterministic's TIME, or 1980's), so the same files make the same archive",
+		set: func(file string) error {
+			if archiveFormat(file) == "" {
+				return fmt.Errorf("%s is not a .tar, .tar.gz, .tgz or .zip", file)
+			}
+			options.archive = file
+			return nil
+		},
+	})
+}
+
+// archived is every file rendered for the --archive, by its name in it.
+var archived = struct {
+	sync.Mutex
+	files map[string]archivedFile
+}{files: map[string]archivedFile{}}
+
+// resetArchived forgets the files archived so far, for --watch to execute
+// the templates into a new --archive.
+func resetArchived() {
+	archived.Lock()
+	archived.files = map[string]archivedFile{}
+	archived.Unlock()
+}
+
+type archivedFile struct {
+	data []byte
+	mode os.FileMode
+}
+
+func archiveFormat(file string) string {
+	switch lower := strings.ToLower(file); {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tgz"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	}
+	return ""
+}
+
+// archiveFile puts data in the --archive, at the name for the file path,
+// instead of writing it.
+func archiveFile(file string, data []byte, mode os.FileMode) error {
+	name := path.Clean(filepath.ToSlash(file))
+	name = strings.TrimPrefix(name, "/")
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("%s is outside the current directory, so it can't go in the archive", file)
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+	archived.Lock()
+	archived.files[name] = archivedFile{data, mode}
+	archived.Unlock()
+	return nil
+}
+
+// An archiveWriter is createOutput's file for the --archive, which goes in
+// it once closed.
+type archiveWriter struct {
+	bytes.Buffer
+	path string
+	mode os.FileMode
+}
+
+func (w *archiveWriter) Close() error {
+	return archiveFile(w.path, w.Bytes(), w.mode)
+}
+
+// writeArchive writes the --archive, with its files in sorted order.
+func writeArchive() error {
+	if options.archive == "" {
+		return nil
+	}
+	archived.Lock()
+	defer archived.Unlock()
+	names := make([]string, 0, len(archived.files))
+	for name := range archived.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	mtime := time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	if options.now != nil {
+		mtime = options.now.UTC()
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch archiveFormat(options.archive) {
+	case "zip":
+		err = writeZip(&buf, names, mtime)
+	case "tar":
+		err = writeTar(&buf, names, mtime)
+	case "tgz":
+		// The gzip header has no name or time, so it is the same every time
+		// too.
+		gz := gzip.NewWriter(&buf)
+		err = writeTar(gz, names, mtime)
+		if err == nil {
+			err = gz.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(options.archive, buf.Bytes(), 0644)
+}
+
+func writeTar(w io.Writer, names []string, mtime time.Time) error {
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		f := archived.files[name]
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    int64(f.mode.Perm()),
+			Size:    int64(len(f.data)),
+			ModTime: mtime,
+			Format:  tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, names []string, mtime time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, name := range names {
+		f := archived.files[name]
+		hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: mtime}
+		hdr.SetMode(f.mode.Perm())
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--dump-ast"},
+		usage: "instead of executing the templates, print how they parsed: each node's type, where it is, and what it says",
+		set: func(string) error {
+			options.dumpAST = true
+			return nil
+		},
+	})
+}
+
+// dumpAST prints the parse tree of every template to be rendered, and of
+// every template they define.
+func dumpAST(ctx context.Context, w io.Writer) error {
+	texts, err := templateTexts(ctx)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range texts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tmpl, err := template.New(name).Funcs(funcMap()).Parse(texts[name])
+		if err != nil {
+			return err
+		}
+		trees := tmpl.Templates()
+		sort.Slice(trees, func(i, j int) bool {
+			// The template itself first, then what it defines.
+			if (trees[i].Name() == name) != (trees[j].Name() == name) {
+				return trees[i].Name() == name
+			}
+			return trees[i].Name() < trees[j].Name()
+		})
+		for _, t := range trees {
+			if t.Tree == nil {
+				continue
+			}
+			fmt.Fprintf(w, "template %q\n", t.Name())
+			dumpNode(w, t.Tree, t.Tree.Root, 1)
+		}
+	}
+	return nil
+}
+
+// dumpNode prints n, and everything under it, indented by depth.
+func dumpNode(w io.Writer, tree *parse.Tree, n parse.Node, depth int) {
+	if reflect.ValueOf(n).IsNil() {
+		return
+	}
+	location, _ := tree.ErrorContext(n)
+	kind := strings.TrimSuffix(reflect.TypeOf(n).Elem().Name(), "Node")
+	text := ""
+	switch n := n.(type) {
+	case *parse.ListNode, *parse.IfNode, *parse.RangeNode, *parse.WithNode:
+		// Their text is all of their children's.
+	case *parse.TextNode:
+		text = " " + strconv.Quote(string(n.Text))
+	default:
+		text = " " + n.String()
+	}
+	fmt.Fprintf(w, "%s%s %s%s\n", strings.Repeat("  ", depth), location, kind, text)
+
+	var children []parse.Node
+	switch n := n.(type) {
+	case *parse.ListNode:
+		children = n.Nodes
+	case *parse.ActionNode:
+		children = []parse.Node{n.Pipe}
+	case *parse.IfNode:
+		children = branchChildren(&n.BranchNode)
+	case *parse.RangeNode:
+		children = branchChildren(&n.BranchNode)
+	case *parse.WithNode:
+		children = branchChildren(&n.BranchNode)
+	case *parse.TemplateNode:
+		if n.Pipe != nil {
+			children = []parse.Node{n.Pipe}
+		}
+	case *parse.PipeNode:
+		for _, decl := range n.Decl {
+			children = append(children, decl)
+		}
+		for _, cmd := range n.Cmds {
+			children = append(children, cmd)
+		}
+	case *parse.CommandNode:
+		children = n.Args
+	case *parse.ChainNode:
+		children = []parse.Node{n.Node}
+	}
+	for _, child := range children {
+		dumpNode(w, tree, child, depth+1)
+	}
+}
+
+func branchChildren(b *parse.BranchNode) []parse.Node {
+	children := []parse.Node{b.Pipe, b.List}
+	if b.ElseList != nil {
+		children = append(children, b.ElseList)
+	}
+	return children
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// Like s3:// objects, these use the aws tool, so credentials, the region
+// and profiles are found the way they always are.
+
+func init() {
+	optionTable = append(optionTable,
+		option{
+			names: []string{"--ssm"},
+			value: "PATH",
+			usage: "load the SSM parameters under PATH, decrypted, as nested fields split on /",
+			load:  loadSSM,
+		},
+		option{
+			names: []string{"--aws-secret"},
+			value: "NAME",
+			usage: "load the Secrets Manager secret NAME: a json object goes at the top, anything else at the field NAME",
+			load:  loadAWSSecret,
+		},
+	)
+}
+
+func loadSSM(ctx context.Context, path string, obj interface{}) error {
+	out, err := cachedTool(ctx, "aws", "ssm", "get-parameters-by-path",
+		"--path", path, "--recursive", "--with-decryption", "--output", "json")
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Parameters []struct {
+			Name  string
+			Type  string
+			Value string
+		}
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return err
+	}
+	for _, p := range resp.Parameters {
+		rel := strings.Trim(strings.TrimPrefix(p.Name, path), "/")
+		if rel == "" {
+			continue
+		}
+		var value interface{} = p.Value
+		if p.Type == "StringList" {
+			list := []interface{}{}
+			for _, v := range strings.Split(p.Value, ",") {
+				list = append(list, v)
+			}
+			value = list
+		}
+		if err := mount(obj, strings.Split(rel, "/"), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadAWSSecret(ctx context.Context, name string, obj interface{}) error {
+	out, err := cachedTool(ctx, "aws", "secretsmanager", "get-secret-value",
+		"--secret-id", name, "--output", "json")
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		SecretString string
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(resp.SecretString), &fields); err == nil {
+		return mount(obj, nil, fields)
+	}
+	return mount(obj, strings.Split(strings.Trim(name, "/"), "/"), resp.SecretString)
+}
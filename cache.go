@@ -0,0 +1,213 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	options.cacheTTL = 5 * time.Minute
+	optionTable = append(optionTable,
+		option{
+			names: []string{"--cache-dir"},
+			value: "DIR",
+			usage: "keep what is fetched from elsewhere in DIR, readable only by you, and reuse it in later runs; stale copies are used if a fetch fails",
+			set: func(dir string) error {
+				options.cacheDir = dir
+				return nil
+			},
+		},
+		option{
+			names: []string{"--cache-ttl"},
+			value: "DURATION",
+			usage: `reuse what is in --cache-dir for DURATION before fetching it again (default is 5m)`,
+			set: func(d string) error {
+				var err error
+				options.cacheTTL, err = time.ParseDuration(d)
+				return err
+			},
+		},
+	)
+}
+
+// cached returns what get returns, by way of --cache-dir. If the copy there
+// is younger than --cache-ttl, get is not called at all. If get fails, an
+// older copy is used instead, with a warning.
+func cached(key string, get func() ([]byte, error)) ([]byte, error) {
+	if options.cacheDir == "" {
+		return get()
+	}
+	path := filepath.Join(options.cacheDir, fmt.Sprintf("%x", sha256.Sum256([]byte(key))))
+	info, statErr := os.Stat(path)
+	if statErr == nil && time.Since(info.ModTime()) < options.cacheTTL {
+		if data, err := ioutil.ReadFile(path); err == nil {
+			return data, nil
+		}
+	}
+
+	data, err := get()
+	if err != nil {
+		if statErr == nil {
+			if stale, serr := ioutil.ReadFile(path); serr == nil {
+				warnf("%v; using the copy cached at %s", err, info.ModTime().Format(time.RFC3339))
+				return stale, nil
+			}
+		}
+		return nil, err
+	}
+	if err := writeCache(path, data); err != nil {
+		warnf("could not cache: %v", err)
+	}
+	return data, nil
+}
+
+// writeCache writes data to path by way of a temporary file, so concurrent
+// renders never see half of it. Secrets end up in here, so it is kept
+// private.
+func writeCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// cachedHTTP sends req by way of the cache. The whole request, headers and
+// body included, is the key, so different logins never share an entry.
+func cachedHTTP(client *http.Client, req *http.Request) (*http.Response, error) {
+	var key bytes.Buffer
+	fmt.Fprintf(&key, "%s %s\n", req.Method, req.URL)
+	req.Header.Write(&key)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		_, err = key.ReadFrom(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, err := cached(key.String(), func() ([]byte, error) {
+		resp, err := send(client, req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return httputil.DumpResponse(resp, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+}
+
+// cachedTool is runTool by way of the cache, for tools that fetch data. Like
+// any other fetch, failures are retried.
+func cachedTool(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return cached(toolKey(name, args), func() ([]byte, error) {
+		var out []byte
+		err := retry(ctx, func() error {
+			var err error
+			out, err = runTool(ctx, name, args...)
+			return err
+		})
+		return out, err
+	})
+}
+
+// toolEnv are the environment variables that pick the account, region,
+// cluster or project each tool reaches.
+var toolEnv = map[string][]string{
+	"aws": {
+		"AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION",
+		"AWS_ACCESS_KEY_ID", "AWS_ROLE_ARN", "AWS_CONFIG_FILE",
+		"AWS_SHARED_CREDENTIALS_FILE", "AWS_ENDPOINT_URL",
+	},
+	"kubectl": {"KUBECONFIG"},
+	"gcloud": {
+		"CLOUDSDK_ACTIVE_CONFIG_NAME", "CLOUDSDK_CONFIG", "CLOUDSDK_CORE_ACCOUNT",
+		"CLOUDSDK_CORE_PROJECT", "GOOGLE_APPLICATION_CREDENTIALS",
+	},
+}
+
+// toolKey is the cache key for running name with args: the command, and
+// what says where it reaches, so that what is fetched with one profile or
+// cluster is never handed out for another.
+func toolKey(name string, args []string) string {
+	var key strings.Builder
+	fmt.Fprintf(&key, "%s %s\n", name, strings.Join(args, " "))
+	for _, v := range toolEnv[name] {
+		fmt.Fprintf(&key, "%s=%s\n", v, os.Getenv(v))
+	}
+	if name == "kubectl" {
+		fmt.Fprintf(&key, "context=%s\n", kubeContext())
+	}
+	return key.String()
+}
+
+// kubeContext returns the context kubectl uses: the current-context of the
+// first of the $KUBECONFIG files, or ~/.kube/config, that has one.
+func kubeContext() string {
+	paths := filepath.SplitList(os.Getenv("KUBECONFIG"))
+	if len(paths) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		paths = []string{filepath.Join(home, ".kube", "config")}
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var config struct {
+			CurrentContext string `yaml:"current-context"`
+		}
+		if yaml.Unmarshal(data, &config) == nil && config.CurrentContext != "" {
+			return config.CurrentContext
+		}
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCachedToolEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	defer func(dir string) { options.cacheDir = dir }(options.cacheDir)
+	options.cacheDir = t.TempDir()
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "aws"), []byte("#!/bin/sh\necho \"$AWS_PROFILE\"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(filepath.ListSeparator)+os.Getenv("PATH"))
+
+	for _, profile := range []string{"dev", "prod", "dev"} {
+		t.Setenv("AWS_PROFILE", profile)
+		out, err := cachedTool(context.Background(), "aws", "secretsmanager", "get-secret-value")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(out); got != profile+"\n" {
+			t.Errorf("with AWS_PROFILE=%s, got %q from the cache", profile, got)
+		}
+	}
+}
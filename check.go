@@ -0,0 +1,161 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	optionTable = append(optionTable,
+		option{
+			names: []string{"--schema"},
+			value: "SCHEMA",
+			usage: "check the object against the JSON Schema in SCHEMA before executing any template, failing with every violation",
+			set: func(path string) error {
+				options.schema = path
+				return nil
+			},
+		},
+		option{
+			names: []string{"--cue-schema"},
+			value: "FILE",
+			usage: "check the object against the CUE in FILE with cue vet before executing any template",
+			set: func(path string) error {
+				options.cueSchema = path
+				return nil
+			},
+		},
+	)
+}
+
+// checkObject checks obj against --schema and --cue-schema, if they were
+// given, returning what is wrong with it.
+func checkObject(ctx context.Context, obj interface{}) error {
+	if options.schema != "" {
+		if err := checkSchema(options.schema, obj); err != nil {
+			return err
+		}
+	}
+	if options.cueSchema != "" {
+		if err := cueVet(ctx, options.cueSchema, obj); err != nil {
+			return fmt.Errorf("--cue-schema: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkSchema checks obj against the JSON Schema in the file at path,
+// returning its violations as an errorList.
+func checkSchema(path string, obj interface{}) error {
+	v, err := loadSchema(path)
+	if err != nil {
+		return fmt.Errorf("--schema: %v", err)
+	}
+	var errs errorList
+	for _, violation := range v.validate(obj) {
+		errs = append(errs, violation)
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// schemas are the validators for the schema files decoded so far, by path.
+// A file is only decoded again once it changes, so that --serve doesn't for
+// every request.
+var schemas = struct {
+	sync.Mutex
+	m map[string]decodedSchema
+}{m: map[string]decodedSchema{}}
+
+type decodedSchema struct {
+	modTime time.Time
+	size    int64
+	v       *validator
+}
+
+// loadSchema returns the validator for the JSON Schema in the file at path.
+// The file is decoded as it is, by its extension: none of what a FILE gets,
+// like --merge or --null-deletes, applies to it.
+func loadSchema(path string) (*validator, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	schemas.Lock()
+	s, ok := schemas.m[path]
+	schemas.Unlock()
+	if ok && s.modTime.Equal(info.ModTime()) && s.size == info.Size() {
+		return s.v, nil
+	}
+	format := fileFormat(path)
+	if format == "" {
+		return nil, fmt.Errorf("don't know how to decode %q", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var schema interface{}
+	if err := decode(format, f, &schema); err != nil {
+		return nil, err
+	}
+	v, err := newValidator(schema)
+	if err != nil {
+		return nil, err
+	}
+	schemas.Lock()
+	schemas.m[path] = decodedSchema{info.ModTime(), info.Size(), v}
+	schemas.Unlock()
+	return v, nil
+}
+
+// cueVet checks obj against the CUE in path with the cue tool, which says
+// where the object goes wrong.
+func cueVet(ctx context.Context, path string, obj interface{}) error {
+	text, err := formatJson(jsonable(obj))
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile("", "tmplcute-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := runTool(ctx, "cue", "vet", path, f.Name()); err != nil {
+		// The data file's name means nothing to anyone.
+		return errors.New(strings.Replace(err.Error(), f.Name(), "the object", -1))
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckSchema(t *testing.T) {
+	defer func(nullDeletes bool) { options.nullDeletes = nullDeletes }(options.nullDeletes)
+	options.nullDeletes = true
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"schema.json": `{"properties":{"a":{"const":null}},"required":["a"]}`,
+	})
+	path := filepath.Join(dir, "schema.json")
+
+	// The schema's null stays, whatever --null-deletes does to FILEs.
+	err := checkSchema(path, map[string]interface{}{"a": 1.0})
+	if errs, ok := err.(errorList); !ok || len(errs) != 1 {
+		t.Errorf("got %v, want a violation of the const", err)
+	}
+	if err := checkSchema(path, map[string]interface{}{"a": nil}); err != nil {
+		t.Errorf("got %v, want none", err)
+	}
+	first, err := loadSchema(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := loadSchema(path); err != nil || again != first {
+		t.Errorf("the schema was decoded again")
+	}
+}
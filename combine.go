@@ -0,0 +1,216 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--merge"},
+		value: "HOW",
+		usage: `how a FILE or data source combines with what the earlier ones built: "deep", the default, merging objects field by field, "shallow", replacing each top-level field whole, or "replace", replacing the whole object`,
+		set:   options.setMerge,
+	}, option{
+		names: []string{"--array-merge"},
+		value: "STRATEGY",
+		usage: `how a list in a FILE or data source combines with the list an earlier one put in the same place: "replace" it, the default, "append" to it, "merge-by-index", combining the items at the same index as other values are and appending the rest, or "merge-by=KEY", combining the items with the same KEY and appending the rest`,
+		set:   options.setArrayMerge,
+	})
+}
+
+// setMerge sets how documents combine, as --merge=HOW does.
+func (c *config) setMerge(how string) error {
+	switch how {
+	case "deep", "shallow", "replace":
+		c.merge = how
+		return nil
+	}
+	return fmt.Errorf("merges can be deep, shallow or replace, not %q", how)
+}
+
+// setArrayMerge sets how lists combine, as --array-merge=STRATEGY does.
+func (c *config) setArrayMerge(strategy string) error {
+	switch {
+	case strategy == "replace", strategy == "append", strategy == "merge-by-index":
+		c.arrayMerge, c.mergeBy = strategy, ""
+	case strings.HasPrefix(strategy, "merge-by=") && len(strategy) > len("merge-by="):
+		c.arrayMerge, c.mergeBy = "merge-by", strategy[len("merge-by="):]
+	default:
+		return fmt.Errorf(`the strategy can be replace, append, merge-by-index or merge-by=KEY, not %q`, strategy)
+	}
+	return nil
+}
+
+// combine puts the fields of layer, a document, onto obj, which the earlier
+// documents built, as c says. With --merge=replace, the fields obj had are
+// gone.
+func (c *config) combine(obj, layer map[string]interface{}) {
+	if c.merge == "replace" {
+		for k := range obj {
+			delete(obj, k)
+		}
+	}
+	for k, v := range layer {
+		c.combineField(obj, k, v)
+	}
+}
+
+// combineField puts v at name in obj, combining it with what is there. With
+// --null-deletes, a null v takes the field away instead.
+func (c *config) combineField(obj map[string]interface{}, name string, v interface{}) {
+	if v == nil && c.nullDeletes {
+		delete(obj, name)
+		return
+	}
+	obj[name] = c.combineValue(obj[name], v)
+}
+
+// combineValue is what a later document's value v makes of an earlier one's
+// old, in the same place. Objects are merged, unless --merge=shallow; lists
+// are combined by --array-merge; anything else is replaced.
+func (c *config) combineValue(old, v interface{}) interface{} {
+	if c.merge == "" || c.merge == "deep" {
+		if oldMap, ok := asMap(old); ok {
+			if m, ok := asMap(v); ok {
+				for k, child := range m {
+					c.combineField(oldMap, k, child)
+				}
+				return oldMap
+			}
+		}
+	}
+	if c.nullDeletes {
+		// Only v is looked through, so the nulls an earlier document left
+		// aren't taken away again.
+		deleteNulls(v)
+	}
+	oldList, ok := old.([]interface{})
+	list, isList := v.([]interface{})
+	if !ok || !isList {
+		return v
+	}
+	switch c.arrayMerge {
+	case "append":
+		return append(append([]interface{}{}, oldList...), list...)
+	case "merge-by":
+		return c.mergeByKey(oldList, list, c.mergeBy)
+	case "merge-by-index":
+		return c.mergeByIndex(oldList, list)
+	}
+	return v
+}
+
+// deleteNulls removes the fields in v whose values are null, however deep,
+// for --null-deletes. Nulls in lists stay, so the rest keep their indexes.
+func deleteNulls(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if child == nil {
+				delete(v, k)
+			} else {
+				deleteNulls(child)
+			}
+		}
+	case map[interface{}]interface{}:
+		for k, child := range v {
+			if child == nil {
+				delete(v, k)
+			} else {
+				deleteNulls(child)
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			deleteNulls(child)
+		}
+	}
+}
+
+// mergeByIndex combines two lists item by item, and appends what is left of
+// the longer one.
+func (c *config) mergeByIndex(old, list []interface{}) []interface{} {
+	merged := append([]interface{}{}, old...)
+	for i, item := range list {
+		if i < len(merged) {
+			merged[i] = c.combineValue(merged[i], item)
+		} else {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// mergeByKey combines two lists of objects that each have a field key, like a
+// name: an item in list is combined with the one in old with the same key,
+// and the rest are appended. Items without the key are always appended.
+func (c *config) mergeByKey(old, list []interface{}, key string) []interface{} {
+	merged := append([]interface{}{}, old...)
+	at := map[string]int{}
+	for i, item := range merged {
+		if id, ok := itemKey(item, key); ok {
+			at[id] = i
+		}
+	}
+	for _, item := range list {
+		id, ok := itemKey(item, key)
+		if i, found := at[id]; ok && found {
+			merged[i] = c.combineValue(merged[i], item)
+			continue
+		}
+		if ok {
+			at[id] = len(merged)
+		}
+		merged = append(merged, item)
+	}
+	return merged
+}
+
+// asMap returns v as a map[string]interface{}, if it is an object. YAML's
+// maps are converted, so they can be merged with JSON's.
+func asMap(v interface{}) (map[string]interface{}, bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[fmt.Sprint(k)] = child
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+// itemKey is the value of the field key in item, as JSON so that any kind
+// of value can be compared, if item is an object that has it.
+func itemKey(item interface{}, key string) (string, bool) {
+	m, ok := jsonable(item).(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	v, ok := m[key]
+	if !ok {
+		return "", false
+	}
+	id, err := json.Marshal(v)
+	return string(id), err == nil
+}
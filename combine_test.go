@@ -0,0 +1,169 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCombine(t *testing.T) {
+	defer func(merge, arrayMerge, mergeBy string) {
+		options.merge, options.arrayMerge, options.mergeBy = merge, arrayMerge, mergeBy
+	}(options.merge, options.arrayMerge, options.mergeBy)
+
+	const (
+		base  = `{"a":{"x":1,"y":2},"list":[{"name":"p","v":1},{"name":"q","v":2}],"n":1}`
+		layer = `{"a":{"y":3},"list":[{"name":"q","w":3},{"v":4}]}`
+	)
+	tests := []struct {
+		merge, arrayMerge string
+		want              string
+	}{
+		{"", "", `{"a":{"x":1,"y":3},"list":[{"name":"q","w":3},{"v":4}],"n":1}`},
+		{"deep", "replace", `{"a":{"x":1,"y":3},"list":[{"name":"q","w":3},{"v":4}],"n":1}`},
+		{"shallow", "", `{"a":{"y":3},"list":[{"name":"q","w":3},{"v":4}],"n":1}`},
+		{"replace", "", `{"a":{"y":3},"list":[{"name":"q","w":3},{"v":4}]}`},
+		{"", "append", `{"a":{"x":1,"y":3},"list":[{"name":"p","v":1},{"name":"q","v":2},{"name":"q","w":3},{"v":4}],"n":1}`},
+		{"", "merge-by-index", `{"a":{"x":1,"y":3},"list":[{"name":"q","v":1,"w":3},{"name":"q","v":4}],"n":1}`},
+		{"", "merge-by=name", `{"a":{"x":1,"y":3},"list":[{"name":"p","v":1},{"name":"q","v":2,"w":3},{"v":4}],"n":1}`},
+		{"shallow", "merge-by=name", `{"a":{"y":3},"list":[{"name":"p","v":1},{"name":"q","w":3},{"v":4}],"n":1}`},
+	}
+	for _, test := range tests {
+		options.merge, options.arrayMerge, options.mergeBy = "", "", ""
+		if test.merge != "" {
+			if err := lookupOption("--merge").set(test.merge); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.arrayMerge != "" {
+			if err := lookupOption("--array-merge").set(test.arrayMerge); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var obj, l map[string]interface{}
+		if err := json.Unmarshal([]byte(base), &obj); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(layer), &l); err != nil {
+			t.Fatal(err)
+		}
+		options.combine(obj, l)
+		got, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("--merge=%s --array-merge=%s: got %s, want %s", test.merge, test.arrayMerge, got, test.want)
+		}
+	}
+}
+
+func TestCombineYAML(t *testing.T) {
+	defer func(merge string) { options.merge = merge }(options.merge)
+	options.merge = ""
+
+	obj := map[string]interface{}{"a": map[interface{}]interface{}{"x": 1, 2: "two"}}
+	options.combine(obj, map[string]interface{}{"a": map[string]interface{}{"y": 3}})
+	got, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":{"2":"two","x":1,"y":3}}`; string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestMergeOptions(t *testing.T) {
+	defer func(merge, arrayMerge, mergeBy string) {
+		options.merge, options.arrayMerge, options.mergeBy = merge, arrayMerge, mergeBy
+	}(options.merge, options.arrayMerge, options.mergeBy)
+
+	for _, bad := range []string{"", "deeper"} {
+		if err := lookupOption("--merge").set(bad); err == nil {
+			t.Errorf("--merge=%s gave no error", bad)
+		}
+	}
+	for _, bad := range []string{"", "merge-by=", "merge-by-name", "prepend"} {
+		if err := lookupOption("--array-merge").set(bad); err == nil {
+			t.Errorf("--array-merge=%s gave no error", bad)
+		}
+	}
+	if err := lookupOption("--array-merge").set("merge-by=id"); err != nil {
+		t.Fatal(err)
+	}
+	if options.arrayMerge != "merge-by" || options.mergeBy != "id" {
+		t.Errorf("--array-merge=merge-by=id set %q and %q", options.arrayMerge, options.mergeBy)
+	}
+}
+
+func TestMountCombines(t *testing.T) {
+	defer func(merge, arrayMerge string) {
+		options.merge, options.arrayMerge = merge, arrayMerge
+	}(options.merge, options.arrayMerge)
+	options.merge, options.arrayMerge = "", "append"
+	t.Setenv("TMPLCUTE_TEST_NEW", "new")
+
+	file := filepath.Join(t.TempDir(), "base.json")
+	if err := os.WriteFile(file, []byte(`{"Env":{"TMPLCUTE_TEST_OLD":"old"},"tags":["a"],"db":{"host":"h"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	obj := map[string]interface{}{}
+	if err := loadArg(context.Background(), file, &obj); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadEnv(context.Background(), "TMPLCUTE_TEST_", &obj); err != nil {
+		t.Fatal(err)
+	}
+	if err := mount(&obj, nil, map[string]interface{}{"tags": []interface{}{"b"}, "db": map[string]interface{}{"port": 1.0}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Env":{"TMPLCUTE_TEST_NEW":"new","TMPLCUTE_TEST_OLD":"old"},"db":{"host":"h","port":1},"tags":["a","b"]}`
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestCombineNullDeletes(t *testing.T) {
+	defer func(merge string, nullDeletes bool) {
+		options.merge, options.nullDeletes = merge, nullDeletes
+	}(options.merge, options.nullDeletes)
+	options.merge, options.nullDeletes = "", true
+
+	// The null at keep was set before, and isn't this layer's to take away.
+	obj := map[string]interface{}{"a": map[string]interface{}{"x": 1.0, "y": 2.0}, "keep": nil, "n": 1.0}
+	options.combine(obj, map[string]interface{}{
+		"a":   map[string]interface{}{"x": nil},
+		"b":   map[string]interface{}{"z": nil, "list": []interface{}{nil, 3.0}},
+		"n":   nil,
+		"new": nil,
+	})
+	got, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":{"y":2},"b":{"list":[null,3]},"keep":null}`; string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
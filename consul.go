@@ -0,0 +1,88 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--consul"},
+		value: "PREFIX",
+		usage: "load the Consul KV keys under PREFIX, as nested fields split on /, from $CONSUL_HTTP_ADDR with $CONSUL_HTTP_TOKEN",
+		load:  loadConsul,
+	})
+}
+
+// loadConsul reads every key under prefix from Consul's KV store. A key like
+// PREFIX/db/host becomes the field db.host.
+func loadConsul(ctx context.Context, prefix string, obj interface{}) error {
+	addr := os.Getenv("CONSUL_HTTP_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:8500"
+	}
+	if !strings.Contains(addr, "://") {
+		if os.Getenv("CONSUL_HTTP_SSL") == "true" {
+			addr = "https://" + addr
+		} else {
+			addr = "http://" + addr
+		}
+	}
+	prefix = strings.TrimPrefix(prefix, "/")
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(addr, "/")+"/v1/kv/"+prefix+"?recurse=true", nil)
+	if err != nil {
+		return err
+	}
+	if token := os.Getenv("CONSUL_HTTP_TOKEN"); token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	resp, err := httpDo(nil, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var pairs []struct {
+		Key   string
+		Value *string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		rel := strings.Trim(strings.TrimPrefix(pair.Key, prefix), "/")
+		if rel == "" || strings.HasSuffix(pair.Key, "/") || pair.Value == nil {
+			// Folders have no value of their own.
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(*pair.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", pair.Key, err)
+		}
+		if err := mount(obj, strings.Split(rel, "/"), string(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template/parse"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--coverage"},
+		value: "FILE",
+		usage: "count how many times each action and branch of the templates executes, adding the counts to those in FILE",
+		set: func(file string) error {
+			if options.coverage == "" {
+				instruments = append(instruments, instrument{
+					funcs: map[string]interface{}{
+						"tmplcuteCover":       coverValue,
+						"tmplcuteCoverBranch": coverBranch,
+					},
+					rewrite: coverTree,
+				})
+			}
+			options.coverage = file
+			return nil
+		},
+	})
+}
+
+// A coverReport counts how many times each action and branch has executed.
+// The keys are "LOCATION\tTEXT", like "page.tmpl:3:5\t{{if .admin}} else".
+type coverReport map[string]int64
+
+// covered is what has executed so far.
+var covered = struct {
+	sync.Mutex
+	report coverReport
+}{report: coverReport{}}
+
+// coverTree makes every action in tree count itself, and every if, range and
+// with count which of its branches is taken.
+func coverTree(tree *parse.Tree) {
+	type branch struct {
+		b              *parse.BranchNode
+		location, text string
+	}
+	var branches []branch
+	eachPipe(tree.Root, func(owner parse.Node, pipe *parse.PipeNode) {
+		location, _ := tree.ErrorContext(pipe)
+		text := actionText(owner)
+		appendCall(pipe, "tmplcuteCover", coverKey(location, text))
+		switch n := owner.(type) {
+		case *parse.IfNode:
+			branches = append(branches, branch{&n.BranchNode, location, text})
+		case *parse.RangeNode:
+			branches = append(branches, branch{&n.BranchNode, location, text})
+		case *parse.WithNode:
+			branches = append(branches, branch{&n.BranchNode, location, text})
+		}
+	})
+	// The branches get their counters once eachPipe is done with them.
+	for _, br := range branches {
+		coverList(br.b.List, coverKey(br.location, br.text+" body"))
+		if br.b.ElseList != nil {
+			coverList(br.b.ElseList, coverKey(br.location, br.text+" else"))
+		}
+	}
+}
+
+// coverKey adds the key for an action or branch to the report, if it isn't
+// already there, so that ones that never execute are reported too.
+func coverKey(location, text string) string {
+	key := location + "\t" + text
+	covered.Lock()
+	if _, ok := covered.report[key]; !ok {
+		covered.report[key] = 0
+	}
+	covered.Unlock()
+	return key
+}
+
+// coverList puts a counter for key at the start of list. The counter is an
+// {{if}} that is never true, so it prints nothing even in html/template's
+// scripts and attributes.
+func coverList(list *parse.ListNode, key string) {
+	pos := list.Position()
+	pipe := &parse.PipeNode{NodeType: parse.NodePipe, Pos: pos}
+	appendCall(pipe, "tmplcuteCoverBranch", key)
+	counter := &parse.IfNode{BranchNode: parse.BranchNode{
+		NodeType: parse.NodeIf,
+		Pos:      pos,
+		Pipe:     pipe,
+		List:     &parse.ListNode{NodeType: parse.NodeList, Pos: pos},
+	}}
+	list.Nodes = append([]parse.Node{counter}, list.Nodes...)
+}
+
+func count(key string) {
+	covered.Lock()
+	covered.report[key]++
+	covered.Unlock()
+}
+
+// coverValue counts the action at key, and passes its value on.
+func coverValue(key string, v interface{}) interface{} {
+	count(key)
+	return v
+}
+
+// coverBranch counts the branch at key.
+func coverBranch(key string) bool {
+	count(key)
+	return false
+}
+
+// writeCoverage adds what has executed to the report in the --coverage file.
+func writeCoverage() error {
+	if options.coverage == "" {
+		return nil
+	}
+	covered.Lock()
+	defer covered.Unlock()
+	return covered.report.addTo(options.coverage)
+}
+
+// readCoverage reads the report in path, which is empty if there isn't one.
+func readCoverage(path string) (coverReport, error) {
+	r := coverReport{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: not LOCATION\tCOUNT\tTEXT", path, n)
+		}
+		c, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		r[fields[0]+"\t"+fields[2]] += c
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// addTo adds the counts in r to those in the report in path.
+func (r coverReport) addTo(path string) error {
+	all, err := readCoverage(path)
+	if err != nil {
+		return err
+	}
+	for key, c := range r {
+		all[key] += c
+	}
+	return ioutil.WriteFile(path, []byte(all.String()), 0644)
+}
+
+// ran returns how many actions and branches executed, out of how many.
+func (r coverReport) ran() (ran, total int) {
+	for _, c := range r {
+		if c != 0 {
+			ran++
+		}
+	}
+	return ran, len(r)
+}
+
+// summary is a line saying how much of the templates executed.
+func (r coverReport) summary() string {
+	ran, total := r.ran()
+	percent := 100.0
+	if total != 0 {
+		percent = 100 * float64(ran) / float64(total)
+	}
+	return fmt.Sprintf("coverage: %d of %d actions and branches executed (%.1f%%)", ran, total, percent)
+}
+
+// String is the report as it is written to the --coverage file: a line for
+// each action and branch, in order through each template, with how many times
+// it executed.
+func (r coverReport) String() string {
+	keys := make([]string, 0, len(r))
+	for key := range r {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return coverLess(keys[i], keys[j])
+	})
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", r.summary())
+	for _, key := range keys {
+		tab := strings.Index(key, "\t")
+		fmt.Fprintf(&b, "%s\t%d\t%s\n", key[:tab], r[key], key[tab+1:])
+	}
+	return b.String()
+}
+
+// coverLess orders keys by template, then line and column, then text.
+func coverLess(a, b string) bool {
+	aName, aLine, aCol, aText := splitCoverKey(a)
+	bName, bLine, bCol, bText := splitCoverKey(b)
+	switch {
+	case aName != bName:
+		return aName < bName
+	case aLine != bLine:
+		return aLine < bLine
+	case aCol != bCol:
+		return aCol < bCol
+	}
+	return aText < bText
+}
+
+// splitCoverKey breaks a key into its parts. The template's name comes first
+// in the location, and can have colons of its own.
+func splitCoverKey(key string) (name string, line, col int, text string) {
+	tab := strings.Index(key, "\t")
+	location, text := key[:tab], key[tab+1:]
+	parts := strings.Split(location, ":")
+	if len(parts) < 3 {
+		return location, 0, 0, text
+	}
+	line, _ = strconv.Atoi(parts[len(parts)-2])
+	col, _ = strconv.Atoi(parts[len(parts)-1])
+	return strings.Join(parts[:len(parts)-2], ":"), line, col, text
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+func init() {
+	optionTable = append(optionTable,
+		option{
+			names: []string{"-d", "--data"},
+			value: "FILE",
+			usage: "build the object with the document in FILE, in its place among the arguments, like a FILE argument, but one whose extension doesn't say whether it is JSON or YAML is looked at to tell; - is stdin, for when the templates come from -f, --render or -r",
+			set: func(file string) error {
+				if file == "-" {
+					options.dataStdin = true
+				}
+				return nil
+			},
+			load: loadData,
+			url:  true,
+		},
+		option{
+			names: []string{"-d-format", "--data-format"},
+			value: "FORMAT",
+			usage: `the format of every -d FILE: "json", "yaml", "rjson" or "toml" (default is to go by its extension, or to tell JSON from YAML by looking)`,
+			set: func(format string) error {
+				switch format {
+				case "json", "yaml", "rjson", "toml":
+					options.dataFormat = format
+					return nil
+				}
+				return fmt.Errorf(`the formats are "json", "yaml", "rjson" and "toml", not %q`, format)
+			},
+		},
+	)
+}
+
+// stdinData is the document a -d - read from stdin, decoded. It is read
+// once, since --watch and --reload build the object again after stdin is
+// drained.
+var stdinData struct {
+	sync.Once
+	layer map[string]interface{}
+	err   error
+}
+
+// loadData builds onto obj with the -d FILE.
+func loadData(ctx context.Context, file string, obj interface{}) error {
+	known := fileFormat(file) != "" || isURL(file) || isObjectURI(file)
+	if file != "-" && options.dataFormat == "" && known {
+		return loadArg(ctx, file, obj)
+	}
+	if file == "-" {
+		return loadStdinData(ctx, obj)
+	}
+	text, err := readTemplate(ctx, file)
+	if err != nil {
+		return err
+	}
+	format := dataFormat(text)
+	layer := map[string]interface{}{}
+	if err := decode(format, strings.NewReader(text), &layer); err != nil {
+		return err
+	}
+	m, ok := obj.(*map[string]interface{})
+	if !ok {
+		return decode(format, strings.NewReader(text), obj)
+	}
+	noteSecrets(&layer)
+	configFrom(ctx).combine(*m, jsonable(layer).(map[string]interface{}))
+	return nil
+}
+
+// loadStdinData builds onto obj with the document in stdin, for -d -.
+func loadStdinData(ctx context.Context, obj interface{}) error {
+	if templateOnStdin() {
+		return fmt.Errorf("stdin is only data when the templates come from -f, --render or -r")
+	}
+	stdinData.Do(func() {
+		text, err := readText(os.Stdin, 0)
+		if err != nil {
+			stdinData.err = err
+			return
+		}
+		stdinData.layer = map[string]interface{}{}
+		stdinData.err = decode(dataFormat(text), strings.NewReader(text), &stdinData.layer)
+	})
+	if stdinData.err != nil {
+		return stdinData.err
+	}
+	m, ok := obj.(*map[string]interface{})
+	if !ok {
+		return fmt.Errorf("cannot build %T with stdin", obj)
+	}
+	noteSecrets(&stdinData.layer)
+	configFrom(ctx).combine(*m, jsonable(stdinData.layer).(map[string]interface{}))
+	return nil
+}
+
+// dataFormat returns the format of text from a -d FILE: the -d-format, or
+// failing that, whichever of JSON and YAML it looks like.
+func dataFormat(text string) string {
+	if options.dataFormat != "" {
+		return options.dataFormat
+	}
+	return sniffFormat(text)
+}
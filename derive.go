@@ -0,0 +1,58 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A derivation is a --derive: a KEY set to what a template prints.
+type derivation struct {
+	key, template string
+}
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--derive"},
+		value: "KEY=TEMPLATE",
+		usage: "once the object is built, set KEY to what TEMPLATE prints when executed with it, as a --KEY=VALUE would, like --derive='fqdn={{.host}}.{{.domain}}'; may be repeated, and each sees what the ones before set",
+		set: func(arg string) error {
+			eq := strings.Index(arg, "=")
+			if eq <= 0 {
+				return fmt.Errorf("%q is not KEY=TEMPLATE", arg)
+			}
+			options.derives = append(options.derives, derivation{arg[:eq], arg[eq+1:]})
+			return nil
+		},
+	})
+}
+
+// derive sets the --derive KEYs in obj, in order.
+func derive(obj map[string]interface{}) error {
+	for _, d := range options.derives {
+		var buf bytes.Buffer
+		if err := render("--derive "+d.key, d.template, false, obj, &buf); err != nil {
+			return err
+		}
+		if err := options.override(&obj, d.key, buf.String()); err != nil {
+			return &stageError{stage: "transform", key: d.key, err: err}
+		}
+	}
+	return nil
+}
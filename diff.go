@@ -0,0 +1,145 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+)
+
+var diffUsage = `Usage: tmplcute diff FILE1{.json,.rjson,.yaml,.toml} FILE2{.json,.rjson,.yaml,.toml}
+
+diff decodes both documents and prints the paths, as KEYs, where they differ:
+"+" for paths only in FILE2, "-" for paths only in FILE1, and "~" for values
+that changed. Formatting and key order don't matter. The exit status is 1 if
+there are differences.
+`
+
+func diff(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, diffUsage)
+		os.Exit(2)
+	}
+
+	a := map[string]interface{}{}
+	processArg(args[0], &a)
+	b := map[string]interface{}{}
+	processArg(args[1], &b)
+
+	lines := diffValues("", jsonable(a), jsonable(b), nil)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	if len(lines) != 0 {
+		os.Exit(1)
+	}
+}
+
+// diffValues appends a line to lines for every difference between a and b,
+// which are found at path.
+func diffValues(path string, a, b interface{}, lines []string) []string {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		names := []string{}
+		for name := range a {
+			names = append(names, name)
+		}
+		for name := range b {
+			if _, ok := a[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			av, inA := a[name]
+			bv, inB := b[name]
+			switch {
+			case !inB:
+				lines = append(lines, fmt.Sprintf("- %s: %s", fieldPath(path, name), compact(av)))
+			case !inA:
+				lines = append(lines, fmt.Sprintf("+ %s: %s", fieldPath(path, name), compact(bv)))
+			default:
+				lines = diffValues(fieldPath(path, name), av, bv, lines)
+			}
+		}
+		return lines
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(a) || i < len(b); i++ {
+			switch {
+			case i >= len(b):
+				lines = append(lines, fmt.Sprintf("- %s: %s", indexPath(path, i), compact(a[i])))
+			case i >= len(a):
+				lines = append(lines, fmt.Sprintf("+ %s: %s", indexPath(path, i), compact(b[i])))
+			default:
+				lines = diffValues(indexPath(path, i), a[i], b[i], lines)
+			}
+		}
+		return lines
+	}
+	if !reflect.DeepEqual(normalNumber(a), normalNumber(b)) {
+		lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", path, compact(a), compact(b)))
+	}
+	return lines
+}
+
+// fieldPath is the KEY for the field name inside path.
+func fieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// indexPath is the KEY for element i inside path.
+func indexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// normalNumber turns any number into a float64, since json and yaml don't
+// agree on how to decode them.
+func normalNumber(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return v
+}
+
+// compact is v as single-line json.
+func compact(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
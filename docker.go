@@ -0,0 +1,126 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--docker"},
+		value: "CONTAINER|IMAGE",
+		usage: "load what docker inspect says about CONTAINER, or else IMAGE, from the daemon at $DOCKER_HOST",
+		load:  loadDocker,
+	})
+}
+
+// loadDocker asks the Docker daemon about name, as a container and then as
+// an image, and merges the answer onto obj.
+func loadDocker(ctx context.Context, name string, obj interface{}) error {
+	client, base, err := dockerClient()
+	if err != nil {
+		return err
+	}
+	var inspect map[string]interface{}
+	err = dockerGet(ctx, client, base+"/containers/"+url.PathEscape(name)+"/json", &inspect)
+	if err != nil {
+		if dockerGet(ctx, client, base+"/images/"+url.PathEscape(name)+"/json", &inspect) != nil {
+			return err
+		}
+	}
+	return mount(obj, nil, inspect)
+}
+
+func dockerGet(ctx context.Context, client *http.Client, u string, into interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpDo(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(into)
+}
+
+// dockerClient returns a client for the daemon at $DOCKER_HOST, which is the
+// local socket by default, and the URL to reach it at. Like the docker tool,
+// TLS is used when $DOCKER_TLS_VERIFY is set, with the certificates in
+// $DOCKER_CERT_PATH.
+func dockerClient() (*http.Client, string, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = "unix:///var/run/docker.sock"
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, "", err
+	}
+	switch u.Scheme {
+	case "unix":
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", u.Path)
+			},
+		}
+		// The host is only there to make a URL; the socket is what's dialed.
+		return &http.Client{Transport: transport, Timeout: options.timeout}, "http://docker", nil
+	case "tcp", "http", "https":
+	default:
+		return nil, "", fmt.Errorf("DOCKER_HOST: don't know how to reach %q", host)
+	}
+	if os.Getenv("DOCKER_TLS_VERIFY") == "" && u.Scheme != "https" {
+		return &http.Client{Timeout: options.timeout}, "http://" + u.Host, nil
+	}
+
+	dir := os.Getenv("DOCKER_CERT_PATH")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, "", err
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	config := &tls.Config{}
+	if ca, err := ioutil.ReadFile(filepath.Join(dir, "ca.pem")); err == nil {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, "", fmt.Errorf("no certificates in %s", filepath.Join(dir, "ca.pem"))
+		}
+	}
+	if cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")); err == nil {
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: config},
+		Timeout:   options.timeout,
+	}, "https://" + strings.TrimSuffix(u.Host, "/"), nil
+}
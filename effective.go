@@ -0,0 +1,118 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--emit-effective-config"},
+		value: "FILE",
+		usage: "write what the run was made of to FILE as JSON, to audit or repeat it: the options, the sources in order and the templates, with the SHA-256 of each local file, and the functions the templates could and couldn't call",
+		set: func(file string) error {
+			options.effectiveConfig = file
+			return nil
+		},
+	})
+}
+
+// givenOptions are the options that were set, other than those that load
+// data, as they were given.
+var givenOptions []string
+
+// An effectiveSource is a source of the object, in --emit-effective-config.
+type effectiveSource struct {
+	Arg    string `json:"arg"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// An effectiveTemplate is a template, in --emit-effective-config.
+type effectiveTemplate struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+// writeEffectiveConfig writes the --emit-effective-config file, for a run
+// whose object was built from srcs.
+func writeEffectiveConfig(ctx context.Context, srcs []source) error {
+	if options.effectiveConfig == "" {
+		return nil
+	}
+	sources := []effectiveSource{}
+	for _, src := range srcs {
+		es := effectiveSource{Arg: src.arg}
+		if src.load == nil && !strings.HasPrefix(src.arg, "--") && !isURL(src.arg) && !isObjectURI(src.arg) {
+			file, _ := splitNamespace(src.arg)
+			if data, err := ioutil.ReadFile(file); err == nil {
+				es.SHA256 = sha256Hex(data)
+			}
+		}
+		sources = append(sources, es)
+	}
+
+	texts, err := templateTexts(ctx)
+	if err != nil {
+		return err
+	}
+	templates := []effectiveTemplate{}
+	for name, text := range texts {
+		templates = append(templates, effectiveTemplate{name, sha256Hex([]byte(text))})
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+
+	denied := map[string]bool{}
+	for _, f := range gatedFuncs {
+		if !options.allowed[f.allow] {
+			denied[f.name] = true
+		}
+	}
+	funcs, deniedFuncs := []string{}, []string{}
+	for name := range funcMap() {
+		if denied[name] {
+			deniedFuncs = append(deniedFuncs, name)
+		} else {
+			funcs = append(funcs, name)
+		}
+	}
+	sort.Strings(funcs)
+	sort.Strings(deniedFuncs)
+
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"options":     append([]string{}, givenOptions...),
+		"sources":     sources,
+		"templates":   templates,
+		"funcs":       funcs,
+		"deniedFuncs": deniedFuncs,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(options.effectiveConfig, []byte(redact(string(data))+"\n"), 0644)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
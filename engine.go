@@ -0,0 +1,62 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--engine"},
+		value: "EXT=ENGINE",
+		usage: `execute the templates whose outputs end in EXT, like .svg, with ENGINE, "html" or "text"; .html and .htm are html, and the rest are text, or html with --html (can be given more than once)`,
+		set: func(pair string) error {
+			eq := strings.Index(pair, "=")
+			if eq == -1 {
+				return fmt.Errorf("%q is not EXT=ENGINE", pair)
+			}
+			ext, engine := strings.ToLower(pair[:eq]), pair[eq+1:]
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			switch engine {
+			case "html", "text":
+			default:
+				return fmt.Errorf("no engine called %q, only html and text", engine)
+			}
+			if options.engines == nil {
+				options.engines = map[string]string{}
+			}
+			options.engines[ext] = engine
+			return nil
+		},
+	})
+}
+
+// htmlFor reports whether the template writing to output is executed with
+// html/template, as its extension says. Output that isn't a file, like
+// stdout, has no extension, so --html decides.
+func htmlFor(output string) bool {
+	ext := strings.ToLower(filepath.Ext(output))
+	if engine, ok := options.engines[ext]; ok {
+		return engine == "html"
+	}
+	return options.html || ext == ".html" || ext == ".htm"
+}
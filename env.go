@@ -0,0 +1,50 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names:    []string{"--env"},
+		value:    "PREFIX",
+		optional: true,
+		usage:    "load the environment variables, or just those whose names start with PREFIX, under Env, like {{.Env.HOME}}",
+		load:     loadEnv,
+		mounts: func(string, settings) []string {
+			return []string{"Env"}
+		},
+	})
+}
+
+func loadEnv(ctx context.Context, prefix string, obj interface{}) error {
+	env := map[string]interface{}{}
+	for _, kv := range os.Environ() {
+		name, value := kv, ""
+		if eq := strings.Index(kv, "="); eq != -1 {
+			name, value = kv[:eq], kv[eq+1:]
+		}
+		if strings.HasPrefix(name, prefix) {
+			env[name] = value
+		}
+	}
+	return mount(obj, []string{"Env"}, env)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--errors"},
+		value: "FORMAT",
+		usage: `report errors on stderr as "text", the default, or as "json", an object per line with the stage, file, line, column, key and message`,
+		set: func(format string) error {
+			switch format {
+			case "text", "json":
+				options.errorsJSON = format == "json"
+				return nil
+			}
+			return fmt.Errorf("errors can be text or json, not %q", format)
+		},
+	})
+}
+
+// A stageError is an error from one stage of what tmplcute does, like
+// loading a FILE, with what it was working on. It reads the same as err.
+type stageError struct {
+	// stage is "options", "load", "transform" (for --derive too), "check" or
+	// "write". Parsing and executing templates have errors of their own, so
+	// --errors=json can tell those apart without being told.
+	stage string
+	file  string
+	key   string
+	err   error
+}
+
+func (e *stageError) Error() string { return e.err.Error() }
+func (e *stageError) Unwrap() error { return e.err }
+
+// inStage makes err, if there is one, an error from stage.
+func inStage(stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &stageError{stage: stage, err: err}
+}
+
+// An errorJSON is what --errors=json says about one error.
+type errorJSON struct {
+	Stage   string `json:"stage,omitempty"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+// writeErrorJSON writes err to w as --errors=json does, a line for each of
+// the errors in it.
+func writeErrorJSON(w io.Writer, err error) {
+	enc := json.NewEncoder(w)
+	for _, e := range describe(err, errorJSON{}) {
+		e.Message = redact(e.Message)
+		enc.Encode(e)
+	}
+}
+
+// parseErrorRE matches what text/template says when parsing fails.
+var parseErrorRE = regexp.MustCompile(`(?s)^template: (.*?):(\d+):(?:(\d+):)? (.*)$`)
+
+// yamlLineRE finds the line in what yaml says is wrong with a document.
+var yamlLineRE = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// describe breaks err into the errors in it, with as much as it says about
+// where each one is, on top of what d already says.
+func describe(err error, d errorJSON) []errorJSON {
+	switch e := err.(type) {
+	case errorList:
+		var all []errorJSON
+		for _, err := range e {
+			all = append(all, describe(err, d)...)
+		}
+		return all
+	case *stageError:
+		d.Stage = e.stage
+		if e.file != "" {
+			d.File = e.file
+		}
+		if e.key != "" {
+			d.Key = e.key
+		}
+		return describe(e.err, d)
+	case *execError:
+		d.Stage, d.File, d.Line, d.Column, d.Key, d.Message = "execute", e.name, e.line, e.col, e.key, e.msg
+		return []errorJSON{d}
+	case violation:
+		d.Key, d.Message = e.path, e.msg
+		return []errorJSON{d}
+	case *json.SyntaxError:
+		if d.File != "" {
+			d.Line, d.Column = position(d.File, e.Offset)
+		}
+	}
+	if m := parseErrorRE.FindStringSubmatch(err.Error()); m != nil {
+		d.Stage, d.File, d.Message = "parse", m[1], m[4]
+		d.Line, _ = strconv.Atoi(m[2])
+		d.Column, _ = strconv.Atoi(m[3])
+		return []errorJSON{d}
+	}
+	if m := yamlLineRE.FindStringSubmatch(err.Error()); m != nil {
+		d.Line, _ = strconv.Atoi(m[1])
+	}
+	// Errors that only add a prefix to one of these, like a job's output
+	// file, are described by what they wrap.
+	if inner := errors.Unwrap(err); inner != nil && structured(inner) {
+		return describe(inner, d)
+	}
+	d.Message = err.Error()
+	return []errorJSON{d}
+}
+
+// structured reports whether err is one that describe knows more about than
+// its message.
+func structured(err error) bool {
+	var list errorList
+	var stage *stageError
+	var exec *execError
+	return errors.As(err, &list) || errors.As(err, &stage) || errors.As(err, &exec)
+}
+
+// position finds the line and column of offset in the file at path, or
+// nothing if it can't be read.
+func position(path string, offset int64) (line, col int) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil || offset > int64(len(data)) {
+		return 0, 0
+	}
+	before := string(data[:offset])
+	line = strings.Count(before, "\n") + 1
+	col = len(before) - strings.LastIndex(before, "\n") - 1
+	return line, col
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// etcdSetting returns how to reach etcd, from the option name or else the
+// same environment variable etcdctl uses.
+func etcdSetting(with settings, name string) string {
+	return with.get(name, os.Getenv("ETCDCTL_"+strings.ToUpper(strings.TrimPrefix(name, "--etcd-"))))
+}
+
+func init() {
+	optionTable = append(optionTable,
+		option{
+			names:    []string{"--etcd"},
+			value:    "PREFIX",
+			usage:    "load the etcd keys under PREFIX, as nested fields split on /",
+			loadWith: loadEtcd,
+		},
+		option{
+			names: []string{"--etcd-endpoints"},
+			value: "URLS",
+			usage: "comma separated etcd URLs to try (default is $ETCDCTL_ENDPOINTS, or http://127.0.0.1:2379)",
+			of:    "--etcd",
+		},
+		option{
+			names: []string{"--etcd-cacert"},
+			value: "FILE",
+			usage: "verify etcd's certificate with the CA in FILE (default is $ETCDCTL_CACERT)",
+			of:    "--etcd",
+		},
+		option{
+			names: []string{"--etcd-cert"},
+			value: "FILE",
+			usage: "identify to etcd with the certificate in FILE (default is $ETCDCTL_CERT)",
+			of:    "--etcd",
+		},
+		option{
+			names: []string{"--etcd-key"},
+			value: "FILE",
+			usage: "the key for --etcd-cert (default is $ETCDCTL_KEY)",
+			of:    "--etcd",
+		},
+		option{
+			names: []string{"--etcd-user"},
+			value: "USER:PASSWORD",
+			usage: "log in to etcd as USER (default is $ETCDCTL_USER)",
+			of:    "--etcd",
+		},
+	)
+}
+
+// loadEtcd reads every key under prefix from etcd, through its JSON gateway.
+// A key like PREFIX/db/host becomes the field db.host.
+func loadEtcd(ctx context.Context, prefix string, with settings, obj interface{}) error {
+	client, err := etcdClient(with)
+	if err != nil {
+		return err
+	}
+	endpoints := strings.Split(etcdSetting(with, "--etcd-endpoints"), ",")
+	if endpoints[0] == "" {
+		endpoints = []string{"http://127.0.0.1:2379"}
+	}
+
+	var errs errorList
+	for _, endpoint := range endpoints {
+		kvs, err := etcdRange(ctx, client, etcdSetting(with, "--etcd-user"), strings.TrimSuffix(strings.TrimSpace(endpoint), "/"), prefix)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for key, value := range kvs {
+			rel := strings.Trim(strings.TrimPrefix(key, prefix), "/")
+			if rel == "" {
+				continue
+			}
+			if err := mount(obj, strings.Split(rel, "/"), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errs
+}
+
+func etcdClient(with settings) (*http.Client, error) {
+	config := &tls.Config{}
+	if cacert := etcdSetting(with, "--etcd-cacert"); cacert != "" {
+		pem, err := ioutil.ReadFile(cacert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", cacert)
+		}
+	}
+	if cert := etcdSetting(with, "--etcd-cert"); cert != "" {
+		cert, err := tls.LoadX509KeyPair(cert, etcdSetting(with, "--etcd-key"))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{
+		Timeout:   options.timeout,
+		Transport: &http.Transport{TLSClientConfig: config, Proxy: http.ProxyFromEnvironment},
+	}, nil
+}
+
+// etcdRange gets every key starting with prefix from the etcd at endpoint,
+// logging in first if user is USER:PASSWORD.
+func etcdRange(ctx context.Context, client *http.Client, user, endpoint, prefix string) (map[string]string, error) {
+	token := ""
+	if user != "" {
+		login := strings.SplitN(user, ":", 2)
+		if len(login) != 2 {
+			return nil, fmt.Errorf("etcd user must be USER:PASSWORD")
+		}
+		var auth struct {
+			Token string `json:"token"`
+		}
+		if err := etcdPost(ctx, client, endpoint+"/v3/auth/authenticate", "", map[string]string{
+			"name":     login[0],
+			"password": login[1],
+		}, &auth); err != nil {
+			return nil, err
+		}
+		token = auth.Token
+	}
+
+	var resp struct {
+		Kvs []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	if err := etcdPost(ctx, client, endpoint+"/v3/kv/range", token, map[string]string{
+		"key":       base64.StdEncoding.EncodeToString([]byte(prefix)),
+		"range_end": base64.StdEncoding.EncodeToString(prefixEnd(prefix)),
+	}, &resp); err != nil {
+		return nil, err
+	}
+	kvs := map[string]string{}
+	for _, kv := range resp.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		kvs[string(key)] = string(value)
+	}
+	return kvs, nil
+}
+
+func etcdPost(ctx context.Context, client *http.Client, u, token string, body, into interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := httpDo(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(into)
+}
+
+// prefixEnd is the first key after all of those starting with prefix, the
+// way etcd likes ranges to be given.
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// Every byte is 0xff, so the range goes to the end of the keys.
+	return []byte{0}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+)
+
+func init() {
+	optionTable = append(optionTable,
+		option{
+			names:    []string{"--exec-data"},
+			value:    "CMD",
+			usage:    "run CMD with the shell and decode what it writes to stdout",
+			loadWith: loadExec,
+		},
+		option{
+			names: []string{"--exec-format"},
+			value: "FORMAT",
+			usage: `decode the --exec-data output as json, rjson, yaml or toml (default is "json")`,
+			of:    "--exec-data",
+			set: func(format string) error {
+				switch format {
+				case "json", "rjson", "yaml", "toml":
+					return nil
+				}
+				return fmt.Errorf("unknown format %q", format)
+			},
+		},
+	)
+}
+
+func loadExec(ctx context.Context, cmd string, with settings, obj interface{}) error {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	out, err := runTool(ctx, shell, flag, cmd)
+	if err != nil {
+		return err
+	}
+	return decode(with.get("--exec-format", "json"), bytes.NewReader(out), obj)
+}
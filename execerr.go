@@ -0,0 +1,103 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// An execError is an error from executing a template, with the action it
+// happened in, where that is in the template, and the data it was about.
+type execError struct {
+	// name, line and col are where the error happened.
+	name      string
+	line, col int
+	// template is the template that was executing, which can be one that
+	// name defines.
+	template string
+	// source is the line of the template, and action the {{...}} in it.
+	source string
+	action string
+	// key is the field or variable being evaluated, if it was one.
+	key string
+	msg string
+	err error
+}
+
+func (e *execError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:%d:%d: executing %q: %s", e.name, e.line, e.col, e.template, e.msg)
+	if e.action != "" {
+		fmt.Fprintf(&b, "\n  in %s", e.action)
+	}
+	if e.key != "" {
+		fmt.Fprintf(&b, "\n  evaluating %s", e.key)
+	}
+	if e.source != "" {
+		prefix := fmt.Sprintf("  %d | ", e.line)
+		fmt.Fprintf(&b, "\n%s%s", prefix, e.source)
+		fmt.Fprintf(&b, "\n%*s| %s^", len(prefix)-2, "", strings.Repeat(" ", e.col))
+	}
+	return b.String()
+}
+
+func (e *execError) Unwrap() error { return e.err }
+
+// execErrorRE matches what text/template says when execution fails.
+var execErrorRE = regexp.MustCompile(`(?s)^template: (.*):(\d+):(\d+): executing "(.*?)" at <(.*?)>: (.*)$`)
+
+// keyRE matches the data a failing node was about, when that was a field or
+// a variable.
+var keyRE = regexp.MustCompile(`^(\$?\w*(?:\.\w+)+)$`)
+
+// explainExec adds the context from text, the template called name, to an
+// error from executing it.
+func explainExec(err error, name, text string) error {
+	if _, ok := err.(template.ExecError); !ok {
+		return err
+	}
+	m := execErrorRE.FindStringSubmatch(err.Error())
+	if m == nil || m[1] != name {
+		return err
+	}
+	e := &execError{name: m[1], template: m[4], msg: m[6], err: err}
+	e.line, _ = strconv.Atoi(m[2])
+	e.col, _ = strconv.Atoi(m[3])
+	if k := keyRE.FindStringSubmatch(m[5]); k != nil {
+		e.key = k[1]
+	}
+
+	lines := strings.Split(text, "\n")
+	if e.line < 1 || e.line > len(lines) || e.col > len(lines[e.line-1]) {
+		return e
+	}
+	e.source = strings.Replace(lines[e.line-1], "\t", " ", -1)
+	offset := e.col
+	for _, l := range lines[:e.line-1] {
+		offset += len(l) + 1
+	}
+	if open := strings.LastIndex(text[:offset], "{{"); open != -1 {
+		if end := strings.Index(text[open:], "}}"); end != -1 && open+end+2 > offset {
+			e.action = text[open : open+end+2]
+		}
+	}
+	return e
+}
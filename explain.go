@@ -0,0 +1,159 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/skelterjohn/tmplcute/keys"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--explain"},
+		value: "KEY",
+		usage: "instead of executing the templates, print the value at KEY and every source that changed it, in order, with the line in a FILE where it can be found; may be repeated",
+		set: func(key string) error {
+			if _, err := keys.ParseKey(key); err != nil {
+				return err
+			}
+			options.explain = append(options.explain, key)
+			return nil
+		},
+	})
+}
+
+// A change is a source changing the value at a KEY.
+type change struct {
+	source string
+	value  interface{}
+	gone   bool
+}
+
+// An explainer watches the --explain KEYs as the sources build the object.
+type explainer struct {
+	last    map[string]interface{}
+	changes map[string][]change
+}
+
+func newExplainer() *explainer {
+	return &explainer{last: map[string]interface{}{}, changes: map[string][]change{}}
+}
+
+// applied notes how src, just applied, changed the KEYs in obj.
+func (e *explainer) applied(src source, obj interface{}) {
+	for _, key := range options.explain {
+		v, err := keys.Lookup(obj, key)
+		if err != nil {
+			v = nil
+		}
+		// A copy, since later sources can change maps and lists in place.
+		v = jsonable(v)
+		if reflect.DeepEqual(v, e.last[key]) {
+			continue
+		}
+		e.last[key] = v
+		e.changes[key] = append(e.changes[key], change{source: describeSource(src.arg, key), value: v, gone: v == nil})
+	}
+}
+
+// report prints what happened to each KEY.
+func (e *explainer) report(w io.Writer) error {
+	for _, key := range options.explain {
+		changes := e.changes[key]
+		if len(changes) == 0 {
+			fmt.Fprintf(w, "%s is not set by any source\n", key)
+			continue
+		}
+		last := changes[len(changes)-1]
+		if last.gone {
+			fmt.Fprintf(w, "%s is not set, since %s took it away\n", key, last.source)
+		} else {
+			fmt.Fprintf(w, "%s = %s, from %s\n", key, compactJSON(last.value), last.source)
+		}
+		for _, c := range changes {
+			if c.gone {
+				fmt.Fprintf(w, "  %s took it away\n", c.source)
+			} else {
+				fmt.Fprintf(w, "  %s set it to %s\n", c.source, compactJSON(c.value))
+			}
+		}
+	}
+	return nil
+}
+
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// describeSource is how the source arg is named in a report about key: with
+// the line key is on, if arg is a FILE where it can be found.
+func describeSource(arg, key string) string {
+	if strings.HasPrefix(arg, "--") || isURL(arg) || isObjectURI(arg) {
+		return arg
+	}
+	file, namespace := splitNamespace(arg)
+	if namespace != "" {
+		if !strings.HasPrefix(key, namespace+".") {
+			return arg
+		}
+		key = key[len(namespace)+1:]
+	}
+	if line := keyLine(file, key); line != 0 {
+		return fmt.Sprintf("%s:%d", arg, line)
+	}
+	return arg
+}
+
+// indexRE matches the indexes in a KEY.
+var indexRE = regexp.MustCompile(`\[\d+\]`)
+
+// keyLine finds the line in the JSON or YAML file at path where key is set,
+// by looking for each of its field names in turn, or returns 0 if it can't.
+// Indexes are passed over, so the line is a guess for keys into lists.
+func keyLine(path, key string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	lines := strings.Split(string(data), "\n")
+	at := -1
+	for _, name := range strings.Split(indexRE.ReplaceAllString(key, ""), ".") {
+		re := regexp.MustCompile(`(^|[\s{,-])["']?` + regexp.QuoteMeta(name) + `["']?\s*:`)
+		found := false
+		for i := at + 1; i < len(lines); i++ {
+			if re.MatchString(lines[i]) {
+				at, found = i, true
+				break
+			}
+		}
+		if !found {
+			return 0
+		}
+	}
+	return at + 1
+}
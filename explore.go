@@ -0,0 +1,207 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var exploreUsage = `Usage: tmplcute explore [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+
+explore builds the object from its arguments the same way tmplcute does, and
+shows it a level at a time, to find the KEYs to use in templates and in
+--KEY=VALUE. Each line is numbered, and what is typed after it does:
+
+  N      expand or collapse line N
+  c N    copy the KEY of line N, printing it, and putting it on the
+         clipboard of terminals that allow it
+  e      expand everything
+  x      collapse everything
+  q      quit
+`
+
+func explore(args []string) {
+	for _, arg := range args {
+		if arg == "-h" {
+			fmt.Fprintln(os.Stderr, exploreUsage)
+			os.Exit(2)
+		}
+	}
+	obj := map[string]interface{}{}
+	for _, src := range sources(args) {
+		src.apply(&obj)
+	}
+	b := &browser{root: jsonable(obj), open: map[string]bool{}, clipboard: isTerminal(os.Stdout)}
+	orExit(b.run(os.Stdin, os.Stdout))
+}
+
+// A browser shows an object with some of its maps and lists opened up.
+type browser struct {
+	root interface{}
+	// open are the KEYs of what is expanded. The top always is.
+	open map[string]bool
+	// clipboard is whether copied KEYs also go to the terminal's clipboard.
+	clipboard bool
+}
+
+// A browserLine is one field or element shown.
+type browserLine struct {
+	key   string
+	depth int
+	label string
+	value interface{}
+}
+
+// lines are what is shown, in order.
+func (b *browser) lines() []browserLine {
+	var lines []browserLine
+	var walk func(key string, depth int, v interface{})
+	add := func(key, label string, depth int, v interface{}) {
+		lines = append(lines, browserLine{key, depth, label, v})
+		if b.open[key] {
+			walk(key, depth+1, v)
+		}
+	}
+	walk = func(key string, depth int, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			names := make([]string, 0, len(v))
+			for name := range v {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				add(fieldPath(key, name), name, depth, v[name])
+			}
+		case []interface{}:
+			for i, elem := range v {
+				add(indexPath(key, i), fmt.Sprintf("[%d]", i), depth, elem)
+			}
+		}
+	}
+	walk("", 0, b.root)
+	return lines
+}
+
+// print shows the lines, numbered from 1.
+func (b *browser) print(w io.Writer, lines []browserLine) {
+	width := len(strconv.Itoa(len(lines)))
+	for i, l := range lines {
+		var summary string
+		switch v := l.value.(type) {
+		case map[string]interface{}:
+			summary = fmt.Sprintf("{%d}", len(v))
+		case []interface{}:
+			summary = fmt.Sprintf("[%d]", len(v))
+		default:
+			summary = compact(v)
+		}
+		mark := " "
+		if isContainer(l.value) {
+			mark = "+"
+			if b.open[l.key] {
+				mark = "-"
+			}
+		}
+		fmt.Fprintf(w, "%*d %s%s %s: %s\n", width, i+1, strings.Repeat("  ", l.depth), mark, l.label, summary)
+	}
+}
+
+func isContainer(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
+
+// run shows the object, and then does what each line of in says, until it
+// ends or says q.
+func (b *browser) run(in io.Reader, out io.Writer) error {
+	lines := b.lines()
+	b.print(out, lines)
+	scanner := bufio.NewScanner(in)
+	for fmt.Fprint(out, "> "); scanner.Scan(); fmt.Fprint(out, "> ") {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		line := func(s string) (browserLine, bool) {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > len(lines) {
+				fmt.Fprintf(out, "there is no line %s\n", s)
+				return browserLine{}, false
+			}
+			return lines[n-1], true
+		}
+		switch {
+		case fields[0] == "q":
+			return nil
+		case fields[0] == "e":
+			b.expandAll("", b.root)
+		case fields[0] == "x":
+			b.open = map[string]bool{}
+		case fields[0] == "c" && len(fields) == 2:
+			l, ok := line(fields[1])
+			if !ok {
+				continue
+			}
+			if b.clipboard {
+				// OSC 52 asks the terminal to put the text on the clipboard.
+				fmt.Fprintf(out, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(l.key)))
+			}
+			fmt.Fprintln(out, l.key)
+			continue
+		default:
+			l, ok := line(fields[0])
+			if !ok {
+				continue
+			}
+			if !isContainer(l.value) {
+				fmt.Fprintf(out, "%s is %s\n", l.key, compact(l.value))
+				continue
+			}
+			b.open[l.key] = !b.open[l.key]
+		}
+		lines = b.lines()
+		b.print(out, lines)
+	}
+	return scanner.Err()
+}
+
+// expandAll opens v, at key, and everything in it.
+func (b *browser) expandAll(key string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		b.open[key] = true
+		for name, child := range v {
+			b.expandAll(fieldPath(key, name), child)
+		}
+	case []interface{}:
+		b.open[key] = true
+		for i, child := range v {
+			b.expandAll(indexPath(key, i), child)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// extendedFuncs are the functions --funcs=extended adds, for strings,
+// numbers, defaults and collections. They are left out otherwise, so that
+// they can't change what existing templates mean.
+var extendedFuncs = []tmplFunc{
+	{"upper", strings.ToUpper, "the string in upper case"},
+	{"lower", strings.ToLower, "the string in lower case"},
+	{"title", title, "the string with each word capitalized"},
+	{"trim", strings.TrimSpace, "the string without the space around it"},
+	{"trimPrefix", trimPrefix, "the string S without PREFIX at its start"},
+	{"trimSuffix", trimSuffix, "the string S without SUFFIX at its end"},
+	{"replace", replace, "the string S with every OLD replaced by NEW"},
+	{"contains", contains, "whether the string S contains SUBSTR"},
+	{"hasPrefix", hasPrefix, "whether the string S starts with PREFIX"},
+	{"hasSuffix", hasSuffix, "whether the string S ends with SUFFIX"},
+	{"split", split, "the list of the parts of S between each SEP"},
+	{"join", join, "the elements of LIST, printed, with SEP between them"},
+	{"repeat", repeat, "the string S N times over"},
+	{"quote", quote, "the value printed as a double-quoted Go string"},
+	{"indent", indentBy, "the string S with N spaces before each line"},
+	{"nindent", nindent, "indent, after a newline, for {{nindent 4 (yaml .x)}} on a line of its own"},
+	{"default", defaultValue, "the value, or DEFAULT if it is missing or empty, as in {{.port | default 80}}"},
+	{"empty", empty, "whether the value is missing, false, 0, or an empty string, list or map"},
+	{"coalesce", coalesce, "the first of the values that isn't empty"},
+	{"ternary", ternary, "A if COND is true, and B if not, as in {{ternary \"on\" \"off\" .enabled}}"},
+	{"add", add, "A plus B"},
+	{"sub", sub, "A minus B"},
+	{"mul", mul, "A times B"},
+	{"div", div, "A divided by B; for whole numbers, rounded down"},
+	{"mod", mod, "the remainder of dividing the whole numbers A by B"},
+	{"max", maxOf, "the largest of the numbers"},
+	{"min", minOf, "the smallest of the numbers"},
+	{"list", list, "a list of the values"},
+	{"dict", dict, "a map of each KEY to the VALUE after it"},
+	{"keys", mapKeys, "the keys of the map, sorted"},
+	{"hasKey", hasKey, "whether the map has KEY"},
+	{"has", listHas, "whether LIST has NEEDLE in it, as in {{if has \"admin\" .roles}}"},
+	{"first", first, "the first element of the list, or nil if it is empty"},
+	{"last", last, "the last element of the list, or nil if it is empty"},
+	{"rest", rest, "the list without its first element"},
+	{"initial", initial, "the list without its last element"},
+	{"reverse", reverse, "the list in reverse order"},
+	{"uniq", uniq, "the list without repeated elements"},
+	{"sortAlpha", sortAlpha, "the elements of the list, printed, in sorted order"},
+}
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--funcs"},
+		value: "SET",
+		usage: `"extended" to add functions for strings, numbers, defaults and collections, like upper, default, add and keys; see tmplcute funcs`,
+		set: func(set string) error {
+			switch set {
+			case "default":
+				options.extendedFuncs = false
+			case "extended":
+				options.extendedFuncs = true
+			default:
+				return fmt.Errorf(`the function sets are "default" and "extended", not %q`, set)
+			}
+			return nil
+		},
+	})
+}
+
+// allFuncs is every tmplFunc, with the extended ones saying so.
+func allFuncs() []tmplFunc {
+	all := append([]tmplFunc(nil), tmplFuncs...)
+	for _, f := range extendedFuncs {
+		f.usage += " (with --funcs=extended)"
+		all = append(all, f)
+	}
+	return all
+}
+
+// title capitalizes the first letter of each word of s, the words being
+// what is between spaces, so that "o'neil's café" becomes "O'neil's Café".
+func title(s string) string {
+	start := true
+	return strings.Map(func(r rune) rune {
+		first := start
+		start = unicode.IsSpace(r)
+		if first {
+			return unicode.ToTitle(r)
+		}
+		return r
+	}, s)
+}
+
+// The arguments come in the order that reads well in a pipeline, with the
+// string being worked on last, as in {{.name | trimPrefix "www."}}.
+
+func trimPrefix(prefix, s string) string { return strings.TrimPrefix(s, prefix) }
+func trimSuffix(suffix, s string) string { return strings.TrimSuffix(s, suffix) }
+func replace(old, new, s string) string  { return strings.Replace(s, old, new, -1) }
+func contains(substr, s string) bool     { return strings.Contains(s, substr) }
+func hasPrefix(prefix, s string) bool    { return strings.HasPrefix(s, prefix) }
+func hasSuffix(suffix, s string) bool    { return strings.HasSuffix(s, suffix) }
+func repeat(n int, s string) string      { return strings.Repeat(s, n) }
+func quote(v interface{}) string         { return fmt.Sprintf("%q", fmt.Sprint(v)) }
+func nindent(n int, s string) string     { return "\n" + indentBy(n, s) }
+func ternary(a, b interface{}, cond bool) interface{} {
+	if cond {
+		return a
+	}
+	return b
+}
+
+func split(sep, s string) []interface{} {
+	var parts []interface{}
+	for _, p := range strings.Split(s, sep) {
+		parts = append(parts, p)
+	}
+	return parts
+}
+
+func join(sep string, list interface{}) (string, error) {
+	elems, err := toList(list)
+	if err != nil {
+		return "", err
+	}
+	strs := make([]string, len(elems))
+	for i, e := range elems {
+		strs[i] = fmt.Sprint(e)
+	}
+	return strings.Join(strs, sep), nil
+}
+
+func indentBy(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+func defaultValue(deflt interface{}, v ...interface{}) interface{} {
+	if len(v) == 0 || empty(v[0]) {
+		return deflt
+	}
+	return v[0]
+}
+
+func empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+func coalesce(vs ...interface{}) interface{} {
+	for _, v := range vs {
+		if !empty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// toNumber makes v, any kind of number or a string holding one, a float64.
+func toNumber(v interface{}) (float64, error) {
+	if f, ok := number(v); ok {
+		return f, nil
+	}
+	if s, ok := v.(string); ok {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// arith applies op to a and b as numbers. If both are whole, so is the
+// result, which can then be an index.
+func arith(a, b interface{}, op func(x, y float64) float64) (interface{}, error) {
+	x, err := toNumber(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := toNumber(b)
+	if err != nil {
+		return nil, err
+	}
+	return arithResult(op(x, y), x == math.Trunc(x) && y == math.Trunc(y)), nil
+}
+
+// arithResult is f as an int if whole is set and it fits, and as itself if
+// not.
+func arithResult(f float64, whole bool) interface{} {
+	if whole && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int(f)
+	}
+	return f
+}
+
+func add(a, b interface{}) (interface{}, error) {
+	return arith(a, b, func(x, y float64) float64 { return x + y })
+}
+
+func sub(a, b interface{}) (interface{}, error) {
+	return arith(a, b, func(x, y float64) float64 { return x - y })
+}
+
+func mul(a, b interface{}) (interface{}, error) {
+	return arith(a, b, func(x, y float64) float64 { return x * y })
+}
+
+func div(a, b interface{}) (interface{}, error) {
+	if y, err := toNumber(b); err == nil && y == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	x, _ := toNumber(a)
+	y, _ := toNumber(b)
+	if x == math.Trunc(x) && y == math.Trunc(y) {
+		return arith(a, b, func(x, y float64) float64 { return math.Floor(x / y) })
+	}
+	return arith(a, b, func(x, y float64) float64 { return x / y })
+}
+
+func mod(a, b interface{}) (interface{}, error) {
+	if y, err := toNumber(b); err == nil && y == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	return arith(a, b, math.Mod)
+}
+
+// extreme is the one of nums that better likes more than all the rest.
+func extreme(nums []interface{}, better func(x, y float64) bool) (interface{}, error) {
+	if len(nums) == 0 {
+		return nil, fmt.Errorf("no numbers to choose from")
+	}
+	best, whole := 0.0, true
+	for i, n := range nums {
+		f, err := toNumber(n)
+		if err != nil {
+			return nil, err
+		}
+		whole = whole && f == math.Trunc(f)
+		if i == 0 || better(f, best) {
+			best = f
+		}
+	}
+	return arithResult(best, whole), nil
+}
+
+func maxOf(nums ...interface{}) (interface{}, error) {
+	return extreme(nums, func(x, y float64) bool { return x > y })
+}
+
+func minOf(nums ...interface{}) (interface{}, error) {
+	return extreme(nums, func(x, y float64) bool { return x < y })
+}
+
+func list(vs ...interface{}) []interface{} {
+	return append([]interface{}{}, vs...)
+}
+
+func dict(kvs ...interface{}) (map[string]interface{}, error) {
+	if len(kvs)%2 != 0 {
+		return nil, fmt.Errorf("dict needs a VALUE after each KEY")
+	}
+	m := map[string]interface{}{}
+	for i := 0; i < len(kvs); i += 2 {
+		m[fmt.Sprint(kvs[i])] = kvs[i+1]
+	}
+	return m, nil
+}
+
+// toList makes v, a slice or array of anything, a []interface{}. nil is
+// an empty list.
+func toList(v interface{}) ([]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if l, ok := v.([]interface{}); ok {
+		return l, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%T is not a list", v)
+	}
+	l := make([]interface{}, rv.Len())
+	for i := range l {
+		l[i] = rv.Index(i).Interface()
+	}
+	return l, nil
+}
+
+func mapKeys(m interface{}) ([]string, error) {
+	rv := reflect.ValueOf(m)
+	if rv.Kind() != reflect.Map {
+		return nil, fmt.Errorf("%T is not a map", m)
+	}
+	ks := make([]string, 0, rv.Len())
+	for _, k := range rv.MapKeys() {
+		ks = append(ks, fmt.Sprint(k.Interface()))
+	}
+	sort.Strings(ks)
+	return ks, nil
+}
+
+func hasKey(m interface{}, key string) (bool, error) {
+	ks, err := mapKeys(m)
+	if err != nil {
+		return false, err
+	}
+	i := sort.SearchStrings(ks, key)
+	return i < len(ks) && ks[i] == key, nil
+}
+
+func listHas(needle, l interface{}) (bool, error) {
+	elems, err := toList(l)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range elems {
+		if reflect.DeepEqual(e, needle) || fmt.Sprint(e) == fmt.Sprint(needle) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func first(l interface{}) (interface{}, error) {
+	elems, err := toList(l)
+	if err != nil || len(elems) == 0 {
+		return nil, err
+	}
+	return elems[0], nil
+}
+
+func last(l interface{}) (interface{}, error) {
+	elems, err := toList(l)
+	if err != nil || len(elems) == 0 {
+		return nil, err
+	}
+	return elems[len(elems)-1], nil
+}
+
+func rest(l interface{}) ([]interface{}, error) {
+	elems, err := toList(l)
+	if err != nil || len(elems) == 0 {
+		return nil, err
+	}
+	return elems[1:], nil
+}
+
+func initial(l interface{}) ([]interface{}, error) {
+	elems, err := toList(l)
+	if err != nil || len(elems) == 0 {
+		return nil, err
+	}
+	return elems[:len(elems)-1], nil
+}
+
+func reverse(l interface{}) ([]interface{}, error) {
+	elems, err := toList(l)
+	if err != nil {
+		return nil, err
+	}
+	rev := make([]interface{}, len(elems))
+	for i, e := range elems {
+		rev[len(elems)-1-i] = e
+	}
+	return rev, nil
+}
+
+func uniq(l interface{}) ([]interface{}, error) {
+	elems, err := toList(l)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, e := range elems {
+		seen := false
+		for _, o := range out {
+			if reflect.DeepEqual(e, o) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func sortAlpha(l interface{}) ([]string, error) {
+	elems, err := toList(l)
+	if err != nil {
+		return nil, err
+	}
+	strs := make([]string, len(elems))
+	for i, e := range elems {
+		strs[i] = fmt.Sprint(e)
+	}
+	sort.Strings(strs)
+	return strs, nil
+}
+
+var undefinedFunc = regexp.MustCompile(`function "([^"]+)" not defined`)
+
+// extendedHint adds to a parse error saying a function isn't defined that
+// --funcs=extended would define it.
+func extendedHint(err error) error {
+	m := undefinedFunc.FindStringSubmatch(err.Error())
+	if m == nil || options.extendedFuncs {
+		return err
+	}
+	for _, f := range extendedFuncs {
+		if f.name == m[1] {
+			return fmt.Errorf("%w (it is one of --funcs=extended)", err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--facts"},
+		usage: "load facts about this machine under Sys: Hostname, OS, Arch, CPUs, Memory (bytes), IP, IPs and User",
+		load:  loadFacts,
+		mounts: func(string, settings) []string {
+			return []string{"Sys"}
+		},
+	})
+}
+
+func loadFacts(ctx context.Context, _ string, obj interface{}) error {
+	facts := map[string]interface{}{
+		"OS":   runtime.GOOS,
+		"Arch": runtime.GOARCH,
+		"CPUs": runtime.NumCPU(),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		facts["Hostname"] = hostname
+	}
+	if mem, ok := memory(); ok {
+		facts["Memory"] = mem
+	}
+	if ip := primaryIP(); ip != "" {
+		facts["IP"] = ip
+	}
+	ips := []interface{}{}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && !ipnet.IP.IsLinkLocalUnicast() {
+				ips = append(ips, ipnet.IP.String())
+			}
+		}
+	}
+	facts["IPs"] = ips
+	if u, err := user.Current(); err == nil {
+		facts["User"] = map[string]interface{}{
+			"Name": u.Username,
+			"Uid":  u.Uid,
+			"Gid":  u.Gid,
+			"Home": u.HomeDir,
+		}
+	}
+	return mount(obj, []string{"Sys"}, facts)
+}
+
+// primaryIP is the address that traffic to the internet would leave from.
+// Nothing is actually sent.
+func primaryIP() string {
+	conn, err := net.Dial("udp", "8.8.8.8:53")
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+// memory is the total memory, in bytes. It is only known on linux.
+func memory() (int64, bool) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			return kb * 1024, err == nil
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"reflect"
+
+	"github.com/skelterjohn/tmplcute/keys"
+)
+
+func init() {
+	tmplFuncs = append(tmplFuncs, tmplFunc{"field", field,
+		`the field NAME of a map, or of a struct by its name or json or yaml tag, or nil if there is none, so that {{field . "port"}} works on either`})
+}
+
+func field(obj interface{}, name string) interface{} {
+	f, ok := keys.Field(reflect.ValueOf(obj), name)
+	if !ok || !f.CanInterface() {
+		return nil
+	}
+	return f.Interface()
+}
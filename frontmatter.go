@@ -0,0 +1,138 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// frontMatter is what a template says about its output, in lines of
+// "KEY: VALUE" between two "---" lines at its very start, like
+//
+//	---
+//	output: hosts/{{.name}}.conf
+//	mode: 0600
+//	skip: {{not .enabled}}
+//	---
+//
+// Each VALUE is a template too, executed with the object.
+type frontMatter map[string]string
+
+// frontMatterKeys are what front matter can say, described.
+var frontMatterKeys = map[string]string{
+	"output": "the file to write to, instead of the --render OUTPUT, or under DST_DIR with -r",
+	"mode":   "the permissions of the file written, in octal",
+	"skip":   "true to write nothing at all",
+}
+
+// splitFrontMatter takes the front matter, if there is any, off the start
+// of text. What it leaves in the front matter's place is a comment spanning
+// as many lines, so the rest of the template keeps its line numbers. Only a
+// block whose every line is an output, mode or skip is front matter, so a
+// template that starts with something else between "---" lines, like a YAML
+// document, is left as it is.
+func splitFrontMatter(text string) (frontMatter, string) {
+	if !strings.HasPrefix(text, "---\n") && !strings.HasPrefix(text, "---\r\n") {
+		return nil, text
+	}
+	lines := strings.SplitAfter(text, "\n")
+	fm := frontMatter{}
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "---" {
+			if len(fm) == 0 {
+				return nil, text
+			}
+			body := strings.Join(lines[i+1:], "")
+			return fm, "{{/*" + strings.Repeat("\n", i+1) + "*/}}" + body
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon == -1 {
+			return nil, text
+		}
+		key := strings.TrimSpace(line[:colon])
+		if _, ok := frontMatterKeys[key]; !ok {
+			return nil, text
+		}
+		fm[key] = strings.TrimSpace(line[colon+1:])
+	}
+	return nil, text
+}
+
+// An outputSpec is what the front matter says, with its templates executed.
+type outputSpec struct {
+	output string
+	// mode is 0 to leave the file's permissions alone.
+	mode os.FileMode
+	skip bool
+}
+
+// resolve executes the front matter of the template called name with obj.
+func (fm frontMatter) resolve(name string, obj interface{}) (outputSpec, error) {
+	var spec outputSpec
+	value := func(key string) (string, error) {
+		text, ok := fm[key]
+		if !ok {
+			return "", nil
+		}
+		tmpl, err := template.New(name + " " + key).Funcs(funcMap()).Parse(text)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, obj); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(buf.String()), nil
+	}
+
+	skip, err := value("skip")
+	if err != nil {
+		return spec, err
+	}
+	if skip != "" {
+		if spec.skip, err = strconv.ParseBool(skip); err != nil {
+			return spec, fmt.Errorf("%s: skip is %q, not true or false", name, skip)
+		}
+		if spec.skip {
+			return spec, nil
+		}
+	}
+	if spec.output, err = value("output"); err != nil {
+		return spec, err
+	}
+	mode, err := value("mode")
+	if err != nil {
+		return spec, err
+	}
+	if mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return spec, fmt.Errorf("%s: mode is %q, not octal permissions like 0644", name, mode)
+		}
+		spec.mode = os.FileMode(m)
+	}
+	return spec, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		text string
+		fm   frontMatter
+		body string
+	}{
+		{
+			text: "---\noutput: a.conf\nmode: 0600\n---\nbody\n",
+			fm:   frontMatter{"output": "a.conf", "mode": "0600"},
+			body: "{{/*\n\n\n\n*/}}body\n",
+		},
+		{
+			text: "---\r\n# where\r\nskip: {{not .on}}\r\n---\r\nbody",
+			fm:   frontMatter{"skip": "{{not .on}}"},
+			body: "{{/*\n\n\n\n*/}}body",
+		},
+		// YAML documents are left alone.
+		{text: "---\napiVersion: v1\nkind: Pod\n---\nkind: Service\n"},
+		{text: "---\noutput: a.conf\nkind: Pod\n---\n"},
+		{text: "---\n- output: a.conf\n---\n"},
+		{text: "---\n---\nbody\n"},
+		{text: "---\noutput: a.conf\n"},
+		{text: "body\n---\noutput: a.conf\n---\n"},
+	}
+	for _, test := range tests {
+		fm, body := splitFrontMatter(test.text)
+		want := test.body
+		if test.fm == nil {
+			want = test.text
+		}
+		if !reflect.DeepEqual(fm, test.fm) || body != want {
+			t.Errorf("splitFrontMatter(%q) = %v, %q; want %v, %q", test.text, fm, body, test.fm, want)
+		}
+	}
+}
+
+func TestResolveFrontMatter(t *testing.T) {
+	obj := map[string]interface{}{"name": "web", "on": false}
+	spec, err := frontMatter{"output": "hosts/{{.name}}.conf", "mode": "0600"}.resolve("t", obj)
+	if err != nil || spec.output != "hosts/web.conf" || spec.mode != 0600 || spec.skip {
+		t.Errorf("resolve = %+v, %v", spec, err)
+	}
+	spec, err = frontMatter{"skip": "{{not .on}}", "mode": "bad"}.resolve("t", obj)
+	if err != nil || !spec.skip {
+		t.Errorf("resolve with skip = %+v, %v", spec, err)
+	}
+	if _, err := (frontMatter{"mode": "rw"}).resolve("t", obj); err == nil {
+		t.Error("resolve with a bad mode succeeded")
+	}
+}
+
+func TestUnderDir(t *testing.T) {
+	dir := filepath.Join("out", "site")
+	tests := []struct {
+		output, want string
+	}{
+		{"a.html", filepath.Join(dir, "a.html")},
+		{"sub/../b.html", filepath.Join(dir, "b.html")},
+		{"..x/c.html", filepath.Join(dir, "..x", "c.html")},
+		{"../x", ""},
+		{"../../etc/passwd", ""},
+		{"sub/../../x", ""},
+	}
+	for _, test := range tests {
+		got, err := underDir(dir, test.output)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("underDir(%q, %q) = %q, want an error", dir, test.output, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("underDir(%q, %q) = %q, %v; want %q", dir, test.output, got, err, test.want)
+		}
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		if _, err := underDir(abs, "/etc/passwd"); err == nil {
+			t.Error("underDir let an absolute output leave the directory")
+		}
+		if got, err := underDir(abs, filepath.Join(abs, "d.html")); err != nil || got != filepath.Join(abs, "d.html") {
+			t.Errorf("underDir with an absolute output inside = %q, %v", got, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"reflect"
+	"strings"
+)
+
+// A tmplFunc is a function made available to templates, along with the one
+// line of documentation shown for it in the man page.
+type tmplFunc struct {
+	name  string
+	fn    interface{}
+	usage string
+}
+
+var tmplFuncs = []tmplFunc{
+	{"json", formatJson, "format the value as indented json"},
+	{"rjson", formatRjson, "format the value as indented rjson"},
+	{"yaml", formatYaml, "format the value as yaml"},
+	{"toml", formatToml, "format the value, a map, as toml"},
+	{"now", now, "the current time in the --tz zone"},
+	{"date", formatDate, "format a time, RFC 3339 string or unix seconds with a Go layout, in the --tz zone"},
+	{"number", formatNumber, "format a number, optionally with a number of decimals first, for the --locale"},
+	{"randInt", randInt, "a random int from min up to but not including max"},
+	{"randAlphaNum", randAlphaNum, "a random string of n letters and digits"},
+	{"uuid", uuid, "a random version 4 UUID"},
+	{"required", required, "the value, or an error naming KEY if it is missing or empty (with --prompt, ask for it)"},
+}
+
+// funcMap is every tmplFunc, ready to be given to Funcs, less what isn't
+// allowed.
+func funcMap() map[string]interface{} {
+	m := map[string]interface{}{}
+	for _, f := range tmplFuncs {
+		m[f.name] = f.fn
+	}
+	if options.extendedFuncs {
+		for _, f := range extendedFuncs {
+			m[f.name] = f.fn
+		}
+	}
+	gate(context.Background(), m)
+	return m
+}
+
+// signature is how f is called, like "json(interface {}) (string, error)".
+func (f tmplFunc) signature() string {
+	return f.name + strings.TrimPrefix(reflect.TypeOf(f.fn).String(), "func")
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var genstructUsage = `Usage: tmplcute genstruct [--package=NAME] [--type=NAME] [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+
+genstruct builds the object from its arguments the same way tmplcute does,
+and prints Go source for a struct that can hold it, named by --type
+(default is "Config") in the package named by --package (default is "main").
+Objects become structs of their own, named after their fields, and lists
+take the type that fits every element. A field that is only ever null, or
+holds things of different types, is an interface{}. The fields are tagged
+with their names for encoding/json and yaml, which the keys package also
+uses, so the struct is ready for decoding the FILEs and for --KEY=VALUE.
+`
+
+func genstruct(args []string) {
+	pkg, name := "main", "Config"
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-h":
+			fmt.Fprintln(os.Stderr, genstructUsage)
+			os.Exit(2)
+		case strings.HasPrefix(arg, "--package="):
+			pkg = strings.TrimPrefix(arg, "--package=")
+		case strings.HasPrefix(arg, "--type="):
+			name = strings.TrimPrefix(arg, "--type=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	obj := map[string]interface{}{}
+	for _, src := range sources(rest) {
+		src.apply(&obj)
+	}
+	src, err := structSource(pkg, name, inferType(jsonable(obj)))
+	orExit(err)
+	os.Stdout.Write(src)
+}
+
+// A goType is the Go type inferred for a value, and for everything else
+// seen in the same place.
+type goType struct {
+	kind   goKind
+	fields map[string]*goType
+	elem   *goType
+}
+
+type goKind int
+
+const (
+	// kindNull is for nulls, which say nothing about the type.
+	kindNull goKind = iota
+	kindBool
+	kindInt
+	kindFloat
+	kindString
+	kindStruct
+	kindList
+	kindAny
+)
+
+func inferType(v interface{}) *goType {
+	switch v := v.(type) {
+	case nil:
+		return &goType{kind: kindNull}
+	case bool:
+		return &goType{kind: kindBool}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return &goType{kind: kindInt}
+		}
+		return &goType{kind: kindFloat}
+	case string:
+		return &goType{kind: kindString}
+	case map[string]interface{}:
+		t := &goType{kind: kindStruct, fields: map[string]*goType{}}
+		for name, field := range v {
+			t.fields[name] = inferType(field)
+		}
+		return t
+	case []interface{}:
+		t := &goType{kind: kindList, elem: &goType{kind: kindNull}}
+		for _, elem := range v {
+			t.elem = mergeTypes(t.elem, inferType(elem))
+		}
+		return t
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// As YAML decodes whole numbers.
+		return &goType{kind: kindInt}
+	case reflect.Float32:
+		return &goType{kind: kindFloat}
+	}
+	return &goType{kind: kindAny}
+}
+
+// mergeTypes returns the type that fits what both a and b do. Structs get
+// every field either has, and whole numbers become fractional if need be.
+func mergeTypes(a, b *goType) *goType {
+	switch {
+	case a.kind == kindNull:
+		return b
+	case b.kind == kindNull:
+		return a
+	case a.kind == kindStruct && b.kind == kindStruct:
+		t := &goType{kind: kindStruct, fields: map[string]*goType{}}
+		for name, field := range a.fields {
+			t.fields[name] = field
+		}
+		for name, field := range b.fields {
+			if old, ok := t.fields[name]; ok {
+				field = mergeTypes(old, field)
+			}
+			t.fields[name] = field
+		}
+		return t
+	case a.kind == kindList && b.kind == kindList:
+		return &goType{kind: kindList, elem: mergeTypes(a.elem, b.elem)}
+	case a.kind == kindInt && b.kind == kindFloat, a.kind == kindFloat && b.kind == kindInt:
+		return &goType{kind: kindFloat}
+	case a.kind == b.kind:
+		return a
+	}
+	return &goType{kind: kindAny}
+}
+
+// A structWriter writes out the struct types for a goType, each nested one
+// named after where it was found.
+type structWriter struct {
+	buf   bytes.Buffer
+	names map[string]bool
+}
+
+// structSource returns gofmt'd source for package pkg, declaring t as the
+// struct called name and the structs inside it.
+func structSource(pkg, name string, t *goType) ([]byte, error) {
+	w := &structWriter{names: map[string]bool{}}
+	fmt.Fprintf(&w.buf, "package %s\n", pkg)
+	w.declare(name, t)
+	src, err := format.Source(w.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generating the struct: %v", err)
+	}
+	return src, nil
+}
+
+// declare writes the struct type t, called name, and then the nested ones
+// its fields use.
+func (w *structWriter) declare(name string, t *goType) {
+	w.names[name] = true
+	names := make([]string, 0, len(t.fields))
+	for field := range t.fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	type nested struct {
+		name string
+		t    *goType
+	}
+	var later []nested
+	var body bytes.Buffer
+	for _, field := range names {
+		ident := goIdent(field)
+		ft := t.fields[field]
+		typ := w.typeName(ft, name, ident, func(n string, st *goType) {
+			later = append(later, nested{n, st})
+		})
+		fmt.Fprintf(&body, "\t%s %s `json:%q yaml:%q`\n", ident, typ, field, field)
+	}
+	fmt.Fprintf(&w.buf, "\ntype %s struct {\n%s}\n", name, body.String())
+	for _, n := range later {
+		w.declare(n.name, n.t)
+	}
+}
+
+// typeName returns the Go type for t, a field called ident in the struct
+// parent. Any struct it needs is named and passed to nest to be declared.
+func (w *structWriter) typeName(t *goType, parent, ident string, nest func(string, *goType)) string {
+	switch t.kind {
+	case kindBool:
+		return "bool"
+	case kindInt:
+		return "int"
+	case kindFloat:
+		return "float64"
+	case kindString:
+		return "string"
+	case kindList:
+		return "[]" + w.typeName(t.elem, parent, singular(ident), nest)
+	case kindStruct:
+		name := w.newName(parent, ident)
+		nest(name, t)
+		return name
+	}
+	return "interface{}"
+}
+
+// newName returns a type name for a struct found at ident, prefixed with its
+// parent's name if ident is already taken.
+func (w *structWriter) newName(parent, ident string) string {
+	name := ident
+	if w.names[name] {
+		name = parent + ident
+	}
+	for i := 2; w.names[name]; i++ {
+		name = fmt.Sprintf("%s%s%d", parent, ident, i)
+	}
+	w.names[name] = true
+	return name
+}
+
+// initialisms are written in capitals in Go identifiers, like ID and URL.
+var initialisms = map[string]bool{
+	"api": true, "cpu": true, "db": true, "dns": true, "html": true, "http": true,
+	"https": true, "id": true, "ip": true, "json": true, "sql": true,
+	"ssh": true, "tcp": true, "tls": true, "ttl": true, "udp": true,
+	"uri": true, "url": true, "uuid": true, "yaml": true,
+}
+
+// goIdent turns a field name like "max_retries" or "base-url" into an
+// exported Go identifier, like MaxRetries or BaseURL.
+func goIdent(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, word := range words {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		r := []rune(word)
+		b.WriteString(strings.ToUpper(string(r[0])) + string(r[1:]))
+	}
+	ident := b.String()
+	if ident == "" || !unicode.IsLetter([]rune(ident)[0]) {
+		ident = "X" + ident
+	}
+	return ident
+}
+
+// singular guesses the name of one element of a list called ident, for the
+// struct type of its elements.
+func singular(ident string) string {
+	switch {
+	case strings.HasSuffix(ident, "ies") && len(ident) > 3:
+		return ident[:len(ident)-3] + "y"
+	case strings.HasSuffix(ident, "ss"):
+		return ident + "Item"
+	case strings.HasSuffix(ident, "s") && len(ident) > 1:
+		return ident[:len(ident)-1]
+	}
+	return ident + "Item"
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skelterjohn/tmplcute/keys"
+)
+
+var getUsage = `Usage: tmplcute get [-json] KEY [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+
+get builds the object from its arguments the same way tmplcute does, and
+prints the value at KEY. Strings, numbers and bools are printed as they are,
+and anything else is printed as json. The "-json" flag prints json always.
+`
+
+func get(args []string) {
+	asJson := false
+	rest := []string{}
+	for _, arg := range args {
+		switch arg {
+		case "-h":
+			fmt.Fprintln(os.Stderr, getUsage)
+			os.Exit(2)
+		case "-json":
+			asJson = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) == 0 {
+		fmt.Fprintln(os.Stderr, getUsage)
+		os.Exit(2)
+	}
+
+	obj := map[string]interface{}{}
+	for _, src := range sources(rest[1:]) {
+		src.apply(&obj)
+	}
+
+	val, err := keys.Lookup(obj, rest[0])
+	orExit(err)
+	if !asJson {
+		switch val.(type) {
+		case string, bool, int, int64, uint64, float64:
+			fmt.Println(val)
+			return
+		}
+	}
+	out, err := formatJson(jsonable(val))
+	orExit(err)
+	fmt.Print(out)
+}
+
+// jsonable converts the map[interface{}]interface{} values that yaml
+// produces into map[string]interface{}, so they can be encoded as json.
+func jsonable(obj interface{}) interface{} {
+	switch obj := obj.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range obj {
+			m[fmt.Sprint(k)] = jsonable(v)
+		}
+		return m
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range obj {
+			m[k] = jsonable(v)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(obj))
+		for i, v := range obj {
+			s[i] = jsonable(v)
+		}
+		return s
+	}
+	return obj
+}
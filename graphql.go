@@ -0,0 +1,91 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable,
+		option{
+			names:    []string{"--graphql"},
+			value:    "ENDPOINT",
+			usage:    "run the --query against the GraphQL ENDPOINT, loading the data it returns",
+			loadWith: loadGraphQL,
+		},
+		option{
+			names: []string{"--query"},
+			value: "QUERY",
+			usage: "the GraphQL query for the --graphql, or @FILE to read it from FILE",
+			of:    "--graphql",
+		},
+	)
+}
+
+func loadGraphQL(ctx context.Context, endpoint string, with settings, obj interface{}) error {
+	query := with.get("--query", "")
+	if query == "" {
+		return fmt.Errorf("needs a --query")
+	}
+	if strings.HasPrefix(query, "@") {
+		data, err := ioutil.ReadFile(query[1:])
+		if err != nil {
+			return err
+		}
+		query = string(data)
+	}
+	body, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpDo(nil, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data   map[string]interface{}
+		Errors []struct {
+			Message string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if len(result.Errors) != 0 {
+		var errs errorList
+		for _, e := range result.Errors {
+			errs = append(errs, fmt.Errorf("%s", e.Message))
+		}
+		return errs
+	}
+	return mount(obj, nil, result.Data)
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// readYAML reads the YAML file at path, with each value tagged "!include
+// PATH" replaced by the document in the file PATH names, relative to the file
+// it is in.
+func readYAML(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Contains(data, []byte("!include")) {
+		return string(data), nil
+	}
+	v, err := readIncludes(filepath.Clean(path), nil)
+	if err != nil || v == nil {
+		return "", err
+	}
+	out, err := yaml.Marshal(v)
+	return string(out), err
+}
+
+// includesYAML reports whether the YAML file at path has a value tagged
+// !include.
+func includesYAML(path string) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil || !bytes.Contains(data, []byte("!include")) {
+		return false, err
+	}
+	var n *yamlNode
+	if err := yaml.Unmarshal(data, &n); err != nil {
+		return false, err
+	}
+	return n.includes(), nil
+}
+
+// readIncludes decodes the YAML file at path, with its includes read.
+// including are the files that led to it, to catch one that includes itself.
+func readIncludes(path string, including []string) (interface{}, error) {
+	for _, p := range including {
+		if p == path {
+			return nil, fmt.Errorf("%s includes itself, by way of %s", path, strings.Join(including, ", "))
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var n *yamlNode
+	if err := yaml.Unmarshal(data, &n); err != nil {
+		if len(including) > 0 {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return nil, err
+	}
+	return n.resolve(path, including)
+}
+
+// A yamlNode is a YAML value as it is decoded, but with one tagged !include
+// kept as a yamlInclude, to be read once the rest is.
+type yamlNode struct {
+	// value is a map[interface{}]*yamlNode, a []*yamlNode, a yamlInclude,
+	// or a scalar.
+	value interface{}
+}
+
+// A yamlInclude is a value tagged "!include PATH", on the given line.
+type yamlInclude struct {
+	path string
+	line int
+}
+
+func (n *yamlNode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// yaml.v2 keeps a value's tag to itself, except to name it when the
+	// value can't be decoded, and only a mapping can be decoded into a
+	// struct{}.
+	var none struct{}
+	err := unmarshal(&none)
+	if err == nil {
+		var m map[interface{}]*yamlNode
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		n.value = m
+		return nil
+	}
+	terr, ok := err.(*yaml.TypeError)
+	if !ok || len(terr.Errors) != 1 {
+		return err
+	}
+	var line int
+	var tag string
+	if _, err := fmt.Sscanf(terr.Errors[0], "line %d: cannot unmarshal %s", &line, &tag); err != nil {
+		return err
+	}
+	switch tag {
+	case "!!seq":
+		var list []*yamlNode
+		if err := unmarshal(&list); err != nil {
+			return err
+		}
+		n.value = list
+		return nil
+	case "!include":
+		inc := yamlInclude{line: line}
+		if err := unmarshal(&inc.path); err != nil {
+			return err
+		}
+		if inc.path == "" {
+			return fmt.Errorf("line %d: !include needs a PATH", line)
+		}
+		n.value = inc
+		return nil
+	}
+	return unmarshal(&n.value)
+}
+
+// resolve returns the value n holds, from the file at path, with the
+// documents its includes name in their place.
+func (n *yamlNode) resolve(path string, including []string) (interface{}, error) {
+	if n == nil {
+		return nil, nil
+	}
+	switch v := n.value.(type) {
+	case map[interface{}]*yamlNode:
+		m := make(map[interface{}]interface{}, len(v))
+		for k, elem := range v {
+			resolved, err := elem.resolve(path, including)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = resolved
+		}
+		return m, nil
+	case []*yamlNode:
+		list := make([]interface{}, len(v))
+		for i, elem := range v {
+			resolved, err := elem.resolve(path, including)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = resolved
+		}
+		return list, nil
+	case yamlInclude:
+		name := v.path
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(path), name)
+		}
+		included, err := readIncludes(name, append(including, path))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, v.line, err)
+		}
+		return included, nil
+	}
+	return n.value, nil
+}
+
+// includes reports whether n, or anything in it, is tagged !include.
+func (n *yamlNode) includes() bool {
+	if n == nil {
+		return false
+	}
+	switch v := n.value.(type) {
+	case map[interface{}]*yamlNode:
+		for _, elem := range v {
+			if elem.includes() {
+				return true
+			}
+		}
+	case []*yamlNode:
+		for _, elem := range v {
+			if elem.includes() {
+				return true
+			}
+		}
+	case yamlInclude:
+		return true
+	}
+	return false
+}
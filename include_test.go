@@ -0,0 +1,109 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadYAMLIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.yaml":  "a: !include inc.yaml\nlist:\n- !include \"inc.yaml\"\n- 3\nrun: |\n  echo x: !include nothere\nnote: \"!include nothere\"\n",
+		"inc.yaml":   "x: 2\nbase: &base {k: 1}\nmore:\n  <<: *base\n  z: 3\n",
+		"loop.yaml":  "a: !include loop2.yaml\n",
+		"loop2.yaml": "b: !include loop.yaml\n",
+		"empty.yaml": "a: !include\n",
+		"gone.yaml":  "a:\n  b:\n  - !include nothere\n",
+	})
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"main.yaml", `{"a":{"base":{"k":1},"more":{"k":1,"z":3},"x":2},"list":[{"base":{"k":1},"more":{"k":1,"z":3},"x":2},3],"note":"!include nothere","run":"echo x: !include nothere\n"}`},
+		{"loop.yaml", ``},
+		{"empty.yaml", ``},
+		{"gone.yaml", ``},
+	}
+	for _, test := range tests {
+		obj := map[string]interface{}{}
+		err := loadArg(context.Background(), filepath.Join(dir, test.file), &obj)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s gave no error", test.file)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		got, err := json.Marshal(jsonable(obj))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%s gave %s, want %s", test.file, got, test.want)
+		}
+	}
+
+	_, err := readYAML(filepath.Join(dir, "loop.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "includes itself") {
+		t.Errorf("loop.yaml gave %v, want it to include itself", err)
+	}
+}
+
+func TestSetIncludes(t *testing.T) {
+	defer func(writeBack string) { options.writeBack = writeBack }(options.writeBack)
+	dir := t.TempDir()
+	main := "a: 1\nb: !include inc.yaml\n"
+	plain := "a: 1\nrun: |\n  echo x: !include nothere\n"
+	writeFiles(t, dir, map[string]string{
+		"main.yaml":  main,
+		"inc.yaml":   "x: 2\n",
+		"plain.yaml": plain,
+	})
+
+	if err := setFile(filepath.Join(dir, "main.yaml"), []string{"--a=5"}); err == nil {
+		t.Errorf("set on a file with !includes gave no error")
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "main.yaml")); err != nil || string(got) != main {
+		t.Errorf("set changed main.yaml to %q (%v)", got, err)
+	}
+
+	if err := setFile(filepath.Join(dir, "plain.yaml"), []string{"--a=5"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "a: 5\nrun: |\n  echo x: !include nothere\n"
+	if got, err := os.ReadFile(filepath.Join(dir, "plain.yaml")); err != nil || string(got) != want {
+		t.Errorf("set wrote %q (%v), want %q", got, err, want)
+	}
+}
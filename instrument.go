@@ -0,0 +1,139 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"strconv"
+	"text/template/parse"
+)
+
+// An instrument rewrites parsed templates before they execute, to watch
+// them as they do, like --trace.
+type instrument struct {
+	// funcs are the functions the rewritten templates call.
+	funcs map[string]interface{}
+	// rewrite changes the tree.
+	rewrite func(tree *parse.Tree)
+}
+
+// instruments are the ones the options have asked for.
+var instruments []instrument
+
+// instrumentFuncs adds the instruments' functions to funcs.
+func instrumentFuncs(funcs map[string]interface{}) map[string]interface{} {
+	for _, in := range instruments {
+		for name, fn := range in.funcs {
+			funcs[name] = fn
+		}
+	}
+	return funcs
+}
+
+// instrumentTree rewrites tree with every instrument.
+func instrumentTree(tree *parse.Tree) {
+	if tree == nil {
+		return
+	}
+	for _, in := range instruments {
+		in.rewrite(tree)
+	}
+}
+
+// eachPipe calls fn with every pipeline in n, and the action, if, range,
+// with or template that it belongs to.
+func eachPipe(n parse.Node, fn func(owner parse.Node, pipe *parse.PipeNode)) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			eachPipe(child, fn)
+		}
+	case *parse.ActionNode:
+		if added(n.Pipe) {
+			// It is another instrument's, like a --profile-template clock.
+			return
+		}
+		fn(n, n.Pipe)
+	case *parse.IfNode:
+		if added(n.Pipe) {
+			// It is another instrument's, like a --coverage counter.
+			return
+		}
+		eachBranchPipe(n, &n.BranchNode, fn)
+	case *parse.RangeNode:
+		eachBranchPipe(n, &n.BranchNode, fn)
+	case *parse.WithNode:
+		eachBranchPipe(n, &n.BranchNode, fn)
+	case *parse.TemplateNode:
+		if n.Pipe != nil {
+			fn(n, n.Pipe)
+		}
+	}
+}
+
+func eachBranchPipe(owner parse.Node, b *parse.BranchNode, fn func(owner parse.Node, pipe *parse.PipeNode)) {
+	fn(owner, b.Pipe)
+	eachPipe(b.List, fn)
+	eachPipe(b.ElseList, fn)
+}
+
+// added reports whether pipe was made by an instrument.
+func added(pipe *parse.PipeNode) bool {
+	return len(pipe.Cmds) != 0 && isCall(pipe.Cmds[0])
+}
+
+// isCall reports whether cmd calls one of the instruments' functions.
+func isCall(cmd *parse.CommandNode) bool {
+	id, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		return false
+	}
+	for _, in := range instruments {
+		if _, ok := in.funcs[id.Ident]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pipeText is how pipe appears in the template, without the calls that
+// instruments have added to it.
+func pipeText(pipe *parse.PipeNode) string {
+	p := *pipe
+	for len(p.Cmds) != 0 && isCall(p.Cmds[len(p.Cmds)-1]) {
+		p.Cmds = p.Cmds[:len(p.Cmds)-1]
+	}
+	return p.String()
+}
+
+// appendCall adds "| name ARGS..." to the end of pipe, for a function that
+// takes the string args and then the pipeline's value, and returns it.
+func appendCall(pipe *parse.PipeNode, name string, args ...string) {
+	cmd := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: pipe.Pos}
+	cmd.Args = append(cmd.Args, parse.NewIdentifier(name).SetPos(pipe.Pos))
+	for _, arg := range args {
+		cmd.Args = append(cmd.Args, &parse.StringNode{
+			NodeType: parse.NodeString,
+			Pos:      pipe.Pos,
+			Quoted:   strconv.Quote(arg),
+			Text:     arg,
+		})
+	}
+	pipe.Cmds = append(pipe.Cmds, cmd)
+}
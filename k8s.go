@@ -0,0 +1,88 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--k8s"},
+		value: "[NAMESPACE/]KIND/NAME",
+		usage: "load the data of a Kubernetes configmap or secret, using kubectl's kubeconfig or in-cluster login",
+		load:  loadK8s,
+	})
+}
+
+func loadK8s(ctx context.Context, ref string, obj interface{}) error {
+	parts := strings.Split(ref, "/")
+	args := []string{"get"}
+	switch len(parts) {
+	case 2:
+	case 3:
+		args = append(args, "--namespace", parts[0])
+		parts = parts[1:]
+	default:
+		return fmt.Errorf("%q is not [NAMESPACE/]KIND/NAME", ref)
+	}
+	kind, name := strings.ToLower(parts[0]), parts[1]
+	switch kind {
+	case "configmap", "configmaps", "cm":
+		kind = "configmap"
+	case "secret", "secrets":
+		kind = "secret"
+	default:
+		return fmt.Errorf("can only load configmaps and secrets, not %q", kind)
+	}
+	out, err := cachedTool(ctx, "kubectl", append(args, kind, name, "--output", "json")...)
+	if err != nil {
+		return err
+	}
+
+	var resource struct {
+		Data       map[string]string
+		BinaryData map[string]string
+	}
+	if err := json.Unmarshal(out, &resource); err != nil {
+		return err
+	}
+	data := map[string]interface{}{}
+	for k, v := range resource.Data {
+		if kind == "secret" {
+			// Secrets are always base64.
+			decoded, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return fmt.Errorf("%s: %v", k, err)
+			}
+			v = string(decoded)
+		}
+		data[k] = v
+	}
+	for k, v := range resource.BinaryData {
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", k, err)
+		}
+		data[k] = string(decoded)
+	}
+	return mount(obj, nil, data)
+}
@@ -0,0 +1,878 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package keys sets and gets values deep inside an object, a map, slice or
+// struct or anything made of them, by KEYs like "servers[0].host". They are
+// what tmplcute's --KEY=VALUE arguments are.
+//
+// A step of a KEY that doesn't exist yet is made: a field becomes a map
+// entry, and an index grows a slice. The value, given as a string, is parsed
+// to match the type of what it replaces, or of the struct field it goes in.
+// Delete takes the value at a KEY away again.
+package keys
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A Key is a parsed KEY, like "foo.bar[0]": fields of maps and structs,
+// separated by dots, and indexes of slices and arrays in brackets. Empty
+// brackets, like "foo[]", are a new element appended to the slice.
+type Key struct {
+	text  string
+	first step
+}
+
+// ParseKey parses k as a KEY.
+func ParseKey(k string) (Key, error) {
+	first, err := parseKey(k)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{text: k, first: first}, nil
+}
+
+// String returns the KEY as it was given to ParseKey.
+func (k Key) String() string {
+	return k.text
+}
+
+// Each step of a Key knows how to find or create its piece of the object,
+// and hands the rest off to next.
+type step interface {
+	// apply sets the value at the step, creating fields and growing slices
+	// along the way. v must be settable. value is a string to parse, or an
+	// exact to set as it is.
+	apply(v reflect.Value, value interface{}) error
+	// get returns the value at the step.
+	get(v reflect.Value) (reflect.Value, error)
+}
+
+// fieldKey is a map entry or struct field, like "foo".
+type fieldKey struct {
+	name string
+	next step
+}
+
+// indexKey is a slice or array element, like "[0]".
+type indexKey struct {
+	index int
+	next  step
+}
+
+// appendKey is a new element at the end of a slice, "[]".
+type appendKey struct {
+	next step
+}
+
+// deleteKey is the last step of a KEY being deleted. It takes away the map
+// entry or slice element that its field or index names, and zeroes a struct
+// field, rather than setting it.
+type deleteKey struct {
+	last step
+}
+
+// MaxIndex is the highest index Overwrite will grow a slice to reach, so that
+// a typo like "arr[999999999]" is an error rather than gigabytes of nils.
+var MaxIndex = 100000
+
+// Overwrite sets the value at k in the object pointed to by obj.
+func Overwrite(obj interface{}, k string, value string) error {
+	key, err := ParseKey(k)
+	if err != nil {
+		return err
+	}
+	return key.Apply(obj, value)
+}
+
+// OverwriteValue is Overwrite with a value that is set as it is, rather than
+// parsed from a string.
+func OverwriteValue(obj interface{}, k string, value interface{}) error {
+	key, err := ParseKey(k)
+	if err != nil {
+		return err
+	}
+	return key.ApplyValue(obj, value)
+}
+
+// Delete takes away the value at k in the object pointed to by obj: a map
+// entry is deleted, a slice element removed, moving the rest down, and a
+// struct field set to its zero value. If there is nothing at k, there is
+// nothing to do.
+func Delete(obj interface{}, k string) error {
+	key, err := ParseKey(k)
+	if err != nil {
+		return err
+	}
+	return key.Delete(obj)
+}
+
+// Apply sets the value at k in the object pointed to by obj. Fields that
+// aren't there are added, and slices grown to reach an index.
+func (k Key) Apply(obj interface{}, value string) error {
+	return k.apply(obj, value)
+}
+
+// ApplyValue is Apply with a value that is set as it is, rather than parsed
+// from a string. It must be assignable to what it replaces, or encode as
+// JSON that decodes into it.
+func (k Key) ApplyValue(obj interface{}, value interface{}) error {
+	return k.apply(obj, exact{value})
+}
+
+// Delete takes away the value at k in the object pointed to by obj, as the
+// function Delete does.
+func (k Key) Delete(obj interface{}) error {
+	steps, err := parseSteps(k.text)
+	if err != nil {
+		return err
+	}
+	last := steps[len(steps)-1]
+	if _, ok := last.(appendKey); ok {
+		return fmt.Errorf("%s: [] only appends, so there is nothing to delete", k)
+	}
+	if len(steps) > 1 {
+		// Applying would make what isn't there on the way to the last step.
+		if _, err := link(steps[:len(steps)-1]).get(reflect.ValueOf(obj)); err != nil {
+			return nil
+		}
+	}
+	steps[len(steps)-1] = deleteKey{last: last}
+	return Key{text: k.text, first: link(steps)}.apply(obj, nil)
+}
+
+// Indexes returns the indexes in k, like 0 and 2 for "a[0].b[2]", in order.
+// Empty brackets, which append, aren't indexes.
+func (k Key) Indexes() []int {
+	var indexes []int
+	for s := k.first; s != nil; {
+		switch t := s.(type) {
+		case fieldKey:
+			s = t.next
+		case indexKey:
+			indexes = append(indexes, t.index)
+			s = t.next
+		case appendKey:
+			s = t.next
+		default:
+			s = nil
+		}
+	}
+	return indexes
+}
+
+// Appends returns how many empty brackets, which append, are in k, like 2
+// for "a[].b[7][]".
+func (k Key) Appends() int {
+	n := 0
+	for s := k.first; s != nil; {
+		switch t := s.(type) {
+		case fieldKey:
+			s = t.next
+		case indexKey:
+			s = t.next
+		case appendKey:
+			n++
+			s = t.next
+		default:
+			s = nil
+		}
+	}
+	return n
+}
+
+// An exact is a value for apply to set as it is.
+type exact struct {
+	v interface{}
+}
+
+func (k Key) apply(obj interface{}, value interface{}) error {
+	if m, ok := obj.(*map[string]interface{}); ok && m != nil {
+		res, err := fastApply(k.first, *m, value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", k, err)
+		}
+		*m = res.(map[string]interface{})
+		return nil
+	}
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("can only overwrite through a pointer, not %T", obj)
+	}
+	if err := k.first.apply(v.Elem(), value); err != nil {
+		return fmt.Errorf("%s: %v", k, err)
+	}
+	return nil
+}
+
+// fastApply is apply for what decoding makes, map[string]interface{} and
+// []interface{}, without reflection. It returns what should replace cur,
+// which is where k starts. Anything else goes to apply.
+func fastApply(k step, cur interface{}, value interface{}) (interface{}, error) {
+	var next step
+	var elem interface{}
+	var put func(interface{})
+	switch k := k.(type) {
+	case fieldKey:
+		if cur == nil {
+			cur = map[string]interface{}{}
+		}
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return slowApply(k, cur, value)
+		}
+		next, elem = k.next, m[k.name]
+		put = func(v interface{}) { m[k.name] = v }
+	case indexKey:
+		if cur == nil {
+			cur = []interface{}{}
+		}
+		s, ok := cur.([]interface{})
+		if !ok {
+			return slowApply(k, cur, value)
+		}
+		if k.index >= len(s) {
+			if err := checkGrowth(k.index); err != nil {
+				return nil, err
+			}
+			if k.index < cap(s) {
+				old := len(s)
+				s = s[:k.index+1]
+				for i := old; i < len(s); i++ {
+					s[i] = nil
+				}
+			} else {
+				grown := make([]interface{}, k.index+1, 2*(k.index+1))
+				copy(grown, s)
+				s = grown
+			}
+			cur = s
+		}
+		next, elem = k.next, s[k.index]
+		put = func(v interface{}) { s[k.index] = v }
+	case appendKey:
+		if cur == nil {
+			cur = []interface{}{}
+		}
+		s, ok := cur.([]interface{})
+		if !ok {
+			return slowApply(k, cur, value)
+		}
+		if err := checkGrowth(len(s)); err != nil {
+			return nil, err
+		}
+		s = append(s, nil)
+		cur = s
+		next = k.next
+		if next == nil && len(s) > 1 {
+			// The new element takes the type of the one before it.
+			elem = s[len(s)-2]
+		}
+		put = func(v interface{}) { s[len(s)-1] = v }
+	default:
+		return slowApply(k, cur, value)
+	}
+
+	if next == nil {
+		put(fastSet(elem, value))
+		return cur, nil
+	}
+	elem, err := fastApply(next, elem, value)
+	if err != nil {
+		return nil, err
+	}
+	put(elem)
+	return cur, nil
+}
+
+// slowApply is fastApply for everything else, by way of apply.
+func slowApply(k step, cur interface{}, value interface{}) (interface{}, error) {
+	v := reflect.New(interfaceType).Elem()
+	if cur != nil {
+		v.Set(reflect.ValueOf(cur))
+	}
+	if err := k.apply(v, value); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// fastSet is setValue for an interface{} holding cur, without reflection
+// for the types decoding makes.
+func fastSet(cur interface{}, x interface{}) interface{} {
+	value, ok := x.(string)
+	if !ok {
+		return x.(exact).v
+	}
+	switch cur.(type) {
+	case nil, string:
+		return value
+	case float64:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+		return value
+	case bool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+		return value
+	}
+	v := reflect.New(interfaceType).Elem()
+	v.Set(reflect.ValueOf(cur))
+	setValue(v, value)
+	return v.Interface()
+}
+
+// Lookup returns the value at k in obj, or nil if there is nothing there.
+func Lookup(obj interface{}, k string) (interface{}, error) {
+	key, err := ParseKey(k)
+	if err != nil {
+		return nil, err
+	}
+	return key.Get(obj)
+}
+
+// Get returns the value at k in obj, or nil if there is nothing there.
+func (k Key) Get(obj interface{}) (interface{}, error) {
+	v, err := k.first.get(reflect.ValueOf(obj))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", k, err)
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	return v.Interface(), nil
+}
+
+// parseKey breaks k into its fields and indices.
+func parseKey(k string) (step, error) {
+	steps, err := parseSteps(k)
+	if err != nil {
+		return nil, err
+	}
+	return link(steps), nil
+}
+
+// parseSteps breaks k into its steps, not yet linked together.
+func parseSteps(k string) ([]step, error) {
+	var steps []step
+	rest := k
+	for rest != "" {
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated index in %q", k)
+			}
+			if end == 1 {
+				steps = append(steps, appendKey{})
+				rest = rest[end+1:]
+				continue
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("bad index %q in %q", rest[1:end], k)
+			}
+			steps = append(steps, indexKey{index: index})
+			rest = rest[end+1:]
+		case rest[0] == '.' && len(steps) != 0:
+			rest = rest[1:]
+			fallthrough
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty field in %q", k)
+			}
+			steps = append(steps, fieldKey{name: rest[:end]})
+			rest = rest[end:]
+		}
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("empty key")
+	}
+	return steps, nil
+}
+
+// link sets each step's next to the one after it, and returns the first.
+func link(steps []step) step {
+	var next step
+	for i := len(steps) - 1; i >= 0; i-- {
+		switch s := steps[i].(type) {
+		case fieldKey:
+			s.next = next
+			next = s
+		case indexKey:
+			s.next = next
+			next = s
+		case appendKey:
+			s.next = next
+			next = s
+		case deleteKey:
+			next = s
+		}
+	}
+	return next
+}
+
+func (k fieldKey) apply(v reflect.Value, value interface{}) error {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			v.Set(reflect.ValueOf(map[string]interface{}{}))
+		}
+		if through, ok := writableThrough(v.Elem()); ok {
+			return k.apply(through, value)
+		}
+		return applyToElem(k, v, value)
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return k.apply(v.Elem(), value)
+	case reflect.Map:
+		return k.applyToMap(v, value)
+	case reflect.Struct:
+		f, err := k.field(v)
+		if err != nil {
+			return err
+		}
+		if !f.CanSet() {
+			return fmt.Errorf("cannot set field %q of %s", k.name, v.Type())
+		}
+		return applyNext(k.next, f, value)
+	}
+	return fmt.Errorf("cannot use field %q on %s", k.name, v.Type())
+}
+
+// applyToMap sets the entry for k in the map v. Map entries are not
+// addressable, so unless the entry is a map or pointer that can be written
+// through, it is copied out, set, and put back.
+func (k fieldKey) applyToMap(v reflect.Value, value interface{}) error {
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	mk, err := k.mapKey(v)
+	if err != nil {
+		return err
+	}
+	cur := v.MapIndex(mk)
+	if cur.IsValid() && k.next != nil {
+		if through, ok := writableThrough(cur); ok {
+			return k.next.apply(through, value)
+		}
+	}
+	elem := reflect.New(v.Type().Elem()).Elem()
+	if cur.IsValid() {
+		elem.Set(cur)
+	}
+	if err := applyNext(k.next, elem, value); err != nil {
+		return err
+	}
+	v.SetMapIndex(mk, elem)
+	return nil
+}
+
+func (k fieldKey) get(v reflect.Value) (reflect.Value, error) {
+	v = Indirect(v)
+	switch v.Kind() {
+	case reflect.Map:
+		mk, err := k.mapKey(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		elem := v.MapIndex(mk)
+		if !elem.IsValid() {
+			return reflect.Value{}, fmt.Errorf("no field %q", k.name)
+		}
+		return getNext(k.next, elem)
+	case reflect.Struct:
+		f, err := k.field(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return getNext(k.next, f)
+	case reflect.Invalid:
+		return reflect.Value{}, fmt.Errorf("no field %q in nil", k.name)
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use field %q on %s", k.name, v.Type())
+}
+
+// mapKey converts the field name into something usable as a key for the map v.
+func (k fieldKey) mapKey(v reflect.Value) (reflect.Value, error) {
+	mk := reflect.ValueOf(k.name)
+	kt := v.Type().Key()
+	if mk.Type().AssignableTo(kt) {
+		return mk, nil
+	}
+	if kt.Kind() == reflect.String {
+		return mk.Convert(kt), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use field %q on %s", k.name, v.Type())
+}
+
+// field finds the struct field for k, by name, then by json or yaml tag,
+// then by case-insensitive name.
+func (k fieldKey) field(v reflect.Value) (reflect.Value, error) {
+	t := v.Type()
+	if _, ok := t.FieldByName(k.name); ok {
+		return v.FieldByName(k.name), nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		for _, tag := range []string{"json", "yaml"} {
+			name := strings.Split(t.Field(i).Tag.Get(tag), ",")[0]
+			if name == k.name {
+				return v.Field(i), nil
+			}
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if strings.EqualFold(t.Field(i).Name, k.name) {
+			return v.Field(i), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("no field %q in %s", k.name, t)
+}
+
+func (k indexKey) apply(v reflect.Value, value interface{}) error {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			v.Set(reflect.ValueOf([]interface{}{}))
+		}
+		return applyToElem(k, v, value)
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return k.apply(v.Elem(), value)
+	case reflect.Slice:
+		if k.index >= v.Len() {
+			if err := checkGrowth(k.index); err != nil {
+				return err
+			}
+			growSlice(v, k.index+1)
+		}
+		return applyNext(k.next, v.Index(k.index), value)
+	case reflect.Array:
+		if k.index >= v.Len() {
+			return fmt.Errorf("index %d out of range for %s", k.index, v.Type())
+		}
+		return applyNext(k.next, v.Index(k.index), value)
+	}
+	return fmt.Errorf("cannot use index %d on %s", k.index, v.Type())
+}
+
+func (k indexKey) get(v reflect.Value) (reflect.Value, error) {
+	v = Indirect(v)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if k.index >= v.Len() {
+			return reflect.Value{}, fmt.Errorf("index %d out of range, length is %d", k.index, v.Len())
+		}
+		return getNext(k.next, v.Index(k.index))
+	case reflect.Invalid:
+		return reflect.Value{}, fmt.Errorf("no index %d in nil", k.index)
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use index %d on %s", k.index, v.Type())
+}
+
+// checkGrowth checks that a slice can be grown to reach index.
+func checkGrowth(index int) error {
+	if index > MaxIndex {
+		return fmt.Errorf("index %d is past the limit of %d", index, MaxIndex)
+	}
+	return nil
+}
+
+func (k appendKey) apply(v reflect.Value, value interface{}) error {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			v.Set(reflect.ValueOf([]interface{}{}))
+		}
+		return applyToElem(k, v, value)
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return k.apply(v.Elem(), value)
+	case reflect.Slice:
+		n := v.Len()
+		if err := checkGrowth(n); err != nil {
+			return err
+		}
+		growSlice(v, n+1)
+		if k.next == nil && n > 0 && v.Index(n).Kind() == reflect.Interface {
+			// The new element takes the type of the one before it.
+			v.Index(n).Set(v.Index(n - 1))
+		}
+		return applyNext(k.next, v.Index(n), value)
+	}
+	return fmt.Errorf("cannot append to %s", v.Type())
+}
+
+func (k appendKey) get(v reflect.Value) (reflect.Value, error) {
+	return reflect.Value{}, fmt.Errorf("[] only appends, so there is nothing to get")
+}
+
+func (k deleteKey) apply(v reflect.Value, value interface{}) error {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if through, ok := writableThrough(v.Elem()); ok {
+			return k.apply(through, value)
+		}
+		return applyToElem(k, v, value)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return k.apply(v.Elem(), value)
+	}
+	switch last := k.last.(type) {
+	case fieldKey:
+		switch v.Kind() {
+		case reflect.Map:
+			if v.IsNil() {
+				return nil
+			}
+			mk, err := last.mapKey(v)
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(mk, reflect.Value{})
+			return nil
+		case reflect.Struct:
+			f, err := last.field(v)
+			if err != nil {
+				return err
+			}
+			if !f.CanSet() {
+				return fmt.Errorf("cannot set field %q of %s", last.name, v.Type())
+			}
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+		return fmt.Errorf("cannot delete field %q from %s", last.name, v.Type())
+	case indexKey:
+		if v.Kind() != reflect.Slice {
+			return fmt.Errorf("cannot delete index %d from %s", last.index, v.Type())
+		}
+		n := v.Len()
+		if last.index >= n {
+			return nil
+		}
+		reflect.Copy(v.Slice(last.index, n), v.Slice(last.index+1, n))
+		// The element left over at the end shouldn't keep anything alive.
+		v.Index(n - 1).Set(reflect.Zero(v.Type().Elem()))
+		v.SetLen(n - 1)
+		return nil
+	}
+	return fmt.Errorf("cannot delete %T", k.last)
+}
+
+func (k deleteKey) get(v reflect.Value) (reflect.Value, error) {
+	return reflect.Value{}, fmt.Errorf("a deleted KEY has nothing to get")
+}
+
+// growSlice makes the slice v n long. Like append, it leaves room to spare,
+// so setting [0], [1], [2] and so on doesn't copy the slice every time.
+func growSlice(v reflect.Value, n int) {
+	if n > v.Cap() {
+		grown := reflect.MakeSlice(v.Type(), v.Len(), 2*n)
+		reflect.Copy(grown, v)
+		v.Set(grown)
+	}
+	old := v.Len()
+	v.SetLen(n)
+	// The spare room may still hold what was there before a reslice.
+	zero := reflect.Zero(v.Type().Elem())
+	for i := old; i < n; i++ {
+		v.Index(i).Set(zero)
+	}
+}
+
+// writableThrough returns what v refers to, if v is a map or pointer, so
+// that it can be changed without v having to be put back anywhere.
+func writableThrough(v reflect.Value) (reflect.Value, bool) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Map && !v.IsNil():
+		return v, true
+	case v.Kind() == reflect.Ptr && !v.IsNil():
+		return v.Elem(), true
+	}
+	return reflect.Value{}, false
+}
+
+// applyToElem applies k to the value inside the interface v. Values inside
+// an interface are not addressable, so it gets copied, applied, and put back.
+func applyToElem(k step, v reflect.Value, value interface{}) error {
+	elem := reflect.New(v.Elem().Type()).Elem()
+	elem.Set(v.Elem())
+	if err := k.apply(elem, value); err != nil {
+		return err
+	}
+	v.Set(elem)
+	return nil
+}
+
+func applyNext(next step, v reflect.Value, value interface{}) error {
+	if next == nil {
+		return setValue(v, value)
+	}
+	return next.apply(v, value)
+}
+
+func getNext(next step, v reflect.Value) (reflect.Value, error) {
+	if next == nil {
+		return Indirect(v), nil
+	}
+	return next.get(v)
+}
+
+// Field returns the field called name in v, a map entry or struct field,
+// following pointers and interfaces to get there. Struct fields are found
+// as they are for a KEY: by name, then by json or yaml tag, then by name
+// in any case. ok is false if v has no such field.
+func Field(v reflect.Value, name string) (f reflect.Value, ok bool) {
+	v = Indirect(v)
+	k := fieldKey{name: name}
+	switch v.Kind() {
+	case reflect.Map:
+		mk, err := k.mapKey(v)
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		f = v.MapIndex(mk)
+		return f, f.IsValid()
+	case reflect.Struct:
+		f, err := k.field(v)
+		return f, err == nil
+	}
+	return reflect.Value{}, false
+}
+
+// Indirect follows pointers and interfaces down to a concrete value, which
+// is the zero Value if it ends at a nil.
+func Indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// setValue sets v to value, an exact or a string to parse.
+func setValue(v reflect.Value, value interface{}) error {
+	if e, ok := value.(exact); ok {
+		return setExact(v, e.v)
+	}
+	return parseValue(v, value.(string))
+}
+
+// parseValue parses value into v. If v is an interface that already holds
+// something, parseValue tries to match that thing's type, falling back to a
+// string.
+func parseValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.Interface:
+		if !v.IsNil() {
+			elem := reflect.New(v.Elem().Type()).Elem()
+			if err := parseValue(elem, value); err == nil {
+				v.Set(elem)
+				return nil
+			}
+		}
+		v.Set(reflect.ValueOf(value))
+		return nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return parseValue(v.Elem(), value)
+	case reflect.String:
+		v.SetString(value)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	}
+	return fmt.Errorf("cannot set %s to %q", v.Type(), value)
+}
+
+// setExact sets v to x, which only has to be assignable to v, or else be
+// JSON that v's type can decode, like a []interface{} for a []string.
+func setExact(v reflect.Value, x interface{}) error {
+	if x == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	xv := reflect.ValueOf(x)
+	if xv.Type().AssignableTo(v.Type()) {
+		v.Set(xv)
+		return nil
+	}
+	data, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v.Addr().Interface()); err != nil {
+		return fmt.Errorf("cannot set %s to %s", v.Type(), data)
+	}
+	return nil
+}
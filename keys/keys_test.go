@@ -0,0 +1,383 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keys
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decode is what tmplcute's documents decode to.
+func decode(t testing.TB, s string) map[string]interface{} {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func encode(t testing.TB, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestOverwrite(t *testing.T) {
+	tests := []struct {
+		obj, key, value string
+		want            string
+	}{
+		{`{}`, "a", "x", `{"a":"x"}`},
+		{`{}`, "a.b.c", "x", `{"a":{"b":{"c":"x"}}}`},
+		{`{"n":1}`, "n", "2.5", `{"n":2.5}`},
+		{`{"n":1}`, "n", "many", `{"n":"many"}`},
+		{`{"b":false}`, "b", "true", `{"b":true}`},
+		{`{}`, "arr[2]", "x", `{"arr":[null,null,"x"]}`},
+		{`{"arr":[1,2]}`, "arr[0]", "5", `{"arr":[5,2]}`},
+		{`{"arr":[1]}`, "arr[]", "2", `{"arr":[1,2]}`},
+		{`{}`, "arr[]", "x", `{"arr":["x"]}`},
+		{`{}`, "arr[].name", "x", `{"arr":[{"name":"x"}]}`},
+		{`{"servers":[{"host":"a"}]}`, "servers[0].port", "80", `{"servers":[{"host":"a","port":"80"}]}`},
+		{`{"m":{"a":1}}`, "m[1]", "x", ``},
+		{`{"s":"x"}`, "s.a", "x", ``},
+	}
+	for _, test := range tests {
+		obj := decode(t, test.obj)
+		err := Overwrite(&obj, test.key, test.value)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: %s=%s gave %s, want an error", test.obj, test.key, test.value, encode(t, obj))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s=%s: %v", test.obj, test.key, test.value, err)
+		} else if got := encode(t, obj); got != test.want {
+			t.Errorf("%s: %s=%s gave %s, want %s", test.obj, test.key, test.value, got, test.want)
+		}
+	}
+}
+
+// TestFastApply checks that fastApply, for what decoding makes, does what
+// the reflection in slowApply does.
+func TestFastApply(t *testing.T) {
+	tests := []struct {
+		obj, key, value string
+	}{
+		{`{}`, "a.b", "x"},
+		{`{"a":{"b":1}}`, "a.b", "2"},
+		{`{"a":{"b":true}}`, "a.b", "false"},
+		{`{"a":[1,2,3]}`, "a[5]", "6"},
+		{`{"a":[1]}`, "a[]", "2"},
+		{`{"a":[{"b":1}]}`, "a[0].b", "x"},
+	}
+	for _, test := range tests {
+		key, err := ParseKey(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fast, err := fastApply(key.first, decode(t, test.obj), test.value)
+		if err != nil {
+			t.Errorf("%s: %s=%s: fast: %v", test.obj, test.key, test.value, err)
+			continue
+		}
+		slow, err := slowApply(key.first, decode(t, test.obj), test.value)
+		if err != nil {
+			t.Errorf("%s: %s=%s: slow: %v", test.obj, test.key, test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(fast, slow) {
+			t.Errorf("%s: %s=%s: fast gave %s, slow gave %s", test.obj, test.key, test.value, encode(t, fast), encode(t, slow))
+		}
+	}
+}
+
+type server struct {
+	Host  string            `json:"host"`
+	Port  int               `json:"port"`
+	Tags  []string          `json:"tags"`
+	Extra interface{}       `json:"extra"`
+	Env   map[string]string `json:"env"`
+	Next  *server           `json:"next"`
+}
+
+func TestOverwriteStruct(t *testing.T) {
+	tests := []struct {
+		key, value string
+		want       string
+	}{
+		{"Host", "a", `{"host":"a","port":0,"tags":null,"extra":null,"env":null,"next":null}`},
+		{"port", "8080", `{"host":"","port":8080,"tags":null,"extra":null,"env":null,"next":null}`},
+		{"Tags[1]", "b", `{"host":"","port":0,"tags":["","b"],"extra":null,"env":null,"next":null}`},
+		{"tags[]", "b", `{"host":"","port":0,"tags":["b"],"extra":null,"env":null,"next":null}`},
+		{"env.HOME", "/root", `{"host":"","port":0,"tags":null,"extra":null,"env":{"HOME":"/root"},"next":null}`},
+		{"next.port", "1", `{"host":"","port":0,"tags":null,"extra":null,"env":null,"next":{"host":"","port":1,"tags":null,"extra":null,"env":null,"next":null}}`},
+		{"extra.a[0]", "x", `{"host":"","port":0,"tags":null,"extra":{"a":["x"]},"env":null,"next":null}`},
+		{"port", "many", ``},
+		{"missing", "x", ``},
+	}
+	for _, test := range tests {
+		var s server
+		err := Overwrite(&s, test.key, test.value)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s=%s gave %s, want an error", test.key, test.value, encode(t, s))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s=%s: %v", test.key, test.value, err)
+		} else if got := encode(t, s); got != test.want {
+			t.Errorf("%s=%s gave %s, want %s", test.key, test.value, got, test.want)
+		}
+	}
+}
+
+// TestOverwriteInPlace checks that maps and pointers are changed where they
+// are, rather than copied and put back.
+func TestOverwriteInPlace(t *testing.T) {
+	env := map[string]string{}
+	next := &server{}
+	s := server{Env: env, Next: next, Extra: map[string]interface{}{}}
+	extra := s.Extra.(map[string]interface{})
+	for _, kv := range [][2]string{{"env.a", "1"}, {"next.host", "b"}, {"extra.c", "2"}} {
+		if err := Overwrite(&s, kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if env["a"] != "1" || next.Host != "b" || extra["c"] != "2" {
+		t.Errorf("got env %v, next %+v and extra %v; want them changed in place", env, *next, extra)
+	}
+}
+
+func TestOverwriteValue(t *testing.T) {
+	obj := decode(t, `{"a":{"b":1}}`)
+	if err := OverwriteValue(&obj, "a.b", []interface{}{"x", 2.0}); err != nil {
+		t.Fatal(err)
+	}
+	var s server
+	if err := OverwriteValue(&s, "tags", []interface{}{"x", "y"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := encode(t, obj), `{"a":{"b":["x",2]}}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, want := strings.Join(s.Tags, ","), "x,y"; got != want {
+		t.Errorf("got tags %s, want %s", got, want)
+	}
+	if err := OverwriteValue(&s, "port", "many"); err == nil {
+		t.Errorf("setting an int to a string gave no error")
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		obj, key string
+		want     string
+	}{
+		{`{"a":1,"b":2}`, "a", `{"b":2}`},
+		{`{"a":{"b":1,"c":2}}`, "a.b", `{"a":{"c":2}}`},
+		{`{"a":[1,2,3]}`, "a[1]", `{"a":[1,3]}`},
+		{`{"a":[1,2,3]}`, "a[5]", `{"a":[1,2,3]}`},
+		{`{"a":[{"b":1}]}`, "a[0].b", `{"a":[{}]}`},
+		{`{"a":1}`, "x.y.z", `{"a":1}`},
+		{`{"a":1}`, "x", `{"a":1}`},
+		{`{"a":[1]}`, "a[]", ``},
+		{`{"a":"s"}`, "a.b", ``},
+	}
+	for _, test := range tests {
+		obj := decode(t, test.obj)
+		err := Delete(&obj, test.key)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: deleting %s gave %s, want an error", test.obj, test.key, encode(t, obj))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: deleting %s: %v", test.obj, test.key, err)
+		} else if got := encode(t, obj); got != test.want {
+			t.Errorf("%s: deleting %s gave %s, want %s", test.obj, test.key, got, test.want)
+		}
+	}
+
+	s := server{Host: "a", Port: 1, Tags: []string{"x", "y"}, Env: map[string]string{"a": "1"}}
+	for _, k := range []string{"host", "tags[0]", "env.a", "next.host"} {
+		if err := Delete(&s, k); err != nil {
+			t.Errorf("deleting %s: %v", k, err)
+		}
+	}
+	if got, want := encode(t, s), `{"host":"","port":1,"tags":["y"],"extra":null,"env":{},"next":null}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestMaxIndex(t *testing.T) {
+	defer func(n int) { MaxIndex = n }(MaxIndex)
+	MaxIndex = 10
+
+	obj := map[string]interface{}{}
+	if err := Overwrite(&obj, "a[10]", "x"); err != nil {
+		t.Errorf("a[10]: %v", err)
+	}
+	if err := Overwrite(&obj, "a[11]", "x"); err == nil {
+		t.Errorf("a[11] past a MaxIndex of 10 gave no error")
+	}
+	if err := Overwrite(&obj, "a[]", "x"); err == nil {
+		t.Errorf("a[] past a MaxIndex of 10 gave no error")
+	}
+	var s server
+	if err := Overwrite(&s, "tags[11]", "x"); err == nil {
+		t.Errorf("tags[11] past a MaxIndex of 10 gave no error")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	obj := decode(t, `{"a":{"b":[1,{"c":"x"}]}}`)
+	tests := []struct {
+		key  string
+		want interface{}
+		ok   bool
+	}{
+		{"a.b[1].c", "x", true},
+		{"a.b[0]", 1.0, true},
+		{"a.b[1].d", nil, false},
+		{"a.b[5]", nil, false},
+		{"a.b[]", nil, false},
+	}
+	for _, test := range tests {
+		got, err := Lookup(obj, test.key)
+		if ok := err == nil; ok != test.ok || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Lookup(%s) = %v, %v; want %v, ok %v", test.key, got, err, test.want, test.ok)
+		}
+	}
+}
+
+// The benchmarks set n keys each, so that the time per key staying flat as
+// n grows shows that setting many of them isn't quadratic.
+
+func benchmarkKeys(b *testing.B, n int, key func(i int) string, obj func() interface{}) {
+	keys := make([]Key, n)
+	for i := range keys {
+		var err error
+		if keys[i], err = ParseKey(key(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		o := obj()
+		for _, k := range keys {
+			if err := k.Apply(o, "1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func newMap() interface{} {
+	return &map[string]interface{}{}
+}
+
+func newStruct() interface{} {
+	return &server{}
+}
+
+func BenchmarkIndexes(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			benchmarkKeys(b, n, func(i int) string { return fmt.Sprintf("a.b[%d]", i) }, newMap)
+		})
+	}
+}
+
+func BenchmarkAppends(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			benchmarkKeys(b, n, func(int) string { return "a.b[]" }, newMap)
+		})
+	}
+}
+
+func BenchmarkFields(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			benchmarkKeys(b, n, func(i int) string { return fmt.Sprintf("a.b.f%d", i) }, newMap)
+		})
+	}
+}
+
+func BenchmarkStructIndexes(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			benchmarkKeys(b, n, func(i int) string { return fmt.Sprintf("tags[%d]", i) }, newStruct)
+		})
+	}
+}
+
+func BenchmarkStructInterface(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			benchmarkKeys(b, n, func(i int) string { return fmt.Sprintf("extra.a.f%d", i) }, newStruct)
+		})
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []int
+	}{
+		{"a", nil},
+		{"a[0].b[2]", []int{0, 2}},
+		{"a[].b[7][]", []int{7}},
+	}
+	for _, test := range tests {
+		k, err := ParseKey(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := k.Indexes(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Indexes() = %v, want %v", test.key, got, test.want)
+		}
+	}
+}
+
+func TestAppends(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"a", 0},
+		{"a[0].b[2]", 0},
+		{"a[].b[7][]", 2},
+	}
+	for _, test := range tests {
+		k, err := ParseKey(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := k.Appends(); got != test.want {
+			t.Errorf("%s: Appends() = %d, want %d", test.key, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+func init() {
+	optionTable = append(optionTable,
+		option{
+			names: []string{"--lazy"},
+			usage: "only load the top-level fields the templates use: JSON files skip over the rest, and sources that would only add unused fields are not loaded at all",
+			set: func(string) error {
+				options.lazy = true
+				return nil
+			},
+		},
+		option{
+			names: []string{"--warn-unused"},
+			usage: "warn about top-level fields of the object that the templates never use",
+			set: func(string) error {
+				options.warnUnused = true
+				return nil
+			},
+		},
+	)
+}
+
+// neededFields returns the top-level fields of the object that --lazy has to
+// load, or nil for all of them.
+func neededFields(ctx context.Context) (map[string]bool, error) {
+	if options.schema != "" || options.cueSchema != "" || len(options.transforms) != 0 || len(options.derives) != 0 {
+		// The schemas are about the whole object, and a --transform or
+		// --derive could use any of it.
+		return nil, nil
+	}
+	return templateFields(ctx)
+}
+
+// templateFields returns the top-level fields of the object that the
+// templates to be rendered could use, or nil if they might use any of them,
+// like {{json .}} does.
+func templateFields(ctx context.Context) (map[string]bool, error) {
+	texts, err := templateTexts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	need := map[string]bool{}
+	for name, text := range texts {
+		tmpl, err := template.New(name).Funcs(funcMap()).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tmpl.Templates() {
+			if t.Tree == nil {
+				continue
+			}
+			// Templates made with define are handed their data, so neither
+			// their dot nor their $ is the object.
+			main := t.Name() == name
+			if !fieldsUsed(t.Tree.Root, main, main, need) {
+				return nil, nil
+			}
+		}
+	}
+	return need, nil
+}
+
+// fieldsUsed adds the top-level fields used in node to need. dot and dollar
+// are whether . and $ are the object itself there. It returns false if the
+// whole object is used, so no field can be left out.
+func fieldsUsed(node parse.Node, dot, dollar bool, need map[string]bool) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return true
+		}
+		for _, child := range n.Nodes {
+			if !fieldsUsed(child, dot, dollar, need) {
+				return false
+			}
+		}
+	case *parse.ActionNode:
+		return fieldsUsed(n.Pipe, dot, dollar, need)
+	case *parse.IfNode:
+		return fieldsUsedInBranch(&n.BranchNode, dot, dot, dollar, need)
+	case *parse.RangeNode:
+		return fieldsUsedInBranch(&n.BranchNode, dot, false, dollar, need)
+	case *parse.WithNode:
+		return fieldsUsedInBranch(&n.BranchNode, dot, false, dollar, need)
+	case *parse.TemplateNode:
+		return fieldsUsed(n.Pipe, dot, dollar, need)
+	case *parse.PipeNode:
+		if n == nil {
+			return true
+		}
+		for _, cmd := range n.Cmds {
+			if !fieldsUsed(cmd, dot, dollar, need) {
+				return false
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if !fieldsUsed(arg, dot, dollar, need) {
+				return false
+			}
+		}
+	case *parse.ChainNode:
+		return fieldsUsed(n.Node, dot, dollar, need)
+	case *parse.FieldNode:
+		if dot {
+			need[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && dollar {
+			if len(n.Ident) == 1 {
+				return false
+			}
+			need[n.Ident[1]] = true
+		}
+	case *parse.DotNode:
+		return !dot
+	}
+	return true
+}
+
+// fieldsUsedInBranch is fieldsUsed for an if, range or with, whose body sees
+// inner as dot.
+func fieldsUsedInBranch(n *parse.BranchNode, dot, inner, dollar bool, need map[string]bool) bool {
+	return fieldsUsed(n.Pipe, dot, dollar, need) &&
+		fieldsUsed(n.List, inner, dollar, need) &&
+		fieldsUsed(n.ElseList, dot, dollar, need)
+}
+
+// applyLazily is apply for --lazy, leaving out the fields not in need.
+func (s source) applyLazily(obj *map[string]interface{}, need map[string]bool) {
+	start := time.Now()
+	switch {
+	case s.mounts != nil:
+		if !anyNeeded(s.mounts(), need) {
+			timing("skip "+s.arg, start)
+			return
+		}
+		s.apply(obj)
+	case strings.HasPrefix(s.arg, "--"):
+		name := argKey(s.arg)
+		if end := strings.IndexAny(name, ".["); end != -1 {
+			name = name[:end]
+		}
+		if need[name] {
+			s.apply(obj)
+		}
+		return
+	case fileFormat(s.arg) == "json" && !isURL(s.arg) && !isObjectURI(s.arg):
+		if s.skipped() {
+			return
+		}
+		f, err := os.Open(s.arg)
+		orExit(err)
+		defer f.Close()
+		layer := map[string]interface{}{}
+		if err := decodeJSONLazily(json.NewDecoder(f), layer, need); err != nil {
+			orExit(fmt.Errorf("%s: %v", s.arg, err))
+		}
+		if isOpenAPI(layer) && !isWriteBack(s.arg) {
+			// Its $refs may point anywhere in it.
+			s.apply(obj)
+			break
+		}
+		noteSecrets(&layer)
+		options.combine(*obj, layer)
+	default:
+		s.apply(obj)
+	}
+	for k := range *obj {
+		if !need[k] {
+			delete(*obj, k)
+		}
+	}
+	timing("decode "+s.arg, start)
+}
+
+func anyNeeded(fields []string, need map[string]bool) bool {
+	for _, f := range fields {
+		if need[f] {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeJSONLazily decodes the JSON object in dec into layer, but only the
+// fields in need, and the version of an OpenAPI spec. The rest are read past
+// without building anything.
+func decodeJSONLazily(dec *json.Decoder, layer map[string]interface{}, need map[string]bool) error {
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("the document is not an object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name := tok.(string)
+		if !need[name] && name != "openapi" && name != "swagger" {
+			// Decoding into an empty struct skips the value, whatever it is,
+			// and complains only if it isn't an object.
+			if err := dec.Decode(&struct{}{}); err != nil {
+				if _, ok := err.(*json.UnmarshalTypeError); !ok {
+					return err
+				}
+			}
+			continue
+		}
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		layer[name] = value
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// warnUnused warns about the top-level fields in obj that no template uses,
+// which are likely to be misspelled.
+func warnUnused(ctx context.Context, obj map[string]interface{}) error {
+	used, err := templateFields(ctx)
+	if err != nil || used == nil {
+		return err
+	}
+	var unused []string
+	for k := range obj {
+		if !used[k] {
+			unused = append(unused, k)
+		}
+	}
+	sort.Strings(unused)
+	for _, k := range unused {
+		warnf("%s is never used by the templates", k)
+	}
+	return nil
+}
+
+// warnShadowed warns about each long option given whose name is also a
+// top-level field the templates use but obj lacks: before there were
+// options, "--timeout=5s" set the field timeout, and now it sets the option.
+func warnShadowed(ctx context.Context, obj map[string]interface{}) {
+	if len(longOptions) == 0 {
+		return
+	}
+	used, err := templateFields(ctx)
+	if err != nil || used == nil {
+		// Rendering reports a template that does not parse.
+		return
+	}
+	warned := map[string]bool{}
+	for _, name := range longOptions {
+		key := strings.TrimPrefix(name, "--")
+		if _, ok := obj[key]; ok || !used[key] || warned[key] {
+			continue
+		}
+		warned[key] = true
+		warnf("%s sets the option, not the field %s the templates use; set that with --.%s=VALUE", name, key, key)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+var funcsUsage = `Usage: tmplcute funcs [NAME]*
+
+funcs lists the functions tmplcute adds to templates, with how each is called
+and what it does, or just the NAMEd ones. Those text/template has built in,
+like index, len and printf, are documented with it. The exit status is 1 if a
+NAME isn't a function.
+`
+
+func listFuncs(args []string) {
+	for _, arg := range args {
+		if len(arg) > 0 && arg[0] == '-' {
+			fmt.Fprintln(os.Stderr, funcsUsage)
+			os.Exit(2)
+		}
+	}
+	byName := map[string]tmplFunc{}
+	for _, f := range allFuncs() {
+		byName[f.name] = f
+	}
+	names := args
+	if len(names) == 0 {
+		for name := range byName {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	missing := false
+	for _, name := range names {
+		f, ok := byName[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "%s is not a function\n", name)
+			missing = true
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", f.signature(), f.usage)
+	}
+	tw.Flush()
+	if missing {
+		os.Exit(1)
+	}
+}
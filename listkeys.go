@@ -0,0 +1,90 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var keysUsage = `Usage: tmplcute keys [--prefix=PREFIX] [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+
+keys builds the object from its arguments the same way tmplcute does, and
+prints every KEY in it, one per line, or just those starting with PREFIX. It
+is meant for shell completion of --KEY=VALUE, where what has been typed so
+far is the PREFIX, with or without its "--". In bash, for example:
+
+  _tmplcute() {
+    COMPREPLY=($(tmplcute keys config.yaml --prefix="$2" | sed 's/^/--/'))
+  }
+  complete -o nospace -F _tmplcute tmplcute
+`
+
+func listKeys(args []string) {
+	prefix := ""
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-h":
+			fmt.Fprintln(os.Stderr, keysUsage)
+			os.Exit(2)
+		case strings.HasPrefix(arg, "--prefix="):
+			prefix = strings.TrimPrefix(arg, "--prefix=")
+		case arg == "--prefix" && i+1 < len(args):
+			i++
+			prefix = args[i]
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	prefix = strings.TrimPrefix(prefix, "--")
+
+	obj := map[string]interface{}{}
+	for _, src := range sources(rest) {
+		src.apply(&obj)
+	}
+	for _, key := range allKeys("", jsonable(obj), nil) {
+		if strings.HasPrefix(key, prefix) {
+			fmt.Println(key)
+		}
+	}
+}
+
+// allKeys appends the KEY of everything in v, which is at path, to keys:
+// maps and lists as well as what they hold.
+func allKeys(path string, v interface{}, keys []string) []string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			key := fieldPath(path, name)
+			keys = allKeys(key, v[name], append(keys, key))
+		}
+	case []interface{}:
+		for i, elem := range v {
+			key := indexPath(path, i)
+			keys = allKeys(key, elem, append(keys, key))
+		}
+	}
+	return keys
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/skelterjohn/tmplcute/keys"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--list-vars"},
+		usage: "instead of executing the templates, print every KEY they use, noting the ones the object doesn't have",
+		set: func(string) error {
+			options.listVars = true
+			return nil
+		},
+	})
+}
+
+// listVars prints every path into obj that the templates to be rendered
+// use, like .items[].name, noting the ones obj doesn't have.
+func listVars(ctx context.Context, obj interface{}, w io.Writer) error {
+	texts, err := templateTexts(ctx)
+	if err != nil {
+		return err
+	}
+	paths := map[string][]string{}
+	for name, text := range texts {
+		tmpl, err := template.New(name).Funcs(funcMap()).Parse(text)
+		if err != nil {
+			return err
+		}
+		vw := &varWalker{tmpl: tmpl, paths: paths}
+		vw.walk(tmpl.Tree.Root, []string{}, map[string][]string{"$": {}})
+	}
+
+	var keys []string
+	for key := range paths {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if has(reflect.ValueOf(obj), paths[key]) {
+			fmt.Fprintln(w, key)
+		} else {
+			fmt.Fprintln(w, key, "(missing)")
+		}
+	}
+	return nil
+}
+
+// A varWalker follows the paths into the object through a template. A path
+// is its field names, with "[]" for each element ranged over; a nil path
+// means it isn't known what dot is.
+type varWalker struct {
+	tmpl  *template.Template
+	paths map[string][]string
+	// calls are how deep the walk is in {{template}}s, to stop recursive
+	// ones.
+	calls int
+}
+
+func (vw *varWalker) use(path []string) {
+	if len(path) == 0 {
+		return
+	}
+	key := ""
+	for _, step := range path {
+		if step == "[]" {
+			key += step
+		} else {
+			key += "." + step
+		}
+	}
+	vw.paths[key] = append([]string(nil), path...)
+}
+
+// walk walks node, where dot is at the path dot and vars are the paths of the
+// variables in scope.
+func (vw *varWalker) walk(node parse.Node, dot []string, vars map[string][]string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			vw.walk(child, dot, vars)
+		}
+	case *parse.ActionNode:
+		vw.pipe(n.Pipe, dot, vars)
+	case *parse.IfNode:
+		inner := scope(vars)
+		vw.pipe(n.Pipe, dot, inner)
+		vw.walk(n.List, dot, inner)
+		vw.walk(n.ElseList, dot, scope(vars))
+	case *parse.WithNode:
+		inner := scope(vars)
+		path := vw.pipe(n.Pipe, dot, inner)
+		vw.walk(n.List, path, inner)
+		vw.walk(n.ElseList, dot, scope(vars))
+	case *parse.RangeNode:
+		inner := scope(vars)
+		path := vw.pipe(n.Pipe, dot, inner)
+		var elem []string
+		if path != nil {
+			elem = append(append([]string(nil), path...), "[]")
+		}
+		// The pipe's variables are the index and the element, not the
+		// whole pipe.
+		switch len(n.Pipe.Decl) {
+		case 1:
+			inner[n.Pipe.Decl[0].Ident[0]] = elem
+		case 2:
+			inner[n.Pipe.Decl[0].Ident[0]] = nil
+			inner[n.Pipe.Decl[1].Ident[0]] = elem
+		}
+		vw.walk(n.List, elem, inner)
+		vw.walk(n.ElseList, dot, scope(vars))
+	case *parse.TemplateNode:
+		var path []string
+		if n.Pipe != nil {
+			path = vw.pipe(n.Pipe, dot, vars)
+		}
+		if t := vw.tmpl.Lookup(n.Name); t != nil && t.Tree != nil && vw.calls < 10 {
+			vw.calls++
+			vw.walk(t.Tree.Root, path, map[string][]string{"$": path})
+			vw.calls--
+		}
+	}
+}
+
+// pipe walks the pipeline, declaring its variables in vars, and returns the
+// path of what it evaluates to, if that is known.
+func (vw *varWalker) pipe(p *parse.PipeNode, dot []string, vars map[string][]string) []string {
+	var path []string
+	for i, cmd := range p.Cmds {
+		var last []string
+		for _, arg := range cmd.Args {
+			last = vw.arg(arg, dot, vars)
+		}
+		if i == 0 && len(cmd.Args) == 1 {
+			path = last
+		} else {
+			// A function or method was called, so who knows.
+			path = nil
+		}
+	}
+	for _, decl := range p.Decl {
+		vars[decl.Ident[0]] = path
+	}
+	return path
+}
+
+// arg notes the paths used by an argument in a command, and returns the
+// path of the argument itself, if that is known.
+func (vw *varWalker) arg(node parse.Node, dot []string, vars map[string][]string) []string {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		return vw.extend(dot, n.Ident)
+	case *parse.VariableNode:
+		base, ok := vars[n.Ident[0]]
+		if !ok {
+			return nil
+		}
+		return vw.extend(base, n.Ident[1:])
+	case *parse.ChainNode:
+		return vw.extend(vw.arg(n.Node, dot, vars), n.Field)
+	case *parse.PipeNode:
+		return vw.pipe(n, dot, scope(vars))
+	}
+	return nil
+}
+
+// extend notes base with each of fields after it, and returns the whole path.
+func (vw *varWalker) extend(base []string, fields []string) []string {
+	if base == nil {
+		return nil
+	}
+	path := append([]string(nil), base...)
+	for _, f := range fields {
+		path = append(path, f)
+		vw.use(path)
+	}
+	return path
+}
+
+// scope makes a scope for variables inside a control structure, which can
+// see the ones outside.
+func scope(vars map[string][]string) map[string][]string {
+	inner := make(map[string][]string, len(vars))
+	for k, v := range vars {
+		inner[k] = v
+	}
+	return inner
+}
+
+// has reports whether v has something at path. Ranged-over elements only
+// need one of them to have it.
+func has(v reflect.Value, path []string) bool {
+	v = keys.Indirect(v)
+	if len(path) == 0 {
+		return v.IsValid()
+	}
+	switch {
+	case path[0] == "[]":
+		if v.Kind() == reflect.Map {
+			for _, k := range v.MapKeys() {
+				if has(v.MapIndex(k), path[1:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return false
+		}
+		for i := 0; i < v.Len(); i++ {
+			if has(v.Index(i), path[1:]) {
+				return true
+			}
+		}
+		return false
+	}
+	f, ok := keys.Field(v, path[0])
+	return ok && has(f, path[1:])
+}
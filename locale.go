@@ -0,0 +1,196 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A locale says how numbers are written. The last three digits of a whole
+// number are grouped together, and the ones before them in groups of
+// secondary, which is 2 in India's 12,34,567.
+type locale struct {
+	group     string
+	decimal   string
+	secondary int
+}
+
+var locales = map[string]locale{
+	"en":    {",", ".", 3},
+	"en-IN": {",", ".", 2},
+	"ja":    {",", ".", 3},
+	"zh":    {",", ".", 3},
+	"ko":    {",", ".", 3},
+	"de":    {".", ",", 3},
+	"es":    {".", ",", 3},
+	"it":    {".", ",", 3},
+	"nl":    {".", ",", 3},
+	"pt":    {".", ",", 3},
+	"da":    {".", ",", 3},
+	"id":    {".", ",", 3},
+	"tr":    {".", ",", 3},
+	"fr":    {" ", ",", 3},
+	"ru":    {" ", ",", 3},
+	"pl":    {" ", ",", 3},
+	"sv":    {" ", ",", 3},
+	"fi":    {" ", ",", 3},
+	"cs":    {" ", ",", 3},
+	"nb":    {" ", ",", 3},
+	"de-CH": {"’", ".", 3},
+}
+
+// findLocale looks up a locale like "de", "de-DE" or "de_DE.UTF-8", falling
+// back from the region to the language.
+func findLocale(name string) (locale, error) {
+	name = strings.Replace(strings.SplitN(name, ".", 2)[0], "_", "-", -1)
+	if l, ok := locales[name]; ok {
+		return l, nil
+	}
+	if l, ok := locales[strings.SplitN(name, "-", 2)[0]]; ok {
+		return l, nil
+	}
+	known := []string{}
+	for k := range locales {
+		known = append(known, k)
+	}
+	sort.Strings(known)
+	return locale{}, fmt.Errorf("unknown locale %q, try one of %s", name, strings.Join(known, ", "))
+}
+
+func init() {
+	options.tz = time.Local
+	options.locale = locales["en"]
+}
+
+// now is the current time in the --tz zone, or the time given to
+// --deterministic.
+func now() time.Time {
+	if options.now != nil {
+		return options.now.In(options.tz)
+	}
+	return time.Now().In(options.tz)
+}
+
+// parseTime reads an RFC 3339 time or seconds since the epoch.
+func parseTime(s string) (time.Time, error) {
+	when, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		secs, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil {
+			return time.Time{}, err
+		}
+		when = time.Unix(0, int64(secs*float64(time.Second)))
+	}
+	return when, nil
+}
+
+// formatDate formats t in the --tz zone using a Go time layout. t can be a
+// time, an RFC 3339 string, or seconds since the epoch (even as a string).
+func formatDate(layout string, t interface{}) (string, error) {
+	var when time.Time
+	switch t := t.(type) {
+	case time.Time:
+		when = t
+	case string:
+		var err error
+		if when, err = parseTime(t); err != nil {
+			return "", err
+		}
+	default:
+		secs, ok := number(t)
+		if !ok {
+			return "", fmt.Errorf("cannot use %T as a date", t)
+		}
+		when = time.Unix(0, int64(secs*float64(time.Second)))
+	}
+	return when.In(options.tz).Format(layout), nil
+}
+
+// formatNumber writes a number with the --locale's separators. It is called
+// as "number VALUE" or "number DECIMALS VALUE".
+func formatNumber(args ...interface{}) (string, error) {
+	prec := -1
+	switch len(args) {
+	case 1:
+	case 2:
+		p, ok := number(args[0])
+		if !ok {
+			return "", fmt.Errorf("decimals must be a number, not %T", args[0])
+		}
+		prec = int(p)
+	default:
+		return "", fmt.Errorf("number takes a value and optionally the decimals, not %d arguments", len(args))
+	}
+	v := args[len(args)-1]
+
+	var digits string
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		digits = strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		digits = strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		digits = strconv.FormatFloat(rv.Float(), 'f', prec, 64)
+	case reflect.String:
+		f, err := strconv.ParseFloat(rv.String(), 64)
+		if err != nil {
+			return "", err
+		}
+		digits = strconv.FormatFloat(f, 'f', prec, 64)
+	default:
+		return "", fmt.Errorf("cannot use %T as a number", v)
+	}
+	if prec > 0 && !strings.Contains(digits, ".") {
+		digits += "." + strings.Repeat("0", prec)
+	}
+
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	whole, frac := digits, ""
+	if dot := strings.Index(digits, "."); dot != -1 {
+		whole, frac = digits[:dot], digits[dot+1:]
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, c := range whole {
+		if i != 0 && groupStarts(len(whole)-i, options.locale.secondary) {
+			b.WriteString(options.locale.group)
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteString(options.locale.decimal)
+		b.WriteString(frac)
+	}
+	return b.String(), nil
+}
+
+// groupStarts reports whether a group separator goes before the digit that
+// is n digits from the end of a whole number, counting itself.
+func groupStarts(n, secondary int) bool {
+	if n <= 3 {
+		return n == 3
+	}
+	return (n-3)%secondary == 0
+}
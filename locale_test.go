@@ -0,0 +1,54 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import "testing"
+
+func TestFormatNumber(t *testing.T) {
+	defer func(l locale) { options.locale = l }(options.locale)
+
+	tests := []struct {
+		locale string
+		args   []interface{}
+		want   string
+	}{
+		{"en", []interface{}{1234567}, "1,234,567"},
+		{"en", []interface{}{2, -1234.5}, "-1,234.50"},
+		{"en", []interface{}{999}, "999"},
+		{"de", []interface{}{2, 1234567.891}, "1.234.567,89"},
+		{"fr", []interface{}{"1234"}, "1\u202f234"},
+		{"en-IN", []interface{}{1234567}, "12,34,567"},
+		{"en-IN", []interface{}{123456789}, "12,34,56,789"},
+		{"en-IN", []interface{}{2, -12345.678}, "-12,345.68"},
+		{"en-IN", []interface{}{1000}, "1,000"},
+		{"en-IN", []interface{}{100}, "100"},
+		{"en_IN.UTF-8", []interface{}{100000}, "1,00,000"},
+	}
+	for _, test := range tests {
+		l, err := findLocale(test.locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		options.locale = l
+		got, err := formatNumber(test.args...)
+		if err != nil {
+			t.Errorf("%s: number %v: %v", test.locale, test.args, err)
+		} else if got != test.want {
+			t.Errorf("%s: number %v = %q, want %q", test.locale, test.args, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// A logLevel is how much a diagnostic matters. The zero value, debug, shows
+// everything.
+type logLevel int
+
+const (
+	logDebug logLevel = iota
+	logInfo
+	logWarn
+)
+
+var logLevels = []string{"debug", "info", "warn"}
+
+func (l logLevel) String() string {
+	return logLevels[l]
+}
+
+func init() {
+	optionTable = append(optionTable,
+		option{
+			names: []string{"--log-format"},
+			value: "FORMAT",
+			usage: `print warnings, --timings and --trace on stderr as "text", the default, or as "json", an object per line`,
+			set: func(format string) error {
+				switch format {
+				case "text", "json":
+					options.logJSON = format == "json"
+					return nil
+				}
+				return fmt.Errorf("the log format can be text or json, not %q", format)
+			},
+		},
+		option{
+			names: []string{"--log-level"},
+			value: "LEVEL",
+			usage: `only print diagnostics at LEVEL or above: debug (--trace), info (--timings) or warn (warnings); the default is debug`,
+			set: func(level string) error {
+				for l, name := range logLevels {
+					if name == level {
+						options.logLevel = logLevel(l)
+						return nil
+					}
+				}
+				return fmt.Errorf("the log level can be debug, info or warn, not %q", level)
+			},
+		},
+	)
+}
+
+// logMu keeps the lines of templates rendering at once apart.
+var logMu sync.Mutex
+
+// logMsg prints a diagnostic on stderr, if it is at the --log-level or above.
+// As text, it is prefix and then msg. As json, it is msg with the time, the
+// level, and fields, which go name, value, name, value...
+func logMsg(level logLevel, prefix, msg string, fields ...interface{}) {
+	if level < options.logLevel {
+		return
+	}
+	msg = redact(msg)
+	logMu.Lock()
+	defer logMu.Unlock()
+	if !options.logJSON {
+		fmt.Fprintln(os.Stderr, prefix+msg)
+		return
+	}
+	entry := map[string]interface{}{
+		"time":  time.Now().Format(time.RFC3339Nano),
+		"level": level.String(),
+		"msg":   msg,
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		v := fields[i+1]
+		if s, ok := v.(string); ok {
+			v = redact(s)
+		}
+		entry[fmt.Sprint(fields[i])] = v
+	}
+	json.NewEncoder(os.Stderr).Encode(entry)
+}
+
+// warnf logs a warning.
+func warnf(format string, args ...interface{}) {
+	logMsg(logWarn, "warning: ", fmt.Sprintf(format, args...))
+}
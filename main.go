@@ -14,44 +14,81 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package main
+package tmplcute
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	htemplate "html/template"
-	"io/ioutil"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
-	"text/template"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/rogpeppe/rjson"
-	"github.com/skelterjohn/overwrite"
+	"github.com/skelterjohn/tmplcute/keys"
 	"gopkg.in/yaml.v2"
 )
 
 func orExit(err error) {
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	if err != nil && options.errorsJSON {
+		writeErrorJSON(os.Stderr, err)
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, redact(err.Error()))
 		os.Exit(1)
 	}
 }
 
 var usage = `tmplcute - exercise go's text/template
-Usage: tmplcute [-h] [-w] [ --KEY=VALUE | FILE{.json,.rjson,.yaml} ]*
+Usage: tmplcute [OPTION]* [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+       tmplcute get [-json] KEY [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+       tmplcute set FILE{.json,.rjson,.yaml,.toml} [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+       tmplcute merge OUT{.json,.rjson,.yaml,.toml} [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+       tmplcute diff FILE1{.json,.rjson,.yaml,.toml} FILE2{.json,.rjson,.yaml,.toml}
+       tmplcute validate --schema=SCHEMA [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+       tmplcute test [-update] [-coverage=FILE] DIR
+       tmplcute funcs [NAME]*
+       tmplcute explore [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+       tmplcute keys [--prefix=PREFIX] [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+       tmplcute genstruct [--package=NAME] [--type=NAME] [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+       tmplcute man [-markdown]
 
-tmplcute reads a text/template from stdin, and executes it onto stdout using
-the object build by arguments.
-
-The "-w" flag indicates that "html/template" should be used rather than the
-normal "text/template".
+tmplcute reads a text/template from stdin, or from each "-f TEMPLATE" in
+turn, and executes it onto stdout, or into the "-o PATH" file, using the
+object build by arguments.
 
 KEY/VALUE pairs and FILEs are used to build up the object used for the
 template's execution. The object begins life as a map[string]interface{}, and
 each argument builds it up.
 
-FILE.json and FILE.yaml decode the document onto the object.
+FILE.json, FILE.yaml and FILE.toml decode the document onto the object,
+merging its objects with the ones already there field by field, unless
+"--merge" or "--array-merge" say otherwise. Data sources like --vault and
+--exec-data merge what they load the same way. A FILE can also be an http:// or
+https:// URL, decoded according to its Content-Type or, failing that, its
+extension. URLs are fetched with the "--header"s for their host, and those
+with no HOST if the URL was given as a FILE, -d, -f or --render, and with the
+login for the host from ~/.netrc (or $NETRC) unless there is an Authorization
+header; a redirect to another host gets none of them. s3:// and gs:// objects
+are read with the aws and gcloud tools, using their usual credentials.
+FILE.tfstate is a Terraform state, giving the object outputs.NAME with each
+output's value, and resources.TYPE.NAME with each resource's attributes. An
+OpenAPI or Swagger spec, a document with "openapi" or "swagger" at its top,
+has its $refs replaced by what they point to, in it or in the files next to
+it, except when set or merge write it back. A FILE can be a glob, like
+"configs/*.yaml", for each file it matches in sorted order. In a YAML FILE,
+"key: !include other.yaml" puts the document in other.yaml, next to the FILE,
+at key; each file's anchors are its own. "FILE@KEY", like "db.yaml@database",
+puts the document at KEY instead of at the top of the object.
+
+"-d FILE" is a FILE whatever its name, with "-d-format" to say what it is in,
+and "-d -" reads the document from stdin, when the templates come from "-f",
+"--render" or "-r", so that "kubectl get pod -o json | tmplcute -f pod.tmpl -d -"
+works.
 
 --KEY=VALUE sets a value in the object, using KEY to index into it. The KEYs are
 dotted and indexed. For example, "--foo.bar=baz" will create a 'foo' field if it
@@ -59,86 +96,412 @@ does not already exist, and then give it a 'bar' field with the value "baz". Or,
 "--arr[0]=123" will create an 'arr' field that is a slice, and set its first
 element to the string "123" if it does not already exist, or attempt to match
 its type if it does (types may already have been set by the other decoders).
+"--arr[]=456" appends a new element to 'arr' instead, wherever it ends, with
+the type of the one before it, and "--arr[].x=1" then "--arr[].x=2" make two.
+"--KEY:=VALUE" sets VALUE as JSON instead, whatever was there, so
+"--port:=8080" is a number and --tags:='["a","b"]' a list. "--KEY-" takes the
+value at KEY away instead: a field is deleted, and a list element removed,
+moving the rest down, so "--arr[0]-" drops the first. A KEY spelled like an
+option, such as "--timeout", "--env" or "--output", sets the option instead,
+so it is written with a dot first, like "--.timeout=5s", or comes after a
+lone "--". Options that load data from elsewhere, like "--consul", build up
+the object in their place among the other arguments. Those that tune one,
+like "--vault-key", apply to the one they follow, or to the next if none
+does.
+
+Each "--render=TEMPLATE:OUTPUT" executes the template in the file (or URL or
+object) TEMPLATE and writes the result to OUTPUT, instead of using stdin and
+stdout. Templates writing to .html or .htm files use html/template, and the
+rest use text/template unless --html was given; "--engine" can choose
+differently for any extension. With many of them, up to "--jobs" run at once.
+"--stream=RECORDS" executes the templates once for each JSON record in RECORDS
+instead, writing as it goes. With "--lazy", the templates are read first, and
+the object only gets the top-level fields they mention.
+
+"-r SRC_DIR DST_DIR" executes every file under SRC_DIR as a template, writing
+it to the same path under DST_DIR, with the same permissions, to make a whole
+tree of files at once. Binary files, and those matching a "--raw" GLOB, are
+copied as they are.
+
+A template can start with front matter: lines of "KEY: VALUE" between two
+"---" lines, where "output" is the file to write instead of OUTPUT (under
+DST_DIR, with -r, which it can't leave), "mode" is its permissions in octal,
+and "skip: true" writes nothing. The VALUEs are templates too, so "output:
+hosts/{{.name}}.conf" names the file after the data. Anything else between the
+"---" lines, like a YAML document's fields, means it isn't front matter, and
+the template is left as it is.
+
+Templates can include others. They can also run commands, read files, see the
+environment and fetch URLs, but only if an "--allow-exec", "--allow-file",
+"--allow-env" or "--allow-network" says so. "--sandbox", which --html and
+--serve imply, is for templates that can't be trusted: they can only include
+files under the current directory, unless there is an "--allow-file", and none
+from URLs, unless there is an "--allow-network". Templates from URLs and
+objects, and whatever they include, are always sandboxed. Includes can only be
+nested 100 deep.
+
+"--serve=ADDR" serves the templates over HTTP instead of executing them once.
+Each request gets its own copy of the object, built onto with the request's
+body, a JSON or YAML document, then its query, like "?title=Home&tags[]=new",
+and any "Tmplcute-Set: KEY=VALUE" headers. A KEY ending in ":", like
+"?port:=8080", takes its VALUE as JSON, as --KEY:=VALUE does. A request's KEYs
+can't index past 1000, nor reach more than 10000 elements between them.
+
+"tmplcute get KEY ..." builds the object the same way, and prints the value at
+KEY instead of executing a template.
+
+"tmplcute set FILE ..." decodes FILE, builds onto it with the rest of the
+arguments, and writes it back to FILE in the same format. A YAML FILE with
+!includes is left alone, since writing it back would lose them.
+
+"tmplcute merge OUT ..." builds the object the same way, and writes it to OUT.
+
+"tmplcute diff FILE1 FILE2" prints the KEYs where two documents differ.
+
+"tmplcute validate --schema=SCHEMA ..." builds the object the same way, and
+checks it against the JSON Schema in SCHEMA. A SCHEMA that uses a keyword or
+format the check doesn't support, like "if" or "patternProperties", is
+refused rather than letting anything pass.
+
+"tmplcute test DIR" executes the templates in DIR's cases and compares what
+they print with what is expected. "--coverage=FILE", or "-coverage=FILE" for
+test, counts how many times each action and branch executes, to find the ones
+that never do.
+
+"tmplcute explore ..." builds the object the same way, and lets you browse it
+a level at a time, copying the KEYs of what you find.
+
+"tmplcute keys ..." builds the object the same way, and prints every KEY in
+it, or those starting with "--prefix", for shell completion.
+
+"tmplcute genstruct ..." builds the object the same way, and prints a Go
+struct that can hold it, for moving from maps to types of your own.
+
+"tmplcute funcs" lists the template functions, with how each is called and
+what it does.
+
+"tmplcute man" prints the man page, including every option and template
+function.
 `
 
-func main() {
-	useHtml := false
-	args := []string{}
-	for _, arg := range os.Args[1:] {
-		switch arg {
-		case "-h":
-			fmt.Fprintln(os.Stderr, usage)
-			os.Exit(2)
-		case "-w":
-			useHtml = true
-		default:
-			args = append(args, arg)
+// A command is a tmplcute subcommand, like "tmplcute get".
+type command struct {
+	name  string
+	usage string
+	run   func(args []string)
+}
+
+var commands []command
+
+func init() {
+	// man documents the commands, so this can't be done in the declaration.
+	commands = []command{
+		{"get", getUsage, get},
+		{"set", setUsage, set},
+		{"merge", mergeUsage, merge},
+		{"diff", diffUsage, diff},
+		{"validate", validateUsage, validate},
+		{"test", testUsage, test},
+		{"funcs", funcsUsage, listFuncs},
+		{"explore", exploreUsage, explore},
+		{"keys", keysUsage, listKeys},
+		{"genstruct", genstructUsage, genstruct},
+		{"man", manUsage, man},
+	}
+}
+
+// Main runs tmplcute with the command line in os.Args, exiting if anything
+// goes wrong. It is all of cmd/tmplcute.
+func Main() {
+	if len(os.Args) > 1 {
+		for _, c := range commands {
+			if c.name == os.Args[1] {
+				c.run(os.Args[2:])
+				return
+			}
 		}
 	}
 
-	obj := map[string]interface{}{}
-	for _, arg := range args {
-		processArg(arg, &obj)
+	srcs := sources(os.Args[1:])
+	ctx := context.Background()
+	if options.watch && (options.serve != "" || options.stream != "") {
+		orExit(inStage("options", fmt.Errorf("--watch doesn't go with --serve, which has --reload, or --stream")))
 	}
 
-	data, err := ioutil.ReadAll(os.Stdin)
+	if options.dumpAST {
+		orExit(dumpAST(ctx, os.Stdout))
+		return
+	}
+
+	var need map[string]bool
+	if options.lazy {
+		var err error
+		need, err = neededFields(ctx)
+		orExit(err)
+	}
+
+	stdinSrc, err := stdinSource(srcs)
 	orExit(err)
+	if stdinSrc != nil {
+		srcs = append([]source{*stdinSrc}, srcs...)
+	}
 
-	if useHtml {
-		funcMap := htemplate.FuncMap{
-			"json":  formatJson,
-			"rjson": formatRjson,
-			"yaml":  formatYaml,
+	var ex *explainer
+	if len(options.explain) != 0 {
+		ex = newExplainer()
+	}
+
+	obj := map[string]interface{}{}
+	for _, src := range srcs {
+		if need != nil {
+			src.applyLazily(&obj, need)
+		} else {
+			start := time.Now()
+			src.apply(&obj)
+			if src.load != nil || !strings.HasPrefix(src.arg, "--") {
+				timing("decode "+src.arg, start)
+			}
 		}
-		tmpl, err := htemplate.New("tmplcute").Funcs(funcMap).Parse(string(data))
-		orExit(err)
-		orExit(tmpl.Execute(os.Stdout, obj))
-	} else {
-		funcMap := template.FuncMap{
-			"json":  formatJson,
-			"rjson": formatRjson,
-			"yaml":  formatYaml,
+		if ex != nil {
+			ex.applied(src, &obj)
 		}
-		tmpl, err := template.New("tmplcute").Funcs(funcMap).Parse(string(data))
-		orExit(err)
-		orExit(tmpl.Execute(os.Stdout, obj))
 	}
+
+	if ex != nil {
+		orExit(ex.report(os.Stdout))
+		return
+	}
+
+	if options.listVars {
+		orExit(listVars(ctx, obj, os.Stdout))
+		return
+	}
+
+	orExit(inStage("transform", derive(obj)))
+	obj, err = transform(obj)
+	orExit(inStage("transform", err))
+	orExit(inStage("check", checkObject(ctx, obj)))
+	if options.warnUnused {
+		orExit(warnUnused(ctx, obj))
+	}
+	warnShadowed(ctx, obj)
+
+	switch {
+	case options.serve != "":
+		orExit(serve(ctx, srcs, obj))
+	case options.stream != "":
+		orExit(runStream(ctx, obj))
+	default:
+		orExit(renderAll(ctx, obj))
+	}
+	orExit(writeCoverage())
+	reportProfile()
+	orExit(writeArchive())
+	orExit(writeManifest())
+	orExit(writeEffectiveConfig(ctx, srcs))
+	orExit(prune(srcs))
+	if options.watch {
+		watch(ctx, srcs)
+	}
+}
+
+var stdinText *string
+
+// stdinTemplate reads the template from stdin. It can be called again, to
+// get the same template.
+func stdinTemplate() (string, error) {
+	if stdinText == nil {
+		var size int64
+		if info, err := os.Stdin.Stat(); err == nil && info.Mode().IsRegular() {
+			size = info.Size()
+		}
+		text, err := readText(os.Stdin, size)
+		if err != nil {
+			return "", err
+		}
+		options.stdinUsed = true
+		stdinText = &text
+	}
+	return *stdinText, nil
+}
+
+// readText reads all of r, which is size bytes if that is known, into a
+// string. Unlike ioutil.ReadAll and a conversion, it doesn't need room for
+// two or three copies of a big template along the way.
+func readText(r io.Reader, size int64) (string, error) {
+	var b strings.Builder
+	if size > 0 {
+		b.Grow(int(size))
+	}
+	_, err := io.Copy(&b, r)
+	return b.String(), err
 }
 
 func processArg(arg string, obj interface{}) {
+	orExit(loadArg(context.Background(), arg, obj))
+}
+
+// loadArg builds onto obj with arg, a --KEY=VALUE or a FILE.
+func loadArg(ctx context.Context, arg string, obj interface{}) error {
 	if strings.HasPrefix(arg, "--") {
 		keyval := arg[2:]
 		tokens := strings.SplitN(keyval, "=", 2)
 		if len(tokens) != 2 {
-			fmt.Fprintf(os.Stderr, "value for %q must be in the form of %q\n", arg, arg+"=VALUE")
-			os.Exit(1)
+			if strings.HasSuffix(keyval, "-") {
+				return keys.Delete(obj, strings.TrimSuffix(keyval, "-"))
+			}
+			return fmt.Errorf("value for %q must be in the form of %q", arg, arg+"=VALUE")
 		}
 		key, val := tokens[0], tokens[1]
-		orExit(overwrite.Overwrite(obj, key, val))
-		return
+		if strings.HasSuffix(key, ":") {
+			return configFrom(ctx).overrideJSON(obj, strings.TrimSuffix(key, ":"), val)
+		}
+		return configFrom(ctx).override(obj, key, val)
 	}
-	if strings.HasSuffix(strings.ToLower(arg), ".json") {
-		fin, err := os.Open(arg)
-		orExit(err)
-		orExit(json.NewDecoder(fin).Decode(obj))
-		return
+	arg, namespace := splitNamespace(arg)
+	if m, ok := obj.(*map[string]interface{}); ok && m != nil {
+		// The document is decoded on its own, and then combined with what the
+		// earlier ones built.
+		layer := map[string]interface{}{}
+		if err := cachedDocument(ctx, arg, &layer); err != nil {
+			return err
+		}
+		if namespace != "" {
+			names := strings.Split(namespace, ".")
+			for i := len(names) - 1; i >= 0; i-- {
+				layer = map[string]interface{}{names[i]: layer}
+			}
+		}
+		noteSecrets(&layer)
+		configFrom(ctx).combine(*m, layer)
+		return nil
 	}
-	if strings.HasSuffix(strings.ToLower(arg), ".yaml") {
-		fin, err := os.Open(arg)
-		orExit(err)
-		data, err := ioutil.ReadAll(fin)
-		orExit(err)
-		orExit(yaml.Unmarshal(data, obj))
-		return
+	if namespace != "" {
+		return fmt.Errorf("can't put %s at %s in %T", arg, namespace, obj)
 	}
-	if strings.HasSuffix(strings.ToLower(arg), ".rjson") {
-		fin, err := os.Open(arg)
-		orExit(err)
-		orExit(rjson.NewDecoder(fin).Decode(obj))
-		return
+	return loadDocument(ctx, arg, obj)
+}
+
+// argKey is the KEY that arg, a --KEY=VALUE, --KEY:=VALUE or --KEY-, is
+// about.
+func argKey(arg string) string {
+	tokens := strings.SplitN(arg[2:], "=", 2)
+	if len(tokens) == 1 {
+		return strings.TrimSuffix(tokens[0], "-")
+	}
+	return strings.TrimSuffix(tokens[0], ":")
+}
+
+// splitNamespace breaks a FILE@KEY apart, into the FILE and the dotted KEY
+// its document goes at. If arg isn't one, it is the FILE, and KEY is "".
+func splitNamespace(arg string) (file, key string) {
+	at := strings.LastIndex(arg, "@")
+	if at == -1 || strings.ContainsAny(arg[at+1:], "/:") {
+		return arg, ""
+	}
+	file, key = arg[:at], arg[at+1:]
+	if key == "" || strings.Contains(key, "..") || key[0] == '.' || key[len(key)-1] == '.' {
+		return arg, ""
+	}
+	if fileFormat(file) == "" && !isURL(file) && !isObjectURI(file) {
+		return arg, ""
+	}
+	if _, err := os.Stat(arg); err == nil {
+		// A file with an @ in its name.
+		return arg, ""
 	}
-	fmt.Fprintf(os.Stderr, "don't know what to do with %q\n", arg)
-	os.Exit(1)
+	return file, key
+}
+
+// loadDocument decodes the document in the FILE, URL or object arg onto obj.
+func loadDocument(ctx context.Context, arg string, obj interface{}) error {
+	if isURL(arg) {
+		return fetchDocument(ctx, arg, obj)
+	}
+	if isObjectURI(arg) {
+		return fetchObjectDocument(ctx, arg, obj)
+	}
+	return loadFile(arg, obj)
+}
+
+// loadFile decodes the document in the file at path onto obj, according to
+// its extension.
+func loadFile(path string, obj interface{}) error {
+	format := fileFormat(path)
+	if format == "" {
+		return fmt.Errorf("don't know what to do with %q", path)
+	}
+	var r io.Reader
+	if format == "yaml" {
+		text, err := readYAML(path)
+		if err != nil {
+			return err
+		}
+		r = strings.NewReader(text)
+	} else {
+		fin, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer fin.Close()
+		r = fin
+	}
+	if err := decode(format, r, obj); err != nil {
+		return err
+	}
+	if m, ok := obj.(*map[string]interface{}); ok && isOpenAPI(*m) && !isWriteBack(path) {
+		return resolveOpenAPI(path, m)
+	}
+	return nil
+}
+
+// isWriteBack reports whether path is the options.writeBack file.
+func isWriteBack(path string) bool {
+	if options.writeBack == "" {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	return err == nil && abs == options.writeBack
+}
+
+// decode decodes the document in r, which is in the given format, onto obj.
+func decode(format string, r io.Reader, obj interface{}) error {
+	switch format {
+	case "json":
+		return json.NewDecoder(r).Decode(obj)
+	case "yaml":
+		// An empty document is nothing to add, not an error.
+		if err := yaml.NewDecoder(r).Decode(obj); err != io.EOF {
+			return err
+		}
+		return nil
+	case "rjson":
+		return rjson.NewDecoder(r).Decode(obj)
+	case "toml":
+		_, err := toml.NewDecoder(r).Decode(obj)
+		return err
+	case "tfstate":
+		return decodeTfstate(r, obj)
+	}
+	return fmt.Errorf("don't know how to decode %s", format)
+}
+
+// fileFormat returns the format of the document at path, judging by its
+// extension, or "" if it isn't one tmplcute knows.
+func fileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yaml":
+		return "yaml"
+	case ".rjson":
+		return "rjson"
+	case ".toml":
+		return "toml"
+	case ".tfstate":
+		return "tfstate"
+	}
+	return ""
 }
 
 func formatJson(obj interface{}) (string, error) {
@@ -165,3 +528,15 @@ func formatYaml(obj interface{}) (string, error) {
 	data, err := yaml.Marshal(obj)
 	return string(data), err
 }
+
+// formatToml formats obj, which has to be a map, since a TOML document is a
+// table.
+func formatToml(obj interface{}) (string, error) {
+	m, ok := jsonable(obj).(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("toml can only format a map, not %T", obj)
+	}
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(m)
+	return buf.String(), err
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadArgJSON(t *testing.T) {
+	defer func(values map[string]bool) {
+		secrets.values, secrets.replacer = values, nil
+	}(secrets.values)
+	secrets.values, secrets.replacer = map[string]bool{}, nil
+	defer func(strict bool) { options.strictTypes = strict }(options.strictTypes)
+	options.strictTypes = true
+
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"--n:=5", `{"n":5,"s":"x"}`},
+		{"--s:=5", `{"n":1,"s":5}`},
+		{"--s:=null", `{"n":1,"s":null}`},
+		{`--list:=[1,"two",{"three":3}]`, `{"list":[1,"two",{"three":3}],"n":1,"s":"x"}`},
+		{`--a.b:={"c":true}`, `{"a":{"b":{"c":true}},"n":1,"s":"x"}`},
+		{`--n:="5"`, `{"n":"5","s":"x"}`},
+		{"--s:=five", ``},
+		{"--s:=", ``},
+		{"--n=five", ``},
+		{"--n=5", `{"n":5,"s":"x"}`},
+	}
+	for _, test := range tests {
+		obj := map[string]interface{}{"n": 1.0, "s": "x"}
+		err := loadArg(context.Background(), test.arg, &obj)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s gave no error", test.arg)
+			} else if obj["n"] != 1.0 || obj["s"] != "x" {
+				t.Errorf("%s changed the object to %v as it failed", test.arg, obj)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.arg, err)
+			continue
+		}
+		got, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%s gave %s, want %s", test.arg, got, test.want)
+		}
+	}
+
+	obj := map[string]interface{}{}
+	if err := loadArg(context.Background(), `--db.password:={"value":"hunter22"}`, &obj); err != nil {
+		t.Fatal(err)
+	}
+	if got := redact("hunter22"); got != "[redacted]" {
+		t.Errorf("a secret set with := isn't redacted: got %q", got)
+	}
+}
+
+func TestLoadArgDelete(t *testing.T) {
+	const doc = `{"a":{"b":1,"c":2},"list":[1,2,3],"s":"x"}`
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"--s-", `{"a":{"b":1,"c":2},"list":[1,2,3]}`},
+		{"--a.b-", `{"a":{"c":2},"list":[1,2,3],"s":"x"}`},
+		{"--a-", `{"list":[1,2,3],"s":"x"}`},
+		{"--list[0]-", `{"a":{"b":1,"c":2},"list":[2,3],"s":"x"}`},
+		{"--list[9]-", doc},
+		{"--missing.deeper-", doc},
+		{"--list[]-", ``},
+		{"--s.t-", ``},
+		{"--s", ``},
+	}
+	for _, test := range tests {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(doc), &obj); err != nil {
+			t.Fatal(err)
+		}
+		err := loadArg(context.Background(), test.arg, &obj)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s gave no error", test.arg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.arg, err)
+			continue
+		}
+		got, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%s gave %s, want %s", test.arg, got, test.want)
+		}
+	}
+}
+
+func TestArgKey(t *testing.T) {
+	tests := []struct {
+		arg, want string
+	}{
+		{"--a.b=1", "a.b"},
+		{"--a.b:=1", "a.b"},
+		{"--a.b-", "a.b"},
+		{"--a-b=1", "a-b"},
+		{"--list[0]-", "list[0]"},
+		{"--x=a-", "x"},
+	}
+	for _, test := range tests {
+		if got := argKey(test.arg); got != test.want {
+			t.Errorf("argKey(%q) = %q, want %q", test.arg, got, test.want)
+		}
+	}
+}
+
+func TestSourceSettings(t *testing.T) {
+	defer func(given []string) { givenOptions = given }(givenOptions)
+
+	srcs, err := parseOptions([]string{
+		"--prom-key", "w", "--prom=a", "--prom=b", "--prom-key=y", "--prom=c",
+		"--exec-data", "echo a = 1", "--exec-format=toml",
+		"--exec-data", "echo 'b: 2'", "--exec-format=yaml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srcs) != 5 {
+		t.Fatalf("got %d sources, want 5", len(srcs))
+	}
+	for i, want := range []string{"w", "y", "prom"} {
+		if got := srcs[i].mounts(); len(got) != 1 || got[0] != want {
+			t.Errorf("%s mounts %q, want %q", srcs[i].arg, got, want)
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	obj := map[string]interface{}{}
+	for _, src := range srcs[3:] {
+		if err := src.add(context.Background(), &obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":1,"b":2}`; string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestDottedKeyArg(t *testing.T) {
+	defer func(timeout time.Duration) { options.timeout = timeout }(options.timeout)
+	defer func(given []string) { givenOptions = given }(givenOptions)
+
+	srcs, err := parseOptions([]string{"--.timeout=5s", "--.env:=true", "--.output-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var args []string
+	for _, src := range srcs {
+		args = append(args, src.arg)
+	}
+	if got, want := strings.Join(args, " "), "--timeout=5s --env:=true --output-"; got != want {
+		t.Errorf("got sources %q, want %q", got, want)
+	}
+	if options.timeout == 5*time.Second {
+		t.Errorf("--.timeout=5s set --timeout")
+	}
+}
+
+func TestReglob(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(`{}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.json")
+	glob := filepath.Join(dir, "*.json")
+	srcs := append(argSources("--x=1"), argSources(glob)...)
+	srcs = append(srcs, argSources("--y=2")...)
+
+	write("b.json")
+	var args []string
+	for _, src := range reglob(srcs) {
+		args = append(args, strings.TrimPrefix(src.arg, dir+string(filepath.Separator)))
+	}
+	if got, want := strings.Join(args, " "), "--x=1 a.json b.json --y=2"; got != want {
+		t.Errorf("got sources %q, want %q", got, want)
+	}
+}
+
+func TestWatchStdinData(t *testing.T) {
+	defer func(given []string) { givenOptions = given }(givenOptions)
+	defer func(files []string, dataStdin bool) {
+		options.files, options.dataStdin = files, dataStdin
+	}(options.files, options.dataStdin)
+	defer func(stdin *os.File) { os.Stdin = stdin }(os.Stdin)
+
+	stdin := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(stdin, []byte(`{"x":1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	os.Stdin = f
+
+	srcs, err := parseOptions([]string{"-f", "t.tmpl", "-d", "-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// --watch builds the object again from the same sources, after the
+	// first build has drained stdin.
+	for i := 0; i < 2; i++ {
+		obj, err := buildObject(context.Background(), srcs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj["x"] != 1.0 {
+			t.Errorf("build %d gave %v, want x 1", i, obj)
+		}
+	}
+}
+
+func TestWarnShadowed(t *testing.T) {
+	defer func(given, long []string) { givenOptions, longOptions = given, long }(givenOptions, longOptions)
+	defer func(files []string, output string, timeout time.Duration) {
+		options.files, options.output, options.timeout = files, output, timeout
+	}(options.files, options.output, options.timeout)
+	defer func(stderr *os.File) { os.Stderr = stderr }(os.Stderr)
+
+	dir := t.TempDir()
+	tmpl := filepath.Join(dir, "t.tmpl")
+	if err := os.WriteFile(tmpl, []byte("{{.timeout}} {{.name}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		args []string
+		warn string
+	}{
+		{[]string{"--timeout=5s", "--name=x"}, "warning: --timeout sets the option, not the field timeout the templates use; set that with --.timeout=VALUE\n"},
+		{[]string{"--timeout=5s", "--.timeout=5s"}, ""},
+		{[]string{"--output=out", "--.timeout=5s"}, ""},
+	} {
+		longOptions = nil
+		srcs, err := parseOptions(append([]string{"-f", tmpl}, test.args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj, err := buildObject(context.Background(), srcs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stderr, err := os.Create(filepath.Join(dir, "stderr"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stderr = stderr
+		warnShadowed(context.Background(), obj)
+		stderr.Close()
+		got, err := os.ReadFile(stderr.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.warn {
+			t.Errorf("%q warned %q, want %q", test.args, got, test.warn)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+var manUsage = `Usage: tmplcute man [-markdown]
+
+man prints tmplcute's man page, generated from the options, commands and
+template functions built into this binary, so it is never out of date. The
+"-markdown" flag prints the same reference as markdown instead of roff.
+`
+
+func man(args []string) {
+	markdown := false
+	for _, arg := range args {
+		switch arg {
+		case "-markdown":
+			markdown = true
+		default:
+			fmt.Fprintln(os.Stderr, manUsage)
+			os.Exit(2)
+		}
+	}
+	if markdown {
+		fmt.Print(markdownPage())
+	} else {
+		fmt.Print(manPage())
+	}
+}
+
+// splitUsage breaks a usage string into its title (if it has one), its
+// "Usage:" lines, and its paragraphs of description.
+func splitUsage(u string) (title string, synopsis []string, paragraphs []string) {
+	paragraphs = strings.Split(strings.TrimSpace(u), "\n\n")
+	for _, line := range strings.Split(paragraphs[0], "\n") {
+		if strings.HasPrefix(line, "Usage:") || strings.HasPrefix(line, " ") {
+			synopsis = append(synopsis, strings.TrimSpace(strings.TrimPrefix(line, "Usage:")))
+		} else {
+			title = line
+		}
+	}
+	return title, synopsis, paragraphs[1:]
+}
+
+// roff escapes s for use in a man page.
+func roff(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func manPage() string {
+	var b strings.Builder
+	title, synopsis, paragraphs := splitUsage(usage)
+	fmt.Fprintln(&b, ".TH TMPLCUTE 1")
+	fmt.Fprintln(&b, ".SH NAME")
+	fmt.Fprintln(&b, strings.Replace(roff(title), " - ", ` \- `, 1))
+	fmt.Fprintln(&b, ".SH SYNOPSIS")
+	fmt.Fprintln(&b, ".nf")
+	for _, line := range synopsis {
+		fmt.Fprintln(&b, roff(line))
+	}
+	fmt.Fprintln(&b, ".fi")
+	fmt.Fprintln(&b, ".SH DESCRIPTION")
+	for i, p := range paragraphs {
+		if i != 0 {
+			fmt.Fprintln(&b, ".PP")
+		}
+		fmt.Fprintln(&b, roff(p))
+	}
+	fmt.Fprintln(&b, ".SH OPTIONS")
+	for _, o := range optionTable {
+		fmt.Fprintln(&b, ".TP")
+		fmt.Fprintln(&b, ".B "+roff(o.spelling()))
+		fmt.Fprintln(&b, roff(o.usage))
+	}
+	fmt.Fprintln(&b, ".SH COMMANDS")
+	for _, c := range commands {
+		_, synopsis, paragraphs := splitUsage(c.usage)
+		fmt.Fprintln(&b, ".SS "+c.name)
+		fmt.Fprintln(&b, ".nf")
+		for _, line := range synopsis {
+			fmt.Fprintln(&b, roff(line))
+		}
+		fmt.Fprintln(&b, ".fi")
+		for _, p := range paragraphs {
+			fmt.Fprintln(&b, ".PP")
+			fmt.Fprintln(&b, roff(p))
+		}
+	}
+	fmt.Fprintln(&b, ".SH FUNCTIONS")
+	for _, f := range allFuncs() {
+		fmt.Fprintln(&b, ".TP")
+		fmt.Fprintln(&b, ".B "+roff(f.signature()))
+		fmt.Fprintln(&b, roff(f.usage))
+	}
+	return b.String()
+}
+
+func markdownPage() string {
+	var b strings.Builder
+	title, synopsis, paragraphs := splitUsage(usage)
+	fmt.Fprintf(&b, "# %s #\n\n", title)
+	fmt.Fprintf(&b, "```\n%s\n```\n", strings.Join(synopsis, "\n"))
+	for _, p := range paragraphs {
+		fmt.Fprintf(&b, "\n%s\n", p)
+	}
+	fmt.Fprintf(&b, "\n## Options ##\n\n")
+	for _, o := range optionTable {
+		fmt.Fprintf(&b, "* `%s` %s\n", o.spelling(), o.usage)
+	}
+	fmt.Fprintf(&b, "\n## Commands ##\n")
+	for _, c := range commands {
+		_, synopsis, paragraphs := splitUsage(c.usage)
+		fmt.Fprintf(&b, "\n### %s ###\n\n", c.name)
+		fmt.Fprintf(&b, "```\n%s\n```\n", strings.Join(synopsis, "\n"))
+		for _, p := range paragraphs {
+			fmt.Fprintf(&b, "\n%s\n", p)
+		}
+	}
+	fmt.Fprintf(&b, "\n## Functions ##\n\n")
+	for _, f := range allFuncs() {
+		fmt.Fprintf(&b, "* `%s` %s\n", f.signature(), f.usage)
+	}
+	return b.String()
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--manifest"},
+		value: "FILE",
+		usage: "write a JSON list of every file that was rendered, with its size and SHA-256, to FILE",
+		set: func(file string) error {
+			options.manifest = file
+			return nil
+		},
+	})
+}
+
+// A manifestEntry is a file that was rendered.
+type manifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// written is every file rendered so far, by path.
+var written = struct {
+	sync.Mutex
+	files map[string]manifestEntry
+}{files: map[string]manifestEntry{}}
+
+func noteWritten(path string, size int64, sum hash.Hash) {
+	written.Lock()
+	written.files[path] = manifestEntry{path, size, hex.EncodeToString(sum.Sum(nil))}
+	written.Unlock()
+}
+
+// resetWritten forgets the files rendered so far, before --watch renders
+// them all again.
+func resetWritten() {
+	written.Lock()
+	written.files = map[string]manifestEntry{}
+	written.Unlock()
+}
+
+// writeOutput writes data to the file path, making its directory if need
+// be, and noting it for the manifest. A mode other than 0 is given to the
+// file even if it already exists. With --archive, it goes in that instead.
+func writeOutput(path string, data []byte, mode os.FileMode) error {
+	var err error
+	if options.archive != "" {
+		err = archiveFile(path, data, mode)
+	} else {
+		err = writeFile(path, data, mode)
+	}
+	if err != nil {
+		return err
+	}
+	sum := sha256.New()
+	sum.Write(data)
+	noteWritten(path, int64(len(data)), sum)
+	return nil
+}
+
+func writeFile(path string, data []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	if mode != 0 {
+		return os.Chmod(path, mode)
+	}
+	return nil
+}
+
+// createOutput creates the file path to write output to a bit at a time,
+// making its directory if need be, and giving it mode if that isn't 0. With
+// --archive, what is written goes in that once it is closed.
+func createOutput(path string, mode os.FileMode) (io.WriteCloser, error) {
+	if options.archive != "" {
+		return &archiveWriter{path: path, mode: mode}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := f.Chmod(mode); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// A countingWriter is for output written a bit at a time, as --stream does,
+// keeping the size and hash for the manifest as it goes.
+type countingWriter struct {
+	w    io.Writer
+	path string
+	size int64
+	sum  hash.Hash
+}
+
+func newCountingWriter(w io.Writer, path string) *countingWriter {
+	return &countingWriter{w: w, path: path, sum: sha256.New()}
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.size += int64(n)
+	c.sum.Write(p[:n])
+	return n, err
+}
+
+// done notes the file for the manifest, once it is all written.
+func (c *countingWriter) done() {
+	noteWritten(c.path, c.size, c.sum)
+}
+
+// writeManifest writes the --manifest file, listing the rendered files in
+// order of their paths.
+func writeManifest() error {
+	if options.manifest == "" {
+		return nil
+	}
+	written.Lock()
+	defer written.Unlock()
+	files := make([]manifestEntry, 0, len(written.files))
+	for _, e := range written.files {
+		files = append(files, e)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	data, err := json.MarshalIndent(map[string]interface{}{"files": files}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(options.manifest, append(data, '\n'), 0644)
+}
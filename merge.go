@@ -0,0 +1,58 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var mergeUsage = `Usage: tmplcute merge OUT{.json,.rjson,.yaml,.toml} [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+
+merge builds the object from its arguments exactly the way tmplcute does
+before executing a template, and writes it to OUT in the format given by its
+extension. Use it to check what a template will see.
+`
+
+func merge(args []string) {
+	if len(args) == 0 || args[0] == "-h" {
+		fmt.Fprintln(os.Stderr, mergeUsage)
+		os.Exit(2)
+	}
+	path := args[0]
+	format := fileFormat(path)
+	if format == "" {
+		fmt.Fprintf(os.Stderr, "don't know how to write %q\n", path)
+		os.Exit(1)
+	}
+	// OUT may be one of the FILEs, as with "merge spec.yaml spec.yaml".
+	abs, err := filepath.Abs(path)
+	orExit(err)
+	options.writeBack = abs
+
+	obj := map[string]interface{}{}
+	for _, src := range sources(args[1:]) {
+		src.apply(&obj)
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	orExit(writeDocument(path, format, obj, perm))
+}
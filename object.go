@@ -0,0 +1,76 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// isObjectURI reports whether arg names an object in S3 or GCS.
+func isObjectURI(arg string) bool {
+	return strings.HasPrefix(arg, "s3://") || strings.HasPrefix(arg, "gs://")
+}
+
+// readObject returns the contents of an s3:// or gs:// object. It uses the
+// aws and gcloud tools, so credentials are found the same way they always
+// are: the environment, config files, or the instance's service account.
+func readObject(ctx context.Context, uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "s3://") {
+		return cachedTool(ctx, "aws", "s3", "cp", uri, "-")
+	}
+	return cachedTool(ctx, "gcloud", "storage", "cat", uri)
+}
+
+// fetchObjectDocument decodes the document in an s3:// or gs:// object onto
+// obj, according to its extension.
+func fetchObjectDocument(ctx context.Context, uri string, obj interface{}) error {
+	format := fileFormat(uri)
+	if format == "" {
+		return fmt.Errorf("don't know how to decode %q", uri)
+	}
+	data, err := readObject(ctx, uri)
+	if err != nil {
+		return err
+	}
+	if err := decode(format, bytes.NewReader(data), obj); err != nil {
+		return fmt.Errorf("%s: %v", uri, err)
+	}
+	return nil
+}
+
+// runTool runs a command, giving up after --timeout, and returns what it
+// wrote to stdout. If it fails, the error includes what it wrote to stderr.
+func runTool(ctx context.Context, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, configFrom(ctx).timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("%s: %s", strings.Join(cmd.Args, " "), msg)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// isOpenAPI reports whether doc is an OpenAPI (or Swagger) spec, by the
+// version at its top, like "openapi: 3.0.0" or "swagger: '2.0'".
+func isOpenAPI(doc map[string]interface{}) bool {
+	for _, name := range []string{"openapi", "swagger"} {
+		switch doc[name].(type) {
+		case string, int, float64:
+			return true
+		}
+	}
+	return false
+}
+
+// resolveOpenAPI replaces the spec doc, from the file at path, with a copy
+// that has every $ref replaced by what it points to, so templates never have
+// to follow them. A $ref that leads back into itself, as recursive schemas
+// do, is left as it is.
+func resolveOpenAPI(path string, doc *map[string]interface{}) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	res := &refResolver{
+		docs:      map[string]interface{}{abs: jsonable(*doc)},
+		resolving: map[string]bool{},
+	}
+	resolved, err := res.resolve(res.docs[abs], abs)
+	if err != nil {
+		return err
+	}
+	*doc = resolved.(map[string]interface{})
+	return nil
+}
+
+// A refResolver replaces $refs, both within a document and into the files
+// next to it.
+type refResolver struct {
+	// docs are the documents read so far, by absolute path.
+	docs map[string]interface{}
+	// resolving are the $refs being replaced, as FILE#POINTER, to catch the
+	// ones that lead back to themselves.
+	resolving map[string]bool
+}
+
+// resolve returns a copy of v, from the document at file, with its $refs
+// replaced.
+func (r *refResolver) resolve(v interface{}, file string) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			return r.resolveRef(v, ref, file)
+		}
+		m := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			resolved, err := r.resolve(elem, file)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = resolved
+		}
+		return m, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, elem := range v {
+			resolved, err := r.resolve(elem, file)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = resolved
+		}
+		return list, nil
+	}
+	return v, nil
+}
+
+// resolveRef replaces the object v, which holds a $ref. Anything alongside
+// the $ref, like a description, is kept.
+func (r *refResolver) resolveRef(v map[string]interface{}, ref, file string) (interface{}, error) {
+	target, targetFile, pointer, err := r.lookup(ref, file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: $ref %q: %v", file, ref, err)
+	}
+	key := targetFile + "#" + pointer
+	if r.resolving[key] {
+		return v, nil
+	}
+	r.resolving[key] = true
+	resolved, err := r.resolve(target, targetFile)
+	delete(r.resolving, key)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := resolved.(map[string]interface{})
+	if !ok || len(v) == 1 {
+		return resolved, nil
+	}
+	merged := make(map[string]interface{}, len(m)+len(v))
+	for k, elem := range m {
+		merged[k] = elem
+	}
+	for k, elem := range v {
+		if k == "$ref" {
+			continue
+		}
+		if merged[k], err = r.resolve(elem, file); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+// lookup finds what ref, found in file, points to, and which file that is in.
+func (r *refResolver) lookup(ref, file string) (target interface{}, targetFile, pointer string, err error) {
+	targetFile = file
+	if hash := strings.Index(ref, "#"); hash != -1 {
+		ref, pointer = ref[:hash], ref[hash+1:]
+	}
+	if ref != "" {
+		if isURL(ref) || isObjectURI(ref) {
+			return nil, "", "", fmt.Errorf("only refs within the spec, or to files next to it, can be followed")
+		}
+		targetFile = filepath.Join(filepath.Dir(file), filepath.FromSlash(ref))
+		if filepath.IsAbs(ref) {
+			targetFile = ref
+		}
+	}
+	doc, ok := r.docs[targetFile]
+	if !ok {
+		if doc, err = readRefFile(targetFile); err != nil {
+			return nil, "", "", err
+		}
+		r.docs[targetFile] = doc
+	}
+	target, err = followPointer(doc, pointer)
+	return target, targetFile, pointer, err
+}
+
+func readRefFile(path string) (interface{}, error) {
+	format := fileFormat(path)
+	if format == "" {
+		return nil, fmt.Errorf("don't know how to decode %q", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var doc interface{}
+	if err := decode(format, f, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return jsonable(doc), nil
+}
+
+// followPointer finds the value at the JSON pointer, like
+// "/components/schemas/Pet", in doc.
+func followPointer(doc interface{}, pointer string) (interface{}, error) {
+	pointer, err := url.PathUnescape(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if pointer == "" {
+		return doc, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%q is not a JSON pointer", pointer)
+	}
+	cur := doc
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			elem, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("no %q at %q", token, pointer)
+			}
+			cur = elem
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("no index %q at %q", token, pointer)
+			}
+			cur = v[i]
+		default:
+			return nil, fmt.Errorf("nothing inside %q at %q", token, pointer)
+		}
+	}
+	return cur, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOpenAPI(t *testing.T) {
+	defer func(writeBack string) { options.writeBack = writeBack }(options.writeBack)
+	dir := t.TempDir()
+	spec := "openapi: 3.0.0\npet:\n  $ref: '#/components/schemas/Pet'\ncomponents:\n  schemas:\n    Pet:\n      type: object\n"
+	writeFiles(t, dir, map[string]string{
+		"api.yaml":           spec,
+		"swagger-notes.yaml": "pet:\n  $ref: '#/components/schemas/Pet'\n",
+	})
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"api.yaml", `{"components":{"schemas":{"Pet":{"type":"object"}}},"openapi":"3.0.0","pet":{"type":"object"}}`},
+		{"swagger-notes.yaml", `{"pet":{"$ref":"#/components/schemas/Pet"}}`},
+	}
+	for _, test := range tests {
+		obj := map[string]interface{}{}
+		if err := loadArg(context.Background(), filepath.Join(dir, test.file), &obj); err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		got, err := json.Marshal(jsonable(obj))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%s gave %s, want %s", test.file, got, test.want)
+		}
+	}
+
+	if err := setFile(filepath.Join(dir, "api.yaml"), []string{"--openapi=3.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "components:\n  schemas:\n    Pet:\n      type: object\nopenapi: 3.0.1\npet:\n  $ref: '#/components/schemas/Pet'\n"
+	if got, err := os.ReadFile(filepath.Join(dir, "api.yaml")); err != nil || string(got) != want {
+		t.Errorf("set wrote %q (%v), want %q", got, err, want)
+	}
+}
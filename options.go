@@ -0,0 +1,601 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/skelterjohn/tmplcute/keys"
+)
+
+// An option is a flag understood by tmplcute. Everything about it that a
+// user might want to know is here, so that -h and the man page can be
+// generated from the same place the flag is parsed.
+type option struct {
+	// names are the spellings of the flag, like "--html".
+	names []string
+	// value names the flag's argument, or is "" if it doesn't take one.
+	value string
+	// optional is whether the argument can be left out, so it is only
+	// given after an "=", and is "" otherwise.
+	optional bool
+	usage    string
+	set      func(value string) error
+	// setAll is set instead of set for flags that take more than one value,
+	// like "-r SRC_DIR DST_DIR", where value names each of them.
+	setAll func(values []string) error
+	// load is set instead of set for options that add to the object, like
+	// --consul. They are applied in order with the other arguments. If set
+	// is given too, it is called as the option is parsed.
+	load func(ctx context.Context, value string, obj interface{}) error
+	// loadWith is set instead of load for options that others tune, like
+	// --vault, whose --vault-key is in with.
+	loadWith func(ctx context.Context, value string, with settings, obj interface{}) error
+	// mounts, if set, returns the top-level fields a load option puts its
+	// data in, so that --lazy can skip it if they aren't needed. It is
+	// called once all the options are set.
+	mounts func(value string, with settings) []string
+	// of is set for options that tune a load option, like --vault-key for
+	// --vault, and names it. They apply to the one they follow, or to the
+	// next one if none does. If set is given too, it checks the value.
+	of string
+	// url is whether the value can be a URL to read, like -f's, whose host
+	// is then sent the --headers without a HOST.
+	url bool
+}
+
+// A config is the settings that a Renderer keeps its own copy of, and that
+// the command keeps in options: how documents combine, how --KEY=VALUEs set
+// values, how long fetches take, and what templates may do.
+type config struct {
+	// merge is how later FILEs combine with earlier ones: "deep" (or ""),
+	// "shallow", replacing top-level fields whole, or "replace".
+	merge string
+	// arrayMerge is how lists from successive FILEs combine, and mergeBy
+	// the field that merge-by matches items on.
+	arrayMerge string
+	mergeBy    string
+	// nullDeletes makes nulls take fields away.
+	nullDeletes bool
+	// strictTypes makes --KEYs that change a value's type an error.
+	strictTypes bool
+	timeout     time.Duration
+	// allowed are what the --allow-WHATs let templates do.
+	allowed map[string]bool
+}
+
+// configKey is the context key for the config that the code under a
+// Renderer's methods goes by.
+type configKey struct{}
+
+// withConfig returns ctx, carrying c.
+func withConfig(ctx context.Context, c *config) context.Context {
+	return context.WithValue(ctx, configKey{}, c)
+}
+
+// configFrom returns the config that ctx carries, or the command's if it
+// carries none.
+func configFrom(ctx context.Context) *config {
+	if c, ok := ctx.Value(configKey{}).(*config); ok {
+		return c
+	}
+	return &options.config
+}
+
+// options are what tmplcute's flags have asked for.
+var options struct {
+	config
+	html    bool
+	renders []renderJob
+	// trees are the -r directories.
+	trees []tree
+	// files are the -f templates, executed onto stdout.
+	files []string
+	// output is the -o file, which gets outputMode if it isn't 0.
+	output     string
+	outputMode os.FileMode
+	jobs       int
+	timings    bool
+	tz         *time.Location
+	locale     locale
+	now        *time.Time
+	prompt     bool
+	// headers are the --headers to send to each host, by its lower-cased
+	// name, or "" for those to send to the hosts of the URLs given as
+	// arguments, which are urlHosts.
+	headers  map[string]http.Header
+	urlHosts map[string]bool
+	// cacheDir and cacheTTL are where and for how long fetches are cached.
+	cacheDir string
+	cacheTTL time.Duration
+	// retries and retryBackoff are how hard to try fetching.
+	retries      int
+	retryBackoff time.Duration
+	// stream is where --stream reads records from.
+	stream string
+	lazy   bool
+	// warnUnused warns about fields no template uses.
+	warnUnused bool
+	// listVars prints what the templates use instead of executing them.
+	listVars bool
+	// dumpAST prints how the templates parsed instead of executing them.
+	dumpAST bool
+	// schema and cueSchema check the object before it is used.
+	schema    string
+	cueSchema string
+	// sandbox keeps templates' includes under the current directory.
+	sandbox bool
+	// root and noFollowSymlinks limit the files templates can read.
+	root             string
+	noFollowSymlinks bool
+	// redact matches the KEYs whose values are kept out of diagnostics.
+	redact []*regexp.Regexp
+	// errorsJSON reports errors as JSON.
+	errorsJSON bool
+	// logJSON and logLevel are how diagnostics are printed, and which.
+	logJSON  bool
+	logLevel logLevel
+	// ignoreMissing skips FILEs that don't exist.
+	ignoreMissing bool
+	// explain are the KEYs to say where the values came from.
+	explain []string
+	// stdin is what stdin holds: "template", "data" or "auto".
+	stdin string
+	// serve is the address to serve the templates at.
+	serve string
+	// reload is whether to watch what is served, and reload it.
+	reload bool
+	// maxBody is the most a request to --serve can send, in bytes.
+	maxBody int64
+	// extendedFuncs is whether --funcs=extended adds more functions.
+	extendedFuncs bool
+	// dataStdin is whether a -d reads stdin, which is then not the template
+	// or --stdin's data.
+	dataStdin bool
+	// dataFormat is the -d-format of the -d FILEs.
+	dataFormat string
+	// writeBack is the file set or merge writes the object to. As a FILE,
+	// it keeps its $refs, so that writing it back doesn't replace them.
+	writeBack string
+	// archive is the file --archive puts the rendered files in.
+	archive string
+	// effectiveConfig is the file --emit-effective-config writes to.
+	effectiveConfig string
+	// derives are the --derive KEYs, in order.
+	derives []derivation
+	// transforms are the --transform templates, in order.
+	transforms []string
+	// watch is whether to execute the templates again when their files
+	// change.
+	watch bool
+	// manifest is the file --manifest lists the rendered files in.
+	manifest string
+	// skipEmpty is whether to leave empty outputs unwritten.
+	skipEmpty bool
+	// raw are the globs of templates to copy as they are.
+	raw []string
+	// engines are the --engine choices, by extension.
+	engines map[string]string
+	// prune is the directory --prune deletes stale outputs from, keeping
+	// those matching the pruneIgnore globs.
+	prune       string
+	pruneIgnore []string
+	// coverage is the file --coverage counts are written to.
+	coverage string
+	// profile times the templates and their top-level actions.
+	profile bool
+	// stdinUsed is set once the template has been read from stdin.
+	stdinUsed bool
+}
+
+var optionTable = []option{
+	{
+		names: []string{"-h"},
+		usage: "print this help and exit",
+	},
+	{
+		names: []string{"--html"},
+		usage: `use "html/template" rather than the normal "text/template"`,
+		set: func(string) error {
+			options.html = true
+			return nil
+		},
+	},
+	{
+		names: []string{"-w"},
+		usage: "deprecated: the old name for --html",
+		set: func(string) error {
+			warnf("-w is deprecated; use --html")
+			options.html = true
+			return nil
+		},
+	},
+	{
+		names: []string{"--chdir"},
+		value: "DIR",
+		usage: "change to DIR before reading or writing any files",
+		set:   os.Chdir,
+	},
+	{
+		names: []string{"-f", "--file"},
+		value: "TEMPLATE",
+		usage: "read the template from the file (or URL or object) TEMPLATE instead of stdin, leaving stdin free for data; may be repeated, to execute each in turn",
+		url:   true,
+		set: func(file string) error {
+			options.files = append(options.files, file)
+			return nil
+		},
+	},
+	{
+		names: []string{"-o", "--output"},
+		value: "PATH",
+		usage: "write what would go to stdout to the file PATH instead, making its directory if need be",
+		set: func(path string) error {
+			options.output = path
+			return nil
+		},
+	},
+	{
+		names: []string{"-o-mode", "--output-mode"},
+		value: "MODE",
+		usage: "give the -o file the permissions MODE, in octal, like 0600",
+		set: func(mode string) error {
+			m, err := strconv.ParseUint(mode, 8, 32)
+			if err != nil {
+				return fmt.Errorf("%q is not octal permissions like 0644", mode)
+			}
+			options.outputMode = os.FileMode(m)
+			return nil
+		},
+	},
+	{
+		names: []string{"--render"},
+		value: "TEMPLATE:OUTPUT",
+		usage: "execute the template in TEMPLATE, writing to OUTPUT, which can be left off if the template's front matter says where; may be repeated",
+		url:   true,
+		set: func(pair string) error {
+			colon := strings.LastIndex(pair, ":")
+			if colon == -1 {
+				options.renders = append(options.renders, renderJob{template: pair})
+				return nil
+			}
+			options.renders = append(options.renders, renderJob{template: pair[:colon], output: pair[colon+1:]})
+			return nil
+		},
+	},
+	{
+		names: []string{"--jobs"},
+		value: "N",
+		usage: "render up to N templates at once (default is the number of CPUs)",
+		set: func(n string) error {
+			var err error
+			options.jobs, err = strconv.Atoi(n)
+			return err
+		},
+	},
+	{
+		names: []string{"--ignore-missing"},
+		usage: "skip FILEs that don't exist, with a warning, like an optional local.yaml on top of the others",
+		set: func(string) error {
+			options.ignoreMissing = true
+			return nil
+		},
+	},
+	{
+		names: []string{"--null-deletes"},
+		usage: "make a null from a FILE or other source take the field away, rather than setting it to null, so a later FILE can remove what an earlier one set",
+		set: func(string) error {
+			options.nullDeletes = true
+			return nil
+		},
+	},
+	{
+		names: []string{"--max-index"},
+		value: "N",
+		usage: "let a --KEY=VALUE grow a list to index N at most (default is 100000)",
+		set: func(n string) error {
+			var err error
+			keys.MaxIndex, err = strconv.Atoi(n)
+			return err
+		},
+	},
+	{
+		names: []string{"--timings"},
+		usage: "report how long each step takes on stderr",
+		set: func(string) error {
+			options.timings = true
+			return nil
+		},
+	},
+	{
+		names: []string{"--tz"},
+		value: "ZONE",
+		usage: `use the time zone ZONE, like "UTC" or "America/New_York", for dates (default is local)`,
+		set: func(zone string) error {
+			var err error
+			options.tz, err = time.LoadLocation(zone)
+			return err
+		},
+	},
+	{
+		names: []string{"--locale"},
+		value: "LOCALE",
+		usage: `write numbers the way LOCALE, like "de" or "fr-FR", does (default is "en")`,
+		set: func(name string) error {
+			var err error
+			options.locale, err = findLocale(name)
+			return err
+		},
+	},
+	{
+		names: []string{"--deterministic"},
+		value: "TIME",
+		usage: "make output the same every run: now is always TIME (RFC 3339 or unix seconds), random funcs are seeded from it, and templates render one at a time",
+		set: func(s string) error {
+			when, err := parseTime(s)
+			if err != nil {
+				return err
+			}
+			options.now = &when
+			random.Seed(when.UnixNano())
+			return nil
+		},
+	},
+	{
+		names: []string{"--prompt"},
+		usage: "ask on the terminal for values that are required but missing, instead of failing",
+		set: func(string) error {
+			options.prompt = true
+			return nil
+		},
+	},
+	{
+		names: []string{"--timeout"},
+		value: "DURATION",
+		usage: `give up on fetching data from elsewhere, or running a command for it, after DURATION, like "5s" (default is 30s)`,
+		set: func(d string) error {
+			var err error
+			options.timeout, err = time.ParseDuration(d)
+			return err
+		},
+	},
+	{
+		names: []string{"--header"},
+		value: `"[HOST:]NAME: VALUE"`,
+		usage: "send this header when fetching a URL from HOST, like api.example.com, or with no HOST, from the hosts of the URLs given as a FILE, -d, -f or --render; may be repeated",
+		set: func(h string) error {
+			host, name, value, err := parseHeader(h)
+			if err != nil {
+				return err
+			}
+			if options.headers[host] == nil {
+				options.headers[host] = http.Header{}
+			}
+			options.headers[host].Add(name, value)
+			return nil
+		},
+	},
+}
+
+func init() {
+	options.jobs = runtime.NumCPU()
+}
+
+// parseHeader breaks a --header's [HOST:]NAME: VALUE apart. A HOST has a
+// dot in it, or is localhost, which a header's name never does. It is
+// lower-cased, since host names aren't case sensitive, and is "" if there is
+// none.
+func parseHeader(arg string) (host, name, value string, err error) {
+	if isURL(arg) {
+		return "", "", "", fmt.Errorf("%q has a URL where the HOST goes", arg)
+	}
+	h := arg
+	if first := strings.Index(h, ":"); first != -1 {
+		maybeHost := h[:first]
+		if (strings.Contains(maybeHost, ".") || maybeHost == "localhost") && !strings.ContainsAny(maybeHost, " \t/") {
+			host, h = strings.ToLower(maybeHost), h[first+1:]
+		}
+	}
+	colon := strings.Index(h, ":")
+	if colon < 1 || strings.ContainsAny(h[:colon], " \t/.") {
+		return "", "", "", fmt.Errorf("%q is not [HOST:]NAME: VALUE", arg)
+	}
+	return host, h[:colon], strings.TrimSpace(h[colon+1:]), nil
+}
+
+// lookupOption finds the option spelled name.
+func lookupOption(name string) *option {
+	for i := range optionTable {
+		for _, n := range optionTable[i].names {
+			if n == name {
+				return &optionTable[i]
+			}
+		}
+	}
+	return nil
+}
+
+// longOptions are the long options given, by the name they were given as,
+// for warnShadowed.
+var longOptions []string
+
+// errHelp is returned by parseOptions when -h asks for help.
+var errHelp = errors.New("help requested")
+
+// parseOptions sets options from the flags in args, and returns the rest of
+// the arguments, and any options that load data, in order as sources. Flags
+// that take a value can be given as "--flag=VALUE" or "--flag VALUE".
+// Everything after a lone "--" is left alone, so a KEY that happens to be
+// spelled like a flag can still be set.
+func parseOptions(args []string) ([]source, error) {
+	rest := []source{}
+	// tuned are the settings of the last source loaded by each option, and
+	// next those given before any was.
+	tuned, next := map[string]settings{}, map[string]settings{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			for _, arg := range args[i+1:] {
+				noteURLHost(arg)
+				rest = append(rest, argSources(arg)...)
+			}
+			return rest, nil
+		}
+		if arg == "-h" {
+			return nil, errHelp
+		}
+		if strings.HasPrefix(arg, "--.") {
+			// A KEY spelled like an option, like --.timeout=5s for the
+			// field timeout rather than --timeout.
+			rest = append(rest, source{arg: "--" + arg[len("--."):]})
+			continue
+		}
+		name, value, hasValue := arg, "", false
+		if eq := strings.Index(arg, "="); eq != -1 {
+			name, value, hasValue = arg[:eq], arg[eq+1:], true
+		}
+		o := lookupOption(name)
+		if o == nil {
+			noteURLHost(arg)
+			rest = append(rest, argSources(arg)...)
+			continue
+		}
+		if strings.HasPrefix(name, "--") {
+			longOptions = append(longOptions, name)
+		}
+		if o.setAll != nil {
+			var values []string
+			if hasValue {
+				values = append(values, value)
+			}
+			for n := len(strings.Fields(o.value)); len(values) < n; {
+				if i+1 == len(args) {
+					return nil, fmt.Errorf("%s needs %d values, like %s %s", name, n, name, o.value)
+				}
+				i++
+				values = append(values, args[i])
+			}
+			if err := o.setAll(values); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			givenOptions = append(givenOptions, strings.Join(append([]string{name}, values...), " "))
+			continue
+		}
+		if o.value == "" {
+			if hasValue {
+				return nil, fmt.Errorf("%s does not take a value", name)
+			}
+		} else if !hasValue && !o.optional {
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("%s needs a value, like %s=%s", name, name, o.value)
+			}
+			i++
+			value = args[i]
+		}
+		if o.url {
+			noteURLHost(value)
+		}
+		if o.of != "" {
+			if o.set != nil {
+				if err := o.set(value); err != nil {
+					return nil, fmt.Errorf("%s: %v", name, err)
+				}
+			}
+			with := tuned[o.of]
+			if with == nil {
+				if with = next[o.of]; with == nil {
+					with = settings{}
+					next[o.of] = with
+				}
+			}
+			with[o.names[0]] = value
+			givenOptions = append(givenOptions, name+"="+value)
+			continue
+		}
+		if o.load != nil || o.loadWith != nil {
+			if o.set != nil {
+				if err := o.set(value); err != nil {
+					return nil, fmt.Errorf("%s: %v", name, err)
+				}
+			}
+			o, value, desc := o, value, name
+			if hasValue || (o.value != "" && !o.optional) {
+				desc += "=" + value
+			}
+			with := next[o.names[0]]
+			if with == nil {
+				with = settings{}
+			}
+			delete(next, o.names[0])
+			tuned[o.names[0]] = with
+			src := source{arg: desc, load: func(ctx context.Context, obj interface{}) error {
+				if o.loadWith != nil {
+					return o.loadWith(ctx, value, with, obj)
+				}
+				return o.load(ctx, value, obj)
+			}}
+			if o.mounts != nil {
+				src.mounts = func() []string { return o.mounts(value, with) }
+			}
+			rest = append(rest, src)
+			continue
+		}
+		if err := o.set(value); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if o.value != "" {
+			name += "=" + value
+		}
+		givenOptions = append(givenOptions, name)
+	}
+	return rest, nil
+}
+
+// spelling is how the option is written in help, like "-f, --file=FILE".
+func (o option) spelling() string {
+	s := strings.Join(o.names, ", ")
+	switch {
+	case o.setAll != nil:
+		s += " " + o.value
+	case o.optional:
+		s += "[=" + o.value + "]"
+	case o.value != "":
+		s += "=" + o.value
+	}
+	return s
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, usage)
+	fmt.Fprintln(w, "\nOptions:")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, o := range optionTable {
+		fmt.Fprintf(tw, "  %s\t%s\n", o.spelling(), o.usage)
+	}
+	tw.Flush()
+}
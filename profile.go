@@ -0,0 +1,161 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"text/template/parse"
+	"time"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--profile-template"},
+		usage: "report on stderr how long each template, and each action at the top of one, takes to execute, slowest first",
+		set: func(string) error {
+			if !options.profile {
+				instruments = append(instruments, instrument{
+					funcs: map[string]interface{}{
+						"tmplcuteProfileStart": time.Now,
+						"tmplcuteProfileStop":  profileStop,
+					},
+					rewrite: profileTree,
+				})
+			}
+			options.profile = true
+			return nil
+		},
+	})
+}
+
+// A profileEntry is how many times a template or action has executed, and
+// for how long altogether.
+type profileEntry struct {
+	calls int
+	total time.Duration
+}
+
+// profiled is what has executed so far, by "template NAME" or
+// "LOCATION TEXT", like "page.tmpl:3:5 {{range .items}}".
+var profiled = struct {
+	sync.Mutex
+	entries map[string]*profileEntry
+}{entries: map[string]*profileEntry{}}
+
+// The variables the clocks are kept in. A template's top-level actions each
+// declare their own, which shadows the template's for the rest of it, so the
+// two need different names.
+const (
+	templateClock = "$tmplcuteTemplateStart"
+	actionClock   = "$tmplcuteActionStart"
+)
+
+// profileTree times tree as a whole, and each action at the top of it.
+// Actions that call other templates include the time those take.
+func profileTree(tree *parse.Tree) {
+	list := tree.Root
+	var nodes []parse.Node
+	for _, n := range list.Nodes {
+		switch n.(type) {
+		case *parse.TextNode, *parse.CommentNode:
+			nodes = append(nodes, n)
+			continue
+		}
+		location, _ := tree.ErrorContext(n)
+		pos := n.Position()
+		nodes = append(nodes,
+			startClock(pos, actionClock),
+			n,
+			stopClock(pos, actionClock, location+" "+actionText(n)))
+	}
+	pos := list.Position()
+	list.Nodes = append([]parse.Node{startClock(pos, templateClock)}, nodes...)
+	list.Nodes = append(list.Nodes, stopClock(pos, templateClock, "template "+tree.Name))
+}
+
+// startClock is {{$clock := tmplcuteProfileStart}}, which prints nothing.
+func startClock(pos parse.Pos, clock string) parse.Node {
+	pipe := &parse.PipeNode{NodeType: parse.NodePipe, Pos: pos}
+	pipe.Decl = []*parse.VariableNode{clockVariable(pos, clock)}
+	appendCall(pipe, "tmplcuteProfileStart")
+	return &parse.ActionNode{NodeType: parse.NodeAction, Pos: pos, Pipe: pipe}
+}
+
+// stopClock adds the time since clock started to key's entry. Like a
+// --coverage counter, it is an {{if}} that is never true.
+func stopClock(pos parse.Pos, clock, key string) parse.Node {
+	pipe := &parse.PipeNode{NodeType: parse.NodePipe, Pos: pos}
+	appendCall(pipe, "tmplcuteProfileStop", key)
+	cmd := pipe.Cmds[0]
+	cmd.Args = append(cmd.Args, clockVariable(pos, clock))
+	return &parse.IfNode{BranchNode: parse.BranchNode{
+		NodeType: parse.NodeIf,
+		Pos:      pos,
+		Pipe:     pipe,
+		List:     &parse.ListNode{NodeType: parse.NodeList, Pos: pos},
+	}}
+}
+
+func clockVariable(pos parse.Pos, clock string) *parse.VariableNode {
+	return &parse.VariableNode{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{clock}}
+}
+
+// profileStop adds the time since start to key's entry.
+func profileStop(key string, start time.Time) bool {
+	d := time.Since(start)
+	profiled.Lock()
+	e := profiled.entries[key]
+	if e == nil {
+		e = &profileEntry{}
+		profiled.entries[key] = e
+	}
+	e.calls++
+	e.total += d
+	profiled.Unlock()
+	return false
+}
+
+// reportProfile prints what --profile-template timed, slowest first.
+func reportProfile() {
+	if !options.profile {
+		return
+	}
+	profiled.Lock()
+	defer profiled.Unlock()
+	keys := make([]string, 0, len(profiled.entries))
+	for key := range profiled.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := profiled.entries[keys[i]], profiled.entries[keys[j]]
+		if a.total != b.total {
+			return a.total > b.total
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		e := profiled.entries[key]
+		calls := "calls"
+		if e.calls == 1 {
+			calls = "call"
+		}
+		logMsg(logInfo, "profile: ", fmt.Sprintf("%s: %v in %d %s", key, e.total, e.calls, calls),
+			"what", key, "calls", e.calls, "seconds", e.total.Seconds())
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	optionTable = append(optionTable,
+		option{
+			names:    []string{"--prom"},
+			value:    "URL",
+			usage:    "run the --promql instant query against the Prometheus at URL",
+			loadWith: loadProm,
+			mounts: func(_ string, with settings) []string {
+				return strings.Split(with.get("--prom-key", "prom"), ".")[:1]
+			},
+		},
+		option{
+			names: []string{"--promql"},
+			value: "QUERY",
+			usage: "the PromQL query for the --prom",
+			of:    "--prom",
+		},
+		option{
+			names: []string{"--prom-key"},
+			value: "KEY",
+			usage: `put the --prom results at KEY (default is "prom"), as resultType and result, with each sample's metric labels, value and time`,
+			of:    "--prom",
+		},
+	)
+}
+
+func loadProm(ctx context.Context, base string, with settings, obj interface{}) error {
+	query := with.get("--promql", "")
+	if query == "" {
+		return fmt.Errorf("needs a --promql")
+	}
+	resp, err := fetch(ctx, strings.TrimSuffix(base, "/")+"/api/v1/query?query="+url.QueryEscape(query))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status string
+		Error  string
+		Data   struct {
+			ResultType string
+			Result     json.RawMessage
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	if body.Status != "success" {
+		return fmt.Errorf("prometheus: %s", body.Error)
+	}
+
+	var result interface{}
+	switch body.Data.ResultType {
+	case "vector", "matrix":
+		var series []struct {
+			Metric map[string]interface{}
+			Value  []interface{}
+			Values [][]interface{}
+		}
+		if err := json.Unmarshal(body.Data.Result, &series); err != nil {
+			return err
+		}
+		list := []interface{}{}
+		for _, s := range series {
+			m := map[string]interface{}{"metric": s.Metric}
+			if s.Value != nil {
+				m["value"], m["time"] = promSample(s.Value)
+			}
+			if s.Values != nil {
+				values := []interface{}{}
+				for _, v := range s.Values {
+					value, when := promSample(v)
+					values = append(values, map[string]interface{}{"value": value, "time": when})
+				}
+				m["values"] = values
+			}
+			list = append(list, m)
+		}
+		result = list
+	default:
+		var sample []interface{}
+		if err := json.Unmarshal(body.Data.Result, &sample); err != nil {
+			return err
+		}
+		value, when := promSample(sample)
+		result = map[string]interface{}{"value": value, "time": when}
+	}
+	return mount(obj, strings.Split(with.get("--prom-key", "prom"), "."), map[string]interface{}{
+		"resultType": body.Data.ResultType,
+		"result":     result,
+	})
+}
+
+// promSample splits a [time, "value"] pair, turning the value into a number
+// when it is one.
+func promSample(pair []interface{}) (value interface{}, when interface{}) {
+	if len(pair) != 2 {
+		return nil, nil
+	}
+	value = pair[1]
+	if s, ok := value.(string); ok {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			value = f
+		}
+	}
+	if secs, ok := pair[0].(float64); ok {
+		when = time.Unix(0, int64(secs*float64(time.Second))).In(options.tz).Format(time.RFC3339)
+	}
+	return value, when
+}
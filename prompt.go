@@ -0,0 +1,116 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// secretKey matches the KEYs whose values shouldn't be shown.
+var secretKey = regexp.MustCompile(`(?i)(pass(word|wd)?|secret|token|api[-_]?key|private[-_]?key|credential)s?$`)
+
+// answers remembers what was typed at prompts, so each KEY is only asked
+// for once.
+var answers = struct {
+	sync.Mutex
+	byKey map[string]string
+	in    *bufio.Reader
+	tty   *os.File
+}{byKey: map[string]string{}}
+
+// required returns v, unless v is missing or empty. Then, with --prompt and
+// a terminal, it asks for KEY; otherwise it is an error.
+func required(key string, v interface{}) (interface{}, error) {
+	if v != nil && v != "" {
+		return v, nil
+	}
+	if !options.prompt {
+		return nil, fmt.Errorf("%s is required", key)
+	}
+	answers.Lock()
+	defer answers.Unlock()
+	if answer, ok := answers.byKey[key]; ok {
+		return answer, nil
+	}
+	answer, err := ask(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s is required: %v", key, err)
+	}
+	if isSecret(key) {
+		noteSecrets(&map[string]interface{}{key: answer})
+	}
+	answers.byKey[key] = answer
+	return answer, nil
+}
+
+// ask prompts for a value for key on the terminal. Input for secret KEYs,
+// and those --redact matches, is not echoed.
+func ask(key string) (string, error) {
+	if answers.in == nil {
+		tty, err := terminal()
+		if err != nil {
+			return "", err
+		}
+		answers.tty = tty
+		answers.in = bufio.NewReader(tty)
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", key)
+	if isSecret(key) {
+		if err := stty(answers.tty, "-echo"); err == nil {
+			defer func() {
+				stty(answers.tty, "echo")
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+	line, err := answers.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// terminal finds somewhere to read answers from: stdin if it is a terminal
+// that isn't being used for the template, or else the controlling terminal.
+func terminal() (*os.File, error) {
+	if !options.stdinUsed && isTerminal(os.Stdin) {
+		return os.Stdin, nil
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, fmt.Errorf("no terminal to prompt on")
+	}
+	return tty, nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// stty changes the settings of the terminal tty.
+func stty(tty *os.File, setting string) error {
+	cmd := exec.Command("stty", setting)
+	cmd.Stdin = tty
+	return cmd.Run()
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable,
+		option{
+			names: []string{"--prune"},
+			value: "DIR",
+			usage: "once everything is rendered, delete the files in DIR that weren't, and the directories that leaves empty, so that outputs which are no longer made don't linger; DIR can't be the root of a git working tree, nor hold the templates or data FILEs",
+			set: func(dir string) error {
+				options.prune = dir
+				return nil
+			},
+		},
+		option{
+			names: []string{"--prune-ignore"},
+			value: "PATTERN",
+			usage: "keep the files under --prune whose path, relative to DIR, or name matches the glob PATTERN (can be given more than once)",
+			set: func(pattern string) error {
+				if _, err := filepath.Match(pattern, ""); err != nil {
+					return err
+				}
+				options.pruneIgnore = append(options.pruneIgnore, pattern)
+				return nil
+			},
+		},
+	)
+}
+
+// prune deletes what the --prune directory holds that wasn't rendered, nor
+// written by --manifest, --coverage, --emit-effective-config or --archive,
+// nor ignored with --prune-ignore. It refuses to if that would delete what
+// srcs or the templates read.
+func prune(srcs []source) error {
+	if options.prune == "" {
+		return nil
+	}
+	if err := prunable(options.prune, inputFiles(srcs)); err != nil {
+		return err
+	}
+	keep := map[string]bool{}
+	written.Lock()
+	for path := range written.files {
+		keep[absPath(path)] = true
+	}
+	written.Unlock()
+	for _, path := range []string{options.manifest, options.coverage, options.effectiveConfig, options.archive} {
+		if path != "" {
+			keep[absPath(path)] = true
+		}
+	}
+
+	var dirs []string
+	err := filepath.Walk(options.prune, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(options.prune, path)
+		if rel != "." && pruneIgnored(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if rel != "." {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if keep[absPath(path)] {
+			return nil
+		}
+		logMsg(logInfo, "", "pruning "+path, "file", path)
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+	// The deepest come first, so that their parents are empty in turn.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) == 0 {
+			if err := os.Remove(dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prunable checks that pruning dir can't delete a git working tree or any
+// of inputs, the files and directories the run reads.
+func prunable(dir string, inputs []string) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return fmt.Errorf("not pruning %s, which is the root of a git working tree", dir)
+	}
+	abs := absPath(dir)
+	for _, in := range inputs {
+		if within(abs, absPath(in)) {
+			return fmt.Errorf("not pruning %s, which holds %s", dir, in)
+		}
+		if info, err := os.Stat(in); err == nil && info.IsDir() && within(absPath(in), abs) {
+			return fmt.Errorf("not pruning %s, which is in %s", dir, in)
+		}
+	}
+	return nil
+}
+
+// inputFiles are the local files and directories that srcs and the
+// templates read: those --watch watches, and the -d FILEs.
+func inputFiles(srcs []source) []string {
+	files := watchedFiles(srcs)
+	for _, src := range srcs {
+		for _, prefix := range []string{"-d=", "--data="} {
+			if file := strings.TrimPrefix(src.arg, prefix); file != src.arg && file != "-" && !isURL(file) && !isObjectURI(file) {
+				files = append(files, file)
+			}
+		}
+	}
+	return files
+}
+
+// within reports whether path is dir or under it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// pruneIgnored reports whether a --prune-ignore pattern matches rel, a path
+// under the --prune directory.
+func pruneIgnored(rel string) bool {
+	for _, pattern := range options.pruneIgnore {
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
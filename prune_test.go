@@ -0,0 +1,52 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrunable(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"repo/.git", "src/out", "out"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := filepath.Join(dir, "data.json")
+	src := filepath.Join(dir, "src")
+	inputs := []string{data, src}
+
+	tests := []struct {
+		dir string
+		ok  bool
+	}{
+		{"out", true},
+		{"repo", false},
+		{".", false},
+		{"src", false},
+		{"src/out", false},
+	}
+	for _, test := range tests {
+		err := prunable(filepath.Join(dir, test.dir), inputs)
+		if (err == nil) != test.ok {
+			t.Errorf("prunable(%q) = %v, want ok %v", test.dir, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// random is the source for every random func. --deterministic seeds it
+// with a fixed value.
+var random = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+func randInt(min, max int) (int, error) {
+	if max <= min {
+		return 0, fmt.Errorf("randInt needs min < max, got %d and %d", min, max)
+	}
+	random.Lock()
+	defer random.Unlock()
+	return min + random.Intn(max-min), nil
+}
+
+const alphaNum = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func randAlphaNum(n int) string {
+	random.Lock()
+	defer random.Unlock()
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphaNum[random.Intn(len(alphaNum))]
+	}
+	return string(b)
+}
+
+// uuid is a random (version 4) UUID.
+func uuid() string {
+	random.Lock()
+	defer random.Unlock()
+	b := make([]byte, 16)
+	random.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--raw"},
+		value: "GLOB",
+		usage: "copy the --render TEMPLATEs and -r files whose path or name matches GLOB, like *.png, to their OUTPUT as they are, without executing them; binary ones always are (can be given more than once)",
+		set: func(glob string) error {
+			if _, err := filepath.Match(glob, ""); err != nil {
+				return err
+			}
+			options.raw = append(options.raw, glob)
+			return nil
+		},
+	})
+}
+
+// isRaw reports whether the template in path, whose text is text, is to be
+// copied rather than executed: because --raw says so, or because it is
+// binary, which no template is.
+func isRaw(path, text string) bool {
+	for _, glob := range options.raw {
+		if ok, _ := filepath.Match(glob, path); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(glob, filepath.Base(path)); ok {
+			return true
+		}
+	}
+	return isBinary(text)
+}
+
+// isBinary guesses whether text is binary from its start, the way diff and
+// grep do: text has no NULs, and here it has to be UTF-8 too.
+func isBinary(text string) bool {
+	const sniff = 8000
+	if len(text) > sniff {
+		text = text[:sniff]
+		// A rune cut off at the end doesn't count.
+		for i := 0; i < utf8.UTFMax && !utf8.ValidString(text); i++ {
+			text = text[:len(text)-1]
+		}
+	}
+	return strings.IndexByte(text, 0) != -1 || !utf8.ValidString(text)
+}
+
+// copyRaw writes text, the template in path, to output as it is, keeping
+// its permissions if it is a local file.
+func copyRaw(path, text, output string) error {
+	var mode os.FileMode
+	if !isURL(path) && !isObjectURI(path) {
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+	if err := writeOutput(output, []byte(text), mode); err != nil {
+		return &stageError{stage: "write", file: output, err: err}
+	}
+	return nil
+}
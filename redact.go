@@ -0,0 +1,184 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--redact"},
+		value: "PATTERN",
+		usage: "keep the values at KEYs matching the regexp PATTERN out of errors, warnings and --trace, as is done for KEYs like password, token and secret; may be repeated",
+		set: func(pattern string) error {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return err
+			}
+			options.redact = append(options.redact, re)
+			return nil
+		},
+	})
+}
+
+// minSecret is the length of the shortest value redact hides wherever it
+// appears. Shorter ones, like PINs, are only hidden where they are a whole
+// word, so that a "5" doesn't garble every line number and time.
+const minSecret = 4
+
+// secrets are the values that redact hides. short are those under
+// minSecret long.
+var secrets = struct {
+	sync.Mutex
+	values   map[string]bool
+	replacer *strings.Replacer
+	short    []string
+}{values: map[string]bool{}}
+
+// isSecret reports whether the value at key should be redacted.
+func isSecret(key string) bool {
+	if secretKey.MatchString(key) {
+		return true
+	}
+	for _, re := range options.redact {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// noteSecrets finds the values to redact in obj, which is what a source
+// adds to the object.
+func noteSecrets(obj interface{}) {
+	if m, ok := obj.(*map[string]interface{}); ok {
+		obj = *m
+	}
+	noteSecretsAt(nil, obj)
+}
+
+// noteSecretsAt is noteSecrets for a value that a source puts at path in the
+// object, so that only what it adds is looked through, not all the rest.
+func noteSecretsAt(path []string, value interface{}) {
+	secrets.Lock()
+	defer secrets.Unlock()
+	key, secret := "", false
+	for _, name := range path {
+		key = joinKey(key, name)
+		secret = secret || isSecret(key)
+	}
+	findSecrets(key, value, secret)
+}
+
+// findSecrets adds the values under v, which is at key, to secrets. Once a
+// key is secret, so is everything under it.
+func findSecrets(key string, v interface{}, secret bool) {
+	secret = secret || key != "" && isSecret(key)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			findSecrets(joinKey(key, k), child, secret)
+		}
+	case map[interface{}]interface{}:
+		for k, child := range v {
+			findSecrets(joinKey(key, fmt.Sprint(k)), child, secret)
+		}
+	case []interface{}:
+		for i, child := range v {
+			findSecrets(fmt.Sprintf("%s[%d]", key, i), child, secret)
+		}
+	case nil, bool:
+		// Hiding every "true" would hide nothing worth hiding.
+	default:
+		if s := fmt.Sprint(v); secret && s != "" && !secrets.values[s] {
+			secrets.values[s] = true
+			secrets.replacer = nil
+		}
+	}
+}
+
+func joinKey(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+// redact replaces the secrets in s.
+func redact(s string) string {
+	secrets.Lock()
+	defer secrets.Unlock()
+	if len(secrets.values) == 0 {
+		return s
+	}
+	if secrets.replacer == nil {
+		values := make([]string, 0, len(secrets.values))
+		for v := range secrets.values {
+			values = append(values, v)
+		}
+		// The longest come first, so no secret is left half shown because a
+		// shorter one was part of it.
+		sort.Slice(values, func(i, j int) bool {
+			return len(values[i]) > len(values[j])
+		})
+		pairs := []string{}
+		secrets.short = nil
+		for _, v := range values {
+			if len(v) < minSecret {
+				secrets.short = append(secrets.short, v)
+			} else {
+				pairs = append(pairs, v, "[redacted]")
+			}
+		}
+		secrets.replacer = strings.NewReplacer(pairs...)
+	}
+	s = secrets.replacer.Replace(s)
+	for _, v := range secrets.short {
+		s = redactWord(s, v)
+	}
+	return s
+}
+
+// redactWord replaces v in s wherever it isn't part of a longer word or
+// number.
+func redactWord(s, v string) string {
+	var b strings.Builder
+	from := 0
+	for at := 0; ; {
+		i := strings.Index(s[at:], v)
+		if i == -1 {
+			b.WriteString(s[from:])
+			return b.String()
+		}
+		start, end := at+i, at+i+len(v)
+		if (start == 0 || !isWordByte(s[start-1])) && (end == len(s) || !isWordByte(s[end])) {
+			b.WriteString(s[from:start])
+			b.WriteString("[redacted]")
+			from = end
+		}
+		at = end
+	}
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	defer func(values map[string]bool) {
+		secrets.values, secrets.replacer = values, nil
+	}(secrets.values)
+	secrets.values, secrets.replacer = map[string]bool{}, nil
+	noteSecrets(&map[string]interface{}{
+		"password": "hunter22",
+		"db":       map[string]interface{}{"token": "42", "host": "example.com"},
+		"enabled":  true,
+	})
+
+	tests := []struct {
+		in, want string
+	}{
+		{"login with hunter22 failed", "login with [redacted] failed"},
+		{"xhunter22x", "x[redacted]x"},
+		{"pin 42 is wrong", "pin [redacted] is wrong"},
+		{"42", "[redacted]"},
+		{"42,42", "[redacted],[redacted]"},
+		{"page.tmpl:420:3", "page.tmpl:420:3"},
+		{"4242 and 142", "4242 and 142"},
+		{"example.com is true", "example.com is true"},
+	}
+	for _, test := range tests {
+		if got := redact(test.in); got != test.want {
+			t.Errorf("redact(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestMountNotesSecrets(t *testing.T) {
+	defer func(values map[string]bool) {
+		secrets.values, secrets.replacer = values, nil
+	}(secrets.values)
+	secrets.values, secrets.replacer = map[string]bool{}, nil
+
+	obj := map[string]interface{}{}
+	if err := mount(&obj, []string{"vault", "api_key"}, map[string]interface{}{"value": "s3cr3t-value"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mount(&obj, []string{"vault", "host"}, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := redact("s3cr3t-value at example.com"), "[redacted] at example.com"; got != want {
+		t.Errorf("redact gave %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--redis"},
+		value: "ADDR/PATTERN",
+		usage: "load the redis keys matching PATTERN, like localhost:6379/app:*, as nested fields split on :, logging in with $REDIS_PASSWORD",
+		load:  loadRedis,
+	})
+}
+
+// loadRedis reads every key matching the pattern. Strings that hold json
+// are decoded; hashes, lists and sets become maps and lists. The part of the
+// key before the pattern's first wildcard is dropped, and the rest is split
+// on ":" into nested fields.
+func loadRedis(ctx context.Context, arg string, obj interface{}) error {
+	slash := strings.Index(arg, "/")
+	if slash == -1 {
+		return fmt.Errorf("%q is not ADDR/PATTERN", arg)
+	}
+	addr, pattern := arg[:slash], arg[slash+1:]
+	var conn net.Conn
+	err := retry(ctx, func() error {
+		var err error
+		d := net.Dialer{Timeout: options.timeout}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Being cancelled cuts off whatever is being waited for.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	r := &redisConn{conn: conn, r: bufio.NewReader(conn), timeout: options.timeout}
+	r.ctxDeadline, _ = ctx.Deadline()
+
+	if password := os.Getenv("REDIS_PASSWORD"); password != "" {
+		if _, err := r.do("AUTH", password); err != nil {
+			return err
+		}
+	}
+
+	keys := []string{}
+	cursor := "0"
+	for {
+		reply, err := r.do("SCAN", cursor, "MATCH", pattern, "COUNT", "1000")
+		if err != nil {
+			return err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return fmt.Errorf("bad reply to SCAN: %v", reply)
+		}
+		matched, ok := parts[1].([]interface{})
+		if !ok {
+			return fmt.Errorf("bad reply to SCAN: %v", reply)
+		}
+		cursor = fmt.Sprint(parts[0])
+		for _, key := range matched {
+			keys = append(keys, fmt.Sprint(key))
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+
+	prefix := pattern
+	if i := strings.IndexAny(pattern, "*?[\\"); i != -1 {
+		prefix = pattern[:i]
+	}
+	for _, key := range keys {
+		value, err := r.value(key)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		if value == nil {
+			continue
+		}
+		rel := strings.TrimPrefix(key, prefix)
+		if rel == "" {
+			rel = key
+		}
+		if err := mount(obj, strings.Split(rel, ":"), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redisConn speaks just enough of the redis protocol to read keys. Each
+// command can take timeout, unless it is 0, and none can go on past
+// ctxDeadline, if it is set.
+type redisConn struct {
+	conn        net.Conn
+	r           *bufio.Reader
+	timeout     time.Duration
+	ctxDeadline time.Time
+}
+
+// value gets key, whatever type it is. Types with no good json equivalent
+// are nil.
+func (c *redisConn) value(key string) (interface{}, error) {
+	t, err := c.do("TYPE", key)
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case "string":
+		v, err := c.do("GET", key)
+		if s, ok := v.(string); ok {
+			var decoded interface{}
+			if json.Unmarshal([]byte(s), &decoded) == nil {
+				return decoded, nil
+			}
+		}
+		return v, err
+	case "hash":
+		v, err := c.do("HGETALL", key)
+		if err != nil {
+			return nil, err
+		}
+		pairs, _ := v.([]interface{})
+		m := map[string]interface{}{}
+		for i := 0; i+1 < len(pairs); i += 2 {
+			m[fmt.Sprint(pairs[i])] = pairs[i+1]
+		}
+		return m, nil
+	case "list":
+		return c.do("LRANGE", key, "0", "-1")
+	case "set":
+		return c.do("SMEMBERS", key)
+	}
+	return nil, nil
+}
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	var deadline time.Time
+	if c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+	if !c.ctxDeadline.IsZero() && (deadline.IsZero() || c.ctxDeadline.Before(deadline)) {
+		deadline = c.ctxDeadline
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply from redis")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		list := []interface{}{}
+		for i := 0; i < n; i++ {
+			v, err := c.read()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("bad reply from redis: %q", line)
+}
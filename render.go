@@ -0,0 +1,374 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// An executor is a parsed template, from either text/template or
+// html/template.
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// parseTemplateWith parses text as a template, using html/template if html
+// is set, and rewrites it with any instruments. extra are functions on top of
+// tmplcute's.
+func parseTemplateWith(name, text string, html bool, extra map[string]interface{}) (executor, error) {
+	funcs := templateFuncs(extra)
+	if html {
+		tmpl, err := htemplate.New(name).Funcs(funcs).Parse(text)
+		if err != nil {
+			return nil, extendedHint(err)
+		}
+		for _, t := range tmpl.Templates() {
+			instrumentTree(t.Tree)
+		}
+		return tmpl, nil
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, extendedHint(err)
+	}
+	for _, t := range tmpl.Templates() {
+		instrumentTree(t.Tree)
+	}
+	return tmpl, nil
+}
+
+// templateFuncs are the functions templates are parsed with: tmplcute's,
+// any instruments', and then extra.
+func templateFuncs(extra map[string]interface{}) map[string]interface{} {
+	funcs := instrumentFuncs(funcMap())
+	for name, fn := range extra {
+		funcs[name] = fn
+	}
+	funcs["try"] = tryIn(funcs)
+	return funcs
+}
+
+// render parses text as a template and executes it onto w using obj, with
+// html/template if html is set. A template from elsewhere, as its name says,
+// is untrusted.
+func render(name, text string, html bool, obj interface{}, w io.Writer) error {
+	return renderAs(name, text, html, remoteTemplate(name), obj, w)
+}
+
+// renderAs is render, with the sandbox's functions if untrusted is set.
+func renderAs(name, text string, html, untrusted bool, obj interface{}, w io.Writer) error {
+	start := time.Now()
+	tmpl, err := cachedTemplate(name, text, html, untrusted)
+	timing("parse "+name, start)
+	if err != nil {
+		return err
+	}
+	return execute(tmpl, name, text, obj, w)
+}
+
+// execute executes tmpl, parsed from text, onto w using obj.
+func execute(tmpl executor, name, text string, obj interface{}, w io.Writer) error {
+	start := time.Now()
+	err := tmpl.Execute(w, obj)
+	timing("execute "+name, start)
+	if err != nil {
+		return explainExec(err, name, text)
+	}
+	return nil
+}
+
+// timing reports how long it has been since start, if --timings was given.
+func timing(what string, start time.Time) {
+	if options.timings {
+		d := time.Since(start)
+		logMsg(logInfo, "", fmt.Sprintf("%s: %v", what, d), "step", what, "seconds", d.Seconds())
+	}
+}
+
+// A renderJob executes the template in one file, writing the result to
+// another.
+type renderJob struct {
+	template string
+	output   string
+	// dir, if set, is what a relative output in the front matter is
+	// relative to, as it is for -r.
+	dir string
+	// mode, if set, is given to the output when the front matter gives none.
+	mode os.FileMode
+}
+
+func (j renderJob) run(ctx context.Context, obj interface{}) error {
+	text, err := readTemplate(ctx, j.template)
+	if err != nil {
+		return &stageError{stage: "load", file: j.template, err: err}
+	}
+	if isRaw(j.template, text) {
+		if j.output == "" {
+			return fmt.Errorf("%s is copied as it is, so it needs an OUTPUT", j.template)
+		}
+		return copyRaw(j.template, text, j.output)
+	}
+	return j.renderText(text, obj)
+}
+
+// renderText executes text, the job's template, writing the result to the
+// job's output, or to where its front matter says.
+func (j renderJob) renderText(text string, obj interface{}) error {
+	name, output := j.template, j.output
+	fm, text := splitFrontMatter(text)
+	spec, err := fm.resolve(name, obj)
+	if err != nil || spec.skip {
+		return err
+	}
+	if spec.output != "" {
+		output = spec.output
+		if j.dir != "" {
+			if output, err = underDir(j.dir, output); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	if spec.mode == 0 {
+		spec.mode = j.mode
+	}
+	if output == "" {
+		return fmt.Errorf("%s has nowhere to go: give it an OUTPUT, or an output in its front matter", name)
+	}
+	var buf bytes.Buffer
+	err = render(name, text, htmlFor(output), obj, &buf)
+	skip, err := skipOutput(buf.Bytes(), err)
+	if err != nil || skip {
+		return err
+	}
+	if err := writeOutput(output, buf.Bytes(), spec.mode); err != nil {
+		return &stageError{stage: "write", file: output, err: err}
+	}
+	return nil
+}
+
+// underDir is output, from a template's front matter, under dir, where -r
+// writes. Relative outputs are relative to dir, and neither kind can leave
+// it.
+func underDir(dir, output string) (string, error) {
+	path := output
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("the front matter's output %s is outside %s", output, dir)
+	}
+	return filepath.Clean(path), nil
+}
+
+// toStdout reports whether any templates are executed onto stdout: those
+// given with -f, or with no --render, the one on stdin.
+func toStdout() bool {
+	return len(options.files) != 0 || !hasRenders()
+}
+
+// stdoutTemplates reads the templates executed onto stdout, in order.
+func stdoutTemplates(ctx context.Context) ([]page, error) {
+	if len(options.files) == 0 {
+		text, err := stdinTemplate()
+		if err != nil {
+			return nil, err
+		}
+		return []page{{"tmplcute", text, false}}, nil
+	}
+	var pages []page
+	for _, file := range options.files {
+		text, err := readTemplate(ctx, file)
+		if err != nil {
+			return nil, &stageError{stage: "load", file: file, err: err}
+		}
+		pages = append(pages, page{file, text, isRaw(file, text)})
+	}
+	return pages, nil
+}
+
+// renderStdout executes the templates from -f, or the one on stdin, onto
+// stdout in turn, or into the -o file.
+func renderStdout(ctx context.Context, obj interface{}) error {
+	pages, err := stdoutTemplates(ctx)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	var buf bytes.Buffer
+	if options.output != "" {
+		w = &buf
+	}
+	// The -o file is only written if some template wasn't skipped.
+	wrote := false
+	for _, p := range pages {
+		if p.raw {
+			if _, err := io.WriteString(w, p.text); err != nil {
+				return err
+			}
+			wrote = true
+			continue
+		}
+		skip, err := renderOnto(w, p.name, p.text, obj)
+		if err != nil {
+			return err
+		}
+		wrote = wrote || !skip
+	}
+	if options.output == "" || !wrote {
+		return nil
+	}
+	if skip, _ := skipOutput(buf.Bytes(), nil); skip {
+		return nil
+	}
+	if err := writeOutput(options.output, buf.Bytes(), options.outputMode); err != nil {
+		return &stageError{stage: "write", file: options.output, err: err}
+	}
+	return nil
+}
+
+// renderOnto executes text, the template called name, onto w, unless its
+// front matter says where else. It reports whether the template was skipped,
+// by its front matter or skipFile; what it wrote before calling skipFile
+// stays written.
+func renderOnto(w io.Writer, name, text string, obj interface{}) (bool, error) {
+	fm, body := splitFrontMatter(text)
+	spec, err := fm.resolve(name, obj)
+	if err != nil || spec.skip {
+		return spec.skip, err
+	}
+	if spec.output != "" {
+		return true, renderJob{template: name}.renderText(text, obj)
+	}
+	err = render(name, body, options.html, obj, w)
+	if errors.Is(err, errSkipFile) {
+		return true, nil
+	}
+	return false, err
+}
+
+// readTemplate reads the template in path, which may be a URL or an S3 or
+// GCS object.
+func readTemplate(ctx context.Context, path string) (string, error) {
+	if isURL(path) {
+		return fetchText(ctx, path)
+	}
+	if isObjectURI(path) {
+		text, err := readObject(ctx, path)
+		return string(text), err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var size int64
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	return readText(f, size)
+}
+
+// templateTexts returns the text of every template to be rendered, by name:
+// the --renders and -r trees, and the -f ones or else the one on stdin.
+func templateTexts(ctx context.Context) (map[string]string, error) {
+	texts := map[string]string{}
+	if toStdout() {
+		pages, err := stdoutTemplates(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pages {
+			if !p.raw {
+				texts[p.name] = p.text
+			}
+		}
+	}
+	jobs, err := renderJobs()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		text, err := readTemplate(ctx, job.template)
+		if err != nil {
+			return nil, err
+		}
+		if isRaw(job.template, text) {
+			continue
+		}
+		texts[job.template] = text
+	}
+	return texts, nil
+}
+
+// runJobs runs every job using n workers. All jobs are attempted, and the
+// errors from any that fail are returned together.
+func runJobs(ctx context.Context, jobs []renderJob, obj interface{}, n int) error {
+	if n < 1 {
+		n = 1
+	}
+	errs := make([]error, len(jobs))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				errs[i] = jobs[i].run(ctx, obj)
+			}
+		}()
+	}
+	for i := range jobs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	var failed errorList
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", jobs[i].output, err))
+		}
+	}
+	if len(failed) != 0 {
+		return failed
+	}
+	return nil
+}
+
+// errorList is several errors reported as one, a line each.
+type errorList []error
+
+func (e errorList) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
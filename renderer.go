@@ -0,0 +1,267 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tmplcute executes Go templates with an object built up from data
+// files, URLs and KEY=VALUE settings, like the tmplcute command does.
+package tmplcute
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skelterjohn/tmplcute/keys"
+)
+
+// A FuncMap is functions for a Renderer's template to call, like
+// text/template's FuncMap.
+type FuncMap map[string]interface{}
+
+// A Renderer executes a template with an object built up the way tmplcute's
+// command line builds one. Once it is set up, it can Execute from many
+// goroutines at once. Each Renderer has settings of its own, like the
+// command's --merge and --allow-WHAT, which the command's flags don't change.
+type Renderer struct {
+	name, text string
+	// data points to the object: a map[string]interface{}, or whatever
+	// NewTyped was given.
+	data   interface{}
+	funcs  FuncMap
+	html   bool
+	config config
+
+	mu   sync.Mutex
+	tmpl executor
+}
+
+// New returns a Renderer with an empty object and an empty template.
+func New() *Renderer {
+	return NewTyped(&map[string]interface{}{})
+}
+
+// NewTyped returns a Renderer whose object is the one ptr points to, like a
+// struct of the program's own, with an empty template. The data files are
+// decoded onto it as their formats decode onto that type, going by its json
+// or yaml tags, and Set finds fields as tmplcute's KEYs do. The template is
+// executed with ptr as its dot, so it can call the type's methods.
+func NewTyped(ptr interface{}) *Renderer {
+	return &Renderer{name: "tmplcute", data: ptr, config: config{timeout: defaultTimeout}}
+}
+
+// Template sets the text of the template to execute, and what it is called
+// in errors.
+func (r *Renderer) Template(name, text string) {
+	r.name, r.text = name, text
+	r.reset()
+}
+
+// AddDataFile decodes the document in the file at path onto the object, as
+// a FILE argument to tmplcute does: its extension says what format it is in,
+// it is merged onto what is there as --merge and --array-merge say, and a
+// FILE@KEY puts it at KEY.
+func (r *Renderer) AddDataFile(path string) error {
+	return r.AddDataFileContext(context.Background(), path)
+}
+
+// AddDataFileContext is AddDataFile, giving up once ctx is done, as fetching
+// what the file includes or refers to does.
+func (r *Renderer) AddDataFileContext(ctx context.Context, path string) error {
+	if strings.HasPrefix(path, "-") {
+		// Not a --KEY=VALUE.
+		path = "./" + path
+	}
+	return source{arg: path}.add(withConfig(ctx, &r.config), r.data)
+}
+
+// AddURL fetches the document at the http://, https://, s3:// or gs:// URL u,
+// and decodes it onto the object, as AddDataFile does a file's.
+func (r *Renderer) AddURL(u string) error {
+	return r.AddURLContext(context.Background(), u)
+}
+
+// AddURLContext is AddURL, giving up once ctx is done.
+func (r *Renderer) AddURLContext(ctx context.Context, u string) error {
+	if !isURL(u) && !isObjectURI(u) {
+		return fmt.Errorf("%q is not a URL", u)
+	}
+	return source{arg: u}.add(withConfig(ctx, &r.config), r.data)
+}
+
+// Set sets the value at key in the object, as --KEY=VALUE does. With
+// StrictTypes, it fails rather than change the type of what is at key.
+func (r *Renderer) Set(key, value string) error {
+	if r.config.strictTypes {
+		return r.config.override(r.data, key, value)
+	}
+	return keys.Overwrite(r.data, key, value)
+}
+
+// Merge sets how each data file's document combines with what is there, as
+// --merge does: "deep", the default, "shallow" or "replace".
+func (r *Renderer) Merge(how string) error {
+	return r.config.setMerge(how)
+}
+
+// ArrayMerge sets how a list in a data file combines with the list already
+// in its place, as --array-merge does: "replace", the default, "append",
+// "merge-by-index" or "merge-by=KEY".
+func (r *Renderer) ArrayMerge(strategy string) error {
+	return r.config.setArrayMerge(strategy)
+}
+
+// NullDeletes sets whether a null in a data file takes the field away, as
+// --null-deletes does, rather than setting it to null.
+func (r *Renderer) NullDeletes(deletes bool) {
+	r.config.nullDeletes = deletes
+}
+
+// StrictTypes sets whether Set fails, as --strict-types makes --KEY=VALUE
+// fail, when the value would change the type of what is at its key.
+func (r *Renderer) StrictTypes(strict bool) {
+	r.config.strictTypes = strict
+}
+
+// Timeout sets how long fetching a URL, or what the template fetches or
+// runs, can take, as --timeout does. The default is 30s.
+func (r *Renderer) Timeout(d time.Duration) {
+	r.config.timeout = d
+}
+
+// Allow lets the template do what, as --allow-WHAT does: "exec" lets it run
+// commands, "file" read files, "env" see the environment and "network"
+// fetch URLs. Nothing is allowed until it is.
+func (r *Renderer) Allow(what string) error {
+	known := false
+	for _, f := range gatedFuncs {
+		known = known || f.allow == what
+	}
+	if !known {
+		return fmt.Errorf(`what can be allowed is "exec", "file", "env" or "network", not %q`, what)
+	}
+	if r.config.allowed == nil {
+		r.config.allowed = map[string]bool{}
+	}
+	r.config.allowed[what] = true
+	r.reset()
+	return nil
+}
+
+// Funcs adds to the functions the template can call, replacing any of
+// tmplcute's own with the same names.
+func (r *Renderer) Funcs(funcs FuncMap) {
+	if r.funcs == nil {
+		r.funcs = FuncMap{}
+	}
+	for name, fn := range funcs {
+		r.funcs[name] = fn
+	}
+	r.reset()
+}
+
+// UseHTML sets whether the template is executed with html/template, which
+// escapes what it prints, rather than text/template.
+func (r *Renderer) UseHTML(html bool) {
+	r.html = html
+	r.reset()
+}
+
+// Execute executes the template onto w.
+func (r *Renderer) Execute(w io.Writer) error {
+	return r.ExecuteContext(context.Background(), w)
+}
+
+// ExecuteContext is Execute, giving up once ctx is done: the next time the
+// template writes, or as what it includes, runs or fetches. It is named
+// apart from Execute, as database/sql's QueryContext is from Query, so that
+// Execute keeps its one argument.
+func (r *Renderer) ExecuteContext(ctx context.Context, w io.Writer) error {
+	tmpl, err := r.parsed()
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Each execution gets its own copy, whose functions go by ctx. The
+	// parsed template is never executed itself, since html/template can't
+	// copy one that has been.
+	if tmpl, err = withFuncs(tmpl, templateFuncs(r.extraFuncs(ctx))); err != nil {
+		return err
+	}
+	dot := r.data
+	if m, ok := dot.(*map[string]interface{}); ok {
+		// The functions that take the whole object expect the map itself.
+		dot = *m
+	}
+	if err := tmpl.Execute(ctxWriter{ctx, w}, dot); err != nil {
+		return explainExec(err, r.name, r.text)
+	}
+	return nil
+}
+
+// parsed returns the template, parsing it if it hasn't been since it last
+// changed.
+func (r *Renderer) parsed() (executor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tmpl == nil {
+		tmpl, err := parseTemplateWith(r.name, r.text, r.html, r.extraFuncs(context.Background()))
+		if err != nil {
+			return nil, err
+		}
+		r.tmpl = tmpl
+	}
+	return r.tmpl, nil
+}
+
+// extraFuncs are the functions the template gets on top of tmplcute's own:
+// include and the gated functions, which go by ctx and the Renderer's
+// settings rather than the command's, and then r.funcs.
+func (r *Renderer) extraFuncs(ctx context.Context) map[string]interface{} {
+	ctx = withConfig(ctx, &r.config)
+	extra := map[string]interface{}{
+		"include": func(path string, data interface{}) (interface{}, error) {
+			return includeAt(ctx, path, data, false, 1)
+		},
+	}
+	gate(ctx, extra)
+	for name, fn := range r.funcs {
+		extra[name] = fn
+	}
+	return extra
+}
+
+func (r *Renderer) reset() {
+	r.mu.Lock()
+	r.tmpl = nil
+	r.mu.Unlock()
+}
+
+// A ctxWriter stops writing once its context is done.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw ctxWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
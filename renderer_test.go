@@ -0,0 +1,161 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRendererAddDataFile(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"a.json": `{"db":{"host":"a","port":1}}`,
+		"b.yaml": "db:\n  host: b\n",
+		"c.json": `{"user":"c"}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := New()
+	for _, f := range []string{"a.json", "b.yaml", "c.json@owner"} {
+		if err := r.AddDataFile(filepath.Join(dir, f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Template("t", "{{.db.host}}:{{.db.port}} {{.owner.user}}")
+	var buf bytes.Buffer
+	if err := r.Execute(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "b:1 c"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRendererAddURLContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"a":1}`))
+	}))
+	defer server.Close()
+
+	r := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.AddURLContext(ctx, server.URL); err == nil {
+		t.Errorf("fetching with a canceled context gave no error")
+	}
+	if err := r.AddURLContext(context.Background(), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddURL("a.json"); err == nil {
+		t.Errorf("AddURL of a file gave no error")
+	}
+}
+
+func TestRendererSettings(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"a.json": `{"db":{"host":"a","port":1},"tags":["x"]}`,
+		"b.json": `{"db":{"host":"b"},"tags":["y"]}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TMPLCUTE_TEST_ENV", "set")
+	const text = `{{.db.host}}:{{.db.port}} {{.tags}} {{env "TMPLCUTE_TEST_ENV"}}`
+
+	deep, shallow := New(), New()
+	if err := shallow.Merge("shallow"); err != nil {
+		t.Fatal(err)
+	}
+	if err := shallow.ArrayMerge("append"); err != nil {
+		t.Fatal(err)
+	}
+	if err := shallow.Allow("env"); err != nil {
+		t.Fatal(err)
+	}
+	if err := deep.Merge("deeper"); err == nil {
+		t.Errorf("Merge(%q) gave no error", "deeper")
+	}
+	if err := deep.Allow("everything"); err == nil {
+		t.Errorf("Allow(%q) gave no error", "everything")
+	}
+	for _, r := range []*Renderer{deep, shallow} {
+		for _, f := range []string{"a.json", "b.json"} {
+			if err := r.AddDataFile(filepath.Join(dir, f)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r.Template("t", text)
+	}
+
+	var buf bytes.Buffer
+	if err := deep.Execute(&buf); err == nil {
+		t.Errorf("env ran without Allow, giving %q", buf.String())
+	}
+	buf.Reset()
+	if err := shallow.Execute(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "b:<no value> [x y] set"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	deep.StrictTypes(true)
+	if err := deep.Set("db.port", "two"); err == nil {
+		t.Errorf("Set made a number a string with StrictTypes")
+	}
+	if err := shallow.Set("db.port", "two"); err != nil {
+		t.Errorf("Set without StrictTypes: %v", err)
+	}
+}
+
+func TestRendererExecuteContextFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	r := New()
+	if err := r.Allow("network"); err != nil {
+		t.Fatal(err)
+	}
+	r.Template("t", `{{fetch "`+server.URL+`"}}`)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- r.ExecuteContext(ctx, &bytes.Buffer{}) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("fetching past the deadline gave no error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("fetch didn't give up when the context was done")
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func init() {
+	options.retryBackoff = time.Second
+	optionTable = append(optionTable,
+		option{
+			names: []string{"--retries"},
+			value: "N",
+			usage: "try fetching data from elsewhere N more times if it fails (default is 0)",
+			set: func(n string) error {
+				var err error
+				options.retries, err = strconv.Atoi(n)
+				if err == nil && options.retries < 0 {
+					err = fmt.Errorf("--retries can't be negative")
+				}
+				return err
+			},
+		},
+		option{
+			names: []string{"--retry-backoff"},
+			value: "DURATION",
+			usage: "wait DURATION before the first retry, and twice as long before each one after that (default is 1s)",
+			set: func(d string) error {
+				var err error
+				options.retryBackoff, err = time.ParseDuration(d)
+				return err
+			},
+		},
+	)
+}
+
+// retry calls try until it succeeds, it has been retried --retries times, or
+// ctx is done, backing off between tries. If every try fails, the error says what went
+// wrong each time.
+func retry(ctx context.Context, try func() error) error {
+	var errs errorList
+	wait := options.retryBackoff
+	for {
+		err := try()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+		if len(errs) > options.retries || !retryable(err) {
+			break
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("stopped retrying: %v\n%v", ctx.Err(), errs)
+		}
+		wait *= 2
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return fmt.Errorf("gave up after %d tries:\n%v", len(errs), errs)
+}
+
+// retryable reports whether trying again might help. A server that says the
+// request is wrong will keep saying so, unless it is only asking for less.
+func retryable(err error) bool {
+	if s, ok := err.(*statusError); ok {
+		return s.code >= 500 || s.code == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/skelterjohn/tmplcute/keys"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--strict-types"},
+		usage: "make it an error, not a warning, for a --KEY=VALUE to change the type of what is at KEY, like a number becoming a string",
+		set: func(string) error {
+			options.strictTypes = true
+			return nil
+		},
+	})
+}
+
+// override is Overwrite for --KEY=VALUE, which warns when the value at key
+// has to change type, since VALUE didn't look like what was there. With
+// --strict-types, as c says, that is an error.
+func (c *config) override(obj interface{}, key, value string) error {
+	if isSecret(key) {
+		noteSecrets(&map[string]interface{}{key: value})
+	}
+	if old, _ := keys.Lookup(obj, key); old != nil {
+		// Find what VALUE would become by setting it over a copy, so that
+		// --strict-types leaves obj alone.
+		probe := map[string]interface{}{"v": old}
+		if err := keys.Overwrite(&probe, "v", value); err == nil {
+			if from, to := jsonType(old), jsonType(probe["v"]); from != to {
+				if c.strictTypes {
+					return fmt.Errorf("%s: %q would make %s into %s", key, value, article(from), article(to))
+				}
+				warnf("%s: %q makes %s into %s", key, value, article(from), article(to))
+			}
+		}
+	}
+	return keys.Overwrite(obj, key, value)
+}
+
+// overrideJSON is override for --KEY:=VALUE, where VALUE is JSON to decode
+// and set as it is, whatever was there before.
+func (c *config) overrideJSON(obj interface{}, key, value string) error {
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return fmt.Errorf("%s: %q is not JSON: %v", key, value, err)
+	}
+	if isSecret(key) {
+		noteSecrets(&map[string]interface{}{key: v})
+	}
+	if c.nullDeletes {
+		if v == nil {
+			return keys.Delete(obj, key)
+		}
+		deleteNulls(v)
+	}
+	return keys.OverwriteValue(obj, key, v)
+}
+
+// jsonType is the JSON Schema type of v, not minding whether a number is
+// whole.
+func jsonType(v interface{}) string {
+	if t := typeName(v); t != "integer" {
+		return t
+	}
+	return "number"
+}
+
+// article puts "a" or "an" before the type t.
+func article(t string) string {
+	if strings.IndexByte("aeiou", t[0]) != -1 {
+		return "an " + t
+	}
+	return "a " + t
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	htemplate "html/template"
+)
+
+func init() {
+	tmplFuncs = append(tmplFuncs,
+		tmplFunc{"safeHTML", safeHTML, "with --html, mark the value as HTML to be printed as it is"},
+		tmplFunc{"safeHTMLAttr", safeHTMLAttr, `with --html, mark the value as an attribute, like name="value", to be printed as it is`},
+		tmplFunc{"safeURL", safeURL, "with --html, mark the value as a URL to be printed as it is, even with a scheme like javascript:"},
+		tmplFunc{"safeJS", safeJS, "with --html, mark the value as JavaScript to be printed as it is"},
+		tmplFunc{"safeCSS", safeCSS, "with --html, mark the value as CSS to be printed as it is"},
+		tmplFunc{"escapeHTML", escapeHTML, "escape the value for HTML, for text/template, where nothing is escaped unless asked"},
+		tmplFunc{"escapeJS", escapeJS, "escape the value for a JavaScript string, for text/template"},
+		tmplFunc{"escapeURL", escapeURL, "escape the value for a URL's query, for text/template"},
+	)
+}
+
+// The safe funcs tell html/template that a value is already what it should
+// be, so it isn't escaped. Without --html they change nothing, since nothing is
+// escaped anyway.
+
+func safeHTML(v interface{}) htemplate.HTML         { return htemplate.HTML(fmt.Sprint(v)) }
+func safeHTMLAttr(v interface{}) htemplate.HTMLAttr { return htemplate.HTMLAttr(fmt.Sprint(v)) }
+func safeURL(v interface{}) htemplate.URL           { return htemplate.URL(fmt.Sprint(v)) }
+func safeJS(v interface{}) htemplate.JS             { return htemplate.JS(fmt.Sprint(v)) }
+func safeCSS(v interface{}) htemplate.CSS           { return htemplate.CSS(fmt.Sprint(v)) }
+
+// The escape funcs are html/template's escaping, for text/template. With --html
+// the value would be escaped twice.
+
+func escapeHTML(v interface{}) string { return htemplate.HTMLEscapeString(fmt.Sprint(v)) }
+func escapeJS(v interface{}) string   { return htemplate.JSEscapeString(fmt.Sprint(v)) }
+func escapeURL(v interface{}) string  { return htemplate.URLQueryEscaper(v) }
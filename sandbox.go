@@ -0,0 +1,340 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// A gatedFunc is a template function that reaches outside the template, and
+// so fails unless --allow-WHAT is given, in or out of the sandbox.
+type gatedFunc struct {
+	tmplFunc
+	allow string
+}
+
+var gatedFuncs = []gatedFunc{
+	{tmplFunc{"env", os.Getenv, "the value of the environment variable NAME, with --allow-env"}, "env"},
+	{tmplFunc{"readFile", readFile, "the contents of the file PATH, with --allow-file"}, "file"},
+	{tmplFunc{"exec", execCommand, "what the command NAME prints when run with ARGS, less the last newline, with --allow-exec"}, "exec"},
+	{tmplFunc{"fetch", fetchURL, "the body of the http:// or https:// URL, with --allow-network"}, "network"},
+}
+
+func init() {
+	for _, f := range gatedFuncs {
+		tmplFuncs = append(tmplFuncs, f.tmplFunc)
+	}
+	tmplFuncs = append(tmplFuncs, tmplFunc{"include", include,
+		"execute the template in PATH with DATA, and give what it printed, nested at most 100 includes deep; in the sandbox, PATH must be under the current directory"})
+
+	optionTable = append(optionTable, option{
+		names: []string{"--sandbox"},
+		usage: "for templates that can't be trusted: only let them include files under the current directory, and none from URLs (the default with --html and --serve, and for templates from URLs and objects, and what they include)",
+		set: func(string) error {
+			options.sandbox = true
+			return nil
+		},
+	})
+	optionTable = append(optionTable,
+		option{
+			names: []string{"--root"},
+			value: "DIR",
+			usage: "only let templates read and include files under DIR, wherever their symlinks lead",
+			set: func(dir string) error {
+				options.root = dir
+				return nil
+			},
+		},
+		option{
+			names: []string{"--no-follow-symlinks"},
+			usage: "don't let templates read or include files through symlinks",
+			set: func(string) error {
+				options.noFollowSymlinks = true
+				return nil
+			},
+		},
+	)
+	for _, allow := range []struct{ what, usage string }{
+		{"exec", "let templates run commands with exec"},
+		{"file", "let templates read files with readFile, and include any file in the sandbox"},
+		{"env", "let templates see the environment with env"},
+		{"network", "let templates fetch URLs with fetch, and include templates from them in the sandbox"},
+	} {
+		what := allow.what
+		optionTable = append(optionTable, option{
+			names: []string{"--allow-" + what},
+			usage: allow.usage,
+			set: func(string) error {
+				if options.allowed == nil {
+					options.allowed = map[string]bool{}
+				}
+				options.allowed[what] = true
+				return nil
+			},
+		})
+	}
+}
+
+// sandboxed reports whether the templates are in the sandbox, which they
+// are with --sandbox, --html or --serve.
+func sandboxed() bool {
+	return options.sandbox || options.html || options.serve != ""
+}
+
+// gate puts the gated functions in funcs as the config ctx carries allows
+// them: the functions themselves, or ones that fail, so that templates using
+// them still parse. What exec and fetch run or get goes by its timeout.
+func gate(ctx context.Context, funcs map[string]interface{}) {
+	c := configFrom(ctx)
+	for _, f := range gatedFuncs {
+		if !c.allowed[f.allow] {
+			funcs[f.name] = denied(f.name, f.allow)
+			continue
+		}
+		funcs[f.name] = f.fn
+	}
+	if c.allowed["exec"] {
+		funcs["exec"] = func(name string, args ...string) (string, error) {
+			return execCommandContext(ctx, name, args...)
+		}
+	}
+	if c.allowed["network"] {
+		funcs["fetch"] = func(u string) (string, error) {
+			return fetchURLContext(ctx, u)
+		}
+	}
+}
+
+func denied(name, allow string) interface{} {
+	return func(...interface{}) (string, error) {
+		return "", fmt.Errorf("%s is not allowed without --allow-%s", name, allow)
+	}
+}
+
+func readFile(path string) (string, error) {
+	if err := checkPath(options.root, path); err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var size int64
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	return readText(f, size)
+}
+
+func execCommand(name string, args ...string) (string, error) {
+	return execCommandContext(context.Background(), name, args...)
+}
+
+func execCommandContext(ctx context.Context, name string, args ...string) (string, error) {
+	out, err := runTool(ctx, name, args...)
+	return strings.TrimSuffix(string(out), "\n"), err
+}
+
+func fetchURL(u string) (string, error) {
+	return fetchURLContext(context.Background(), u)
+}
+
+func fetchURLContext(ctx context.Context, u string) (string, error) {
+	if !isURL(u) {
+		return "", fmt.Errorf("%q is not an http:// or https:// URL", u)
+	}
+	return fetchText(ctx, u)
+}
+
+// include executes another template, with html/template if its extension or
+// --html says so. Then the result has been escaped already, so it is marked as
+// HTML to keep it from being escaped again.
+func include(path string, data interface{}) (interface{}, error) {
+	return includeAt(context.Background(), path, data, false, 1)
+}
+
+// maxIncludeDepth is how deeply includes can be nested, so that a template
+// that includes itself fails rather than running out of stack.
+const maxIncludeDepth = 100
+
+// includeAt is include for a template that is untrusted, or not, and that is
+// depth includes deep, going by the config ctx carries. What an untrusted
+// template includes is untrusted too, and so is a template from a URL or
+// object, wherever it is included from.
+func includeAt(ctx context.Context, path string, data interface{}, untrusted bool, depth int) (interface{}, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("includes are nested over %d deep; does a template include itself?", maxIncludeDepth)
+	}
+	if err := includable(ctx, path, untrusted || sandboxed()); err != nil {
+		return nil, err
+	}
+	untrusted = untrusted || remoteTemplate(path)
+	text, err := readTemplate(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	html := htmlFor(path)
+	start := time.Now()
+	tmpl, err := cachedInclude(path, text, html, untrusted)
+	timing("parse "+path, start)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl, err = includingAt(ctx, tmpl, untrusted, depth+1); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := execute(tmpl, path, text, data, &buf); err != nil {
+		return nil, err
+	}
+	if html {
+		return htemplate.HTML(buf.String()), nil
+	}
+	return buf.String(), nil
+}
+
+// includingAt returns a copy of tmpl whose includes are depth deep. Each
+// execution of an included template gets its own, since the parsed
+// template is shared by every job and request that includes it. Its gated
+// functions are set as the config ctx carries allows.
+func includingAt(ctx context.Context, tmpl executor, untrusted bool, depth int) (executor, error) {
+	extra := map[string]interface{}{
+		"include": func(path string, data interface{}) (interface{}, error) {
+			return includeAt(ctx, path, data, untrusted, depth)
+		},
+	}
+	gate(ctx, extra)
+	return withFuncs(tmpl, templateFuncs(extra))
+}
+
+// withFuncs returns a copy of tmpl that calls funcs instead of the functions
+// of the same names it was parsed with.
+func withFuncs(tmpl executor, funcs map[string]interface{}) (executor, error) {
+	switch t := tmpl.(type) {
+	case *template.Template:
+		c, err := t.Clone()
+		if err != nil {
+			return nil, err
+		}
+		return c.Funcs(funcs), nil
+	case *htemplate.Template:
+		c, err := t.Clone()
+		if err != nil {
+			return nil, err
+		}
+		return c.Funcs(funcs), nil
+	}
+	return nil, fmt.Errorf("cannot copy %T", tmpl)
+}
+
+// includable checks that templates may include path, with the sandbox's
+// rules if sandbox is set, and what the config ctx carries allows.
+func includable(ctx context.Context, path string, sandbox bool) error {
+	allowed := configFrom(ctx).allowed
+	if isURL(path) || isObjectURI(path) {
+		if sandbox && !allowed["network"] {
+			return fmt.Errorf("including %s is not allowed in the sandbox without --allow-network", path)
+		}
+		return nil
+	}
+	root := options.root
+	if root == "" && sandbox && !allowed["file"] {
+		root = "."
+	}
+	return checkPath(root, path)
+}
+
+// remoteTemplate reports whether the template called name comes from a URL
+// or an object, and so can't be trusted.
+func remoteTemplate(name string) bool {
+	return isURL(name) || isObjectURI(name)
+}
+
+// untrustedFuncs are what untrusted templates are parsed with, on top of
+// the rest: an include that keeps to the sandbox's rules outside it too, and
+// keeps what it includes untrusted.
+func untrustedFuncs() map[string]interface{} {
+	funcs := map[string]interface{}{}
+	funcs["include"] = func(path string, data interface{}) (interface{}, error) {
+		return includeAt(context.Background(), path, data, true, 1)
+	}
+	return funcs
+}
+
+// checkPath checks that a template may read the file at path: that it is
+// under root, if there is one, once any symlinks are followed, and that it
+// isn't reached through a symlink at all with --no-follow-symlinks.
+func checkPath(root, path string) error {
+	if options.noFollowSymlinks {
+		if err := noSymlinks(path); err != nil {
+			return err
+		}
+	}
+	if root == "" {
+		return nil
+	}
+	real, err := realPath(path)
+	if err != nil {
+		return err
+	}
+	realRoot, err := realPath(root)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(realRoot, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is not under %s", path, root)
+	}
+	return nil
+}
+
+// realPath is the absolute path to what path refers to, with no symlinks.
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// noSymlinks checks that none of path, or the directories in it, is a
+// symlink.
+func noSymlinks(path string) error {
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		info, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 && p == filepath.Clean(path) {
+			return fmt.Errorf("%s is a symlink", path)
+		} else if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is reached through the symlink %s", path, p)
+		}
+		if dir := filepath.Dir(p); dir == p || p == "." {
+			return nil
+		}
+	}
+}
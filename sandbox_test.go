@@ -0,0 +1,104 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncludeDepth(t *testing.T) {
+	dir := t.TempDir()
+	self := filepath.Join(dir, "self.tmpl")
+	text := `{{if lt (len .) 150}}{{include "` + self + `" (printf "%s." .)}}{{else}}done{{end}}`
+	if err := os.WriteFile(self, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err := render("top", `{{include "`+self+`" ""}}`, false, nil, &buf)
+	if err == nil || !strings.Contains(err.Error(), "nested over 100 deep") {
+		t.Errorf("a template including itself 150 deep gave %v, want over 100 deep", err)
+	}
+
+	// Includes that each stop short of the limit don't add up, even when
+	// a template is included again and again.
+	text = `{{if lt (len .) 99}}{{include "` + self + `" (printf "%s." .)}}{{else}}.{{end}}`
+	if err := os.WriteFile(self, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := render("top", `{{range .}}{{include "`+self+`" ""}}{{end}}`, false, []int{1, 2, 3}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "..." {
+		t.Errorf("got %q, want %q", got, "...")
+	}
+}
+
+func TestGatedFuncs(t *testing.T) {
+	defer func(allowed map[string]bool, sandbox bool) {
+		options.allowed, options.sandbox = allowed, sandbox
+	}(options.allowed, options.sandbox)
+
+	for _, sandbox := range []bool{false, true} {
+		options.allowed, options.sandbox = map[string]bool{"env": true}, sandbox
+		funcs := funcMap()
+		if _, ok := funcs["env"].(func(string) string); !ok {
+			t.Errorf("sandbox %v: env is denied with --allow-env", sandbox)
+		}
+		exec, ok := funcs["exec"].(func(...interface{}) (string, error))
+		if !ok {
+			t.Fatalf("sandbox %v: exec is %T, want it denied", sandbox, funcs["exec"])
+		}
+		if _, err := exec("echo", "hello"); err == nil || !strings.Contains(err.Error(), "--allow-exec") {
+			t.Errorf("sandbox %v: exec: got error %v, want one mentioning --allow-exec", sandbox, err)
+		}
+	}
+	if _, ok := untrustedFuncs()["include"]; !ok {
+		t.Errorf("include isn't replaced for untrusted templates")
+	}
+}
+
+func TestIncludable(t *testing.T) {
+	defer func(allowed map[string]bool, root string) {
+		options.allowed, options.root = allowed, root
+	}(options.allowed, options.root)
+	options.allowed, options.root = map[string]bool{}, ""
+
+	tests := []struct {
+		path    string
+		sandbox bool
+		ok      bool
+	}{
+		{"sandbox.go", true, true},
+		{"../x.tmpl", true, false},
+		{"../x.tmpl", false, true},
+		{"https://example.com/x.tmpl", true, false},
+		{"https://example.com/x.tmpl", false, true},
+	}
+	for _, test := range tests {
+		err := includable(context.Background(), test.path, test.sandbox)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("includable(%q, %v) = %v, want ok %v", test.path, test.sandbox, err, test.ok)
+		}
+	}
+}
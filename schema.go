@@ -0,0 +1,454 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A validator checks values against a JSON Schema. It understands the
+// commonly used keywords: type, enum, const, properties, required,
+// additionalProperties, items, the numeric, string and array bounds, pattern,
+// format, allOf, anyOf, oneOf, not, and local $refs. A schema with any other
+// is refused, rather than letting anything pass.
+type validator struct {
+	root map[string]interface{}
+}
+
+// violation is a place where a value does not match its schema.
+type violation struct {
+	path string
+	msg  string
+}
+
+func (v violation) Error() string { return v.String() }
+
+func (v violation) String() string {
+	path := v.path
+	if path == "" {
+		path = "(root)"
+	}
+	return path + ": " + v.msg
+}
+
+func newValidator(schema interface{}) (*validator, error) {
+	root, ok := jsonable(schema).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema must be an object, not %T", schema)
+	}
+	if err := checkKeywords(root, "#"); err != nil {
+		return nil, err
+	}
+	return &validator{root: root}, nil
+}
+
+// keywords are the keywords a validator checks, and those that only say
+// something about a schema, like its title, or hold schemas for $refs.
+var keywords = map[string]bool{
+	"type": true, "enum": true, "const": true,
+	"properties": true, "required": true, "additionalProperties": true,
+	"minProperties": true, "maxProperties": true,
+	"items": true, "minItems": true, "maxItems": true, "uniqueItems": true,
+	"minLength": true, "maxLength": true, "pattern": true, "format": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true,
+	"exclusiveMaximum": true, "multipleOf": true,
+	"allOf": true, "anyOf": true, "oneOf": true, "not": true, "$ref": true,
+
+	"$schema": true, "$id": true, "id": true, "$comment": true,
+	"title": true, "description": true, "default": true, "examples": true,
+	"readOnly": true, "writeOnly": true, "deprecated": true,
+	"definitions": true, "$defs": true,
+}
+
+// formats check the strings of each format a validator knows.
+var formats = map[string]func(string) bool{
+	"date-time": func(s string) bool {
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	},
+	"date": func(s string) bool {
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	},
+	"time": func(s string) bool {
+		_, err := time.Parse("15:04:05Z07:00", s)
+		return err == nil
+	},
+	"email": func(s string) bool {
+		a, err := mail.ParseAddress(s)
+		return err == nil && a.Address == s
+	},
+	"hostname": hostnameRE.MatchString,
+	"ipv4": func(s string) bool {
+		ip := net.ParseIP(s)
+		return ip != nil && ip.To4() != nil && !strings.Contains(s, ":")
+	},
+	"ipv6": func(s string) bool {
+		return net.ParseIP(s) != nil && strings.Contains(s, ":")
+	},
+	"uri": func(s string) bool {
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != ""
+	},
+	"uuid": uuidRE.MatchString,
+}
+
+var (
+	hostnameRE = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+	uuidRE     = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// checkKeywords returns an error for the first keyword, in schema or the
+// schemas in it, that a validator doesn't understand, or a format it doesn't
+// know. at is where schema is, as a $ref would point to it.
+func checkKeywords(schema map[string]interface{}, at string) error {
+	for _, name := range sortedKeys(schema) {
+		if !keywords[name] {
+			return fmt.Errorf("%s: the keyword %q isn't supported", at, name)
+		}
+	}
+	if f, ok := schema["format"].(string); ok && formats[f] == nil {
+		return fmt.Errorf("%s: the format %q isn't supported", at, f)
+	}
+	for _, name := range []string{"additionalProperties", "items", "not"} {
+		if sub, ok := schema[name].(map[string]interface{}); ok {
+			if err := checkKeywords(sub, at+"/"+name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range []string{"properties", "definitions", "$defs"} {
+		subs, _ := schema[name].(map[string]interface{})
+		for _, k := range sortedKeys(subs) {
+			if sub, ok := subs[k].(map[string]interface{}); ok {
+				k = strings.Replace(strings.Replace(k, "~", "~0", -1), "/", "~1", -1)
+				if err := checkKeywords(sub, at+"/"+name+"/"+k); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, name := range []string{"items", "allOf", "anyOf", "oneOf"} {
+		subs, _ := schema[name].([]interface{})
+		for i, sub := range subs {
+			if sub, ok := sub.(map[string]interface{}); ok {
+				if err := checkKeywords(sub, fmt.Sprintf("%s/%s/%d", at, name, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validate returns every violation of the schema by obj.
+func (s *validator) validate(obj interface{}) []violation {
+	return s.check(s.root, "", jsonable(obj), nil)
+}
+
+func (s *validator) check(schema map[string]interface{}, path string, v interface{}, vs []violation) []violation {
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := s.resolve(ref)
+		if err != nil {
+			return append(vs, violation{path, err.Error()})
+		}
+		return s.check(target, path, v, vs)
+	}
+	fail := func(format string, args ...interface{}) {
+		vs = append(vs, violation{path, fmt.Sprintf(format, args...)})
+	}
+
+	if t, ok := schema["type"]; ok {
+		types := []string{}
+		switch t := t.(type) {
+		case string:
+			types = append(types, t)
+		case []interface{}:
+			for _, x := range t {
+				types = append(types, fmt.Sprint(x))
+			}
+		}
+		matched := false
+		for _, t := range types {
+			if hasType(v, t) {
+				matched = true
+			}
+		}
+		if !matched {
+			fail("expected %s, got %s", strings.Join(types, " or "), typeName(v))
+			return vs
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if sameValue(e, v) {
+				found = true
+			}
+		}
+		if !found {
+			fail("%s is not one of %s", compact(v), compact(enum))
+		}
+	}
+	if c, ok := schema["const"]; ok && !sameValue(c, v) {
+		fail("%s is not %s", compact(v), compact(c))
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		vs = s.checkObject(schema, path, v, vs)
+	case []interface{}:
+		vs = s.checkArray(schema, path, v, vs)
+	case string:
+		if n, ok := number(schema["minLength"]); ok && float64(utf8.RuneCountInString(v)) < n {
+			fail("shorter than %v", n)
+		}
+		if n, ok := number(schema["maxLength"]); ok && float64(utf8.RuneCountInString(v)) > n {
+			fail("longer than %v", n)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				fail("bad pattern %q: %v", p, err)
+			} else if !re.MatchString(v) {
+				fail("%q does not match %q", v, p)
+			}
+		}
+		if f, ok := schema["format"].(string); ok && formats[f] != nil && !formats[f](v) {
+			fail("%q is not a %s", v, f)
+		}
+	}
+	if n, ok := number(v); ok {
+		if min, ok := number(schema["minimum"]); ok && n < min {
+			fail("%v is less than %v", n, min)
+		}
+		if max, ok := number(schema["maximum"]); ok && n > max {
+			fail("%v is greater than %v", n, max)
+		}
+		if min, ok := number(schema["exclusiveMinimum"]); ok && n <= min {
+			fail("%v is not greater than %v", n, min)
+		}
+		if max, ok := number(schema["exclusiveMaximum"]); ok && n >= max {
+			fail("%v is not less than %v", n, max)
+		}
+		if m, ok := number(schema["multipleOf"]); ok && m != 0 && math.Mod(n, m) != 0 {
+			fail("%v is not a multiple of %v", n, m)
+		}
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if sub, ok := sub.(map[string]interface{}); ok {
+				vs = s.check(sub, path, v, vs)
+			}
+		}
+	}
+	if any, ok := schema["anyOf"].([]interface{}); ok && s.matches(any, v) == 0 {
+		fail("matches none of anyOf")
+	}
+	if one, ok := schema["oneOf"].([]interface{}); ok {
+		if n := s.matches(one, v); n != 1 {
+			fail("matches %d of oneOf, not 1", n)
+		}
+	}
+	if not, ok := schema["not"].(map[string]interface{}); ok && len(s.check(not, path, v, nil)) == 0 {
+		fail("matches not")
+	}
+	return vs
+}
+
+func (s *validator) checkObject(schema map[string]interface{}, path string, v map[string]interface{}, vs []violation) []violation {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			name := fmt.Sprint(name)
+			if _, ok := v[name]; !ok {
+				vs = append(vs, violation{fieldPath(path, name), "is required"})
+			}
+		}
+	}
+	props, _ := schema["properties"].(map[string]interface{})
+	names := []string{}
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if sub, ok := props[name].(map[string]interface{}); ok {
+			vs = s.check(sub, fieldPath(path, name), v[name], vs)
+			continue
+		}
+		if _, ok := props[name]; ok {
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				vs = append(vs, violation{fieldPath(path, name), "is not allowed"})
+			}
+		case map[string]interface{}:
+			vs = s.check(extra, fieldPath(path, name), v[name], vs)
+		}
+	}
+	if n, ok := number(schema["minProperties"]); ok && float64(len(v)) < n {
+		vs = append(vs, violation{path, fmt.Sprintf("has fewer than %v properties", n)})
+	}
+	if n, ok := number(schema["maxProperties"]); ok && float64(len(v)) > n {
+		vs = append(vs, violation{path, fmt.Sprintf("has more than %v properties", n)})
+	}
+	return vs
+}
+
+func (s *validator) checkArray(schema map[string]interface{}, path string, v []interface{}, vs []violation) []violation {
+	switch items := schema["items"].(type) {
+	case map[string]interface{}:
+		for i, elem := range v {
+			vs = s.check(items, indexPath(path, i), elem, vs)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			if i >= len(items) {
+				break
+			}
+			if sub, ok := items[i].(map[string]interface{}); ok {
+				vs = s.check(sub, indexPath(path, i), elem, vs)
+			}
+		}
+	}
+	if n, ok := number(schema["minItems"]); ok && float64(len(v)) < n {
+		vs = append(vs, violation{path, fmt.Sprintf("has fewer than %v items", n)})
+	}
+	if n, ok := number(schema["maxItems"]); ok && float64(len(v)) > n {
+		vs = append(vs, violation{path, fmt.Sprintf("has more than %v items", n)})
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := range v {
+			for j := 0; j < i; j++ {
+				if sameValue(v[i], v[j]) {
+					vs = append(vs, violation{indexPath(path, i), fmt.Sprintf("duplicates %s", indexPath(path, j))})
+				}
+			}
+		}
+	}
+	return vs
+}
+
+// matches counts how many of the schemas v satisfies.
+func (s *validator) matches(schemas []interface{}, v interface{}) int {
+	n := 0
+	for _, sub := range schemas {
+		if sub, ok := sub.(map[string]interface{}); ok && len(s.check(sub, "", v, nil)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// resolve finds the schema for a local $ref, like "#/definitions/port".
+func (s *validator) resolve(ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("only local $refs are supported, not %q", ref)
+	}
+	var cur interface{} = s.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref[1:], "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("bad $ref %q", ref)
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, fmt.Errorf("bad $ref %q", ref)
+		}
+	}
+	m, ok := cur.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("bad $ref %q", ref)
+	}
+	return m, nil
+}
+
+func hasType(v interface{}, t string) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	case "number":
+		_, ok := number(v)
+		return ok
+	case "integer":
+		n, ok := number(v)
+		return ok && n == math.Trunc(n)
+	}
+	return false
+}
+
+func typeName(v interface{}) string {
+	for _, t := range []string{"object", "array", "string", "boolean", "null", "integer", "number"} {
+		if hasType(v, t) {
+			return t
+		}
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// number returns v as a float64, if it is a number.
+func number(v interface{}) (float64, bool) {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return normalNumber(v).(float64), true
+	}
+	return 0, false
+}
+
+// sameValue compares two decoded values, treating all numbers alike.
+func sameValue(a, b interface{}) bool {
+	return len(diffValues("", jsonable(a), jsonable(b), nil)) == 0
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidator(t *testing.T) {
+	tests := []struct {
+		schema string
+		value  string
+		ok     bool
+	}{
+		{`{"type":"string"}`, `"x"`, true},
+		{`{"type":"string"}`, `1`, false},
+		{`{"type":["integer","null"]}`, `null`, true},
+		{`{"type":"integer"}`, `1.5`, false},
+		{`{"enum":["a",1]}`, `1`, true},
+		{`{"enum":["a",1]}`, `"b"`, false},
+		{`{"const":{"a":[1]}}`, `{"a":[1]}`, true},
+		{`{"const":{"a":[1]}}`, `{"a":[2]}`, false},
+		{`{"properties":{"a":{"type":"string"}}}`, `{"a":"x","b":1}`, true},
+		{`{"properties":{"a":{"type":"string"}}}`, `{"a":1}`, false},
+		{`{"required":["a"]}`, `{"a":null}`, true},
+		{`{"required":["a"]}`, `{"b":1}`, false},
+		{`{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1}`, true},
+		{`{"properties":{"a":{}},"additionalProperties":false}`, `{"b":1}`, false},
+		{`{"additionalProperties":{"type":"number"}}`, `{"b":1}`, true},
+		{`{"additionalProperties":{"type":"number"}}`, `{"b":"1"}`, false},
+		{`{"minProperties":1,"maxProperties":1}`, `{"a":1}`, true},
+		{`{"minProperties":1}`, `{}`, false},
+		{`{"maxProperties":1}`, `{"a":1,"b":2}`, false},
+		{`{"items":{"type":"number"}}`, `[1,2]`, true},
+		{`{"items":{"type":"number"}}`, `[1,"2"]`, false},
+		{`{"items":[{"type":"number"},{"type":"string"}]}`, `[1,"2",true]`, true},
+		{`{"items":[{"type":"number"},{"type":"string"}]}`, `["1"]`, false},
+		{`{"minItems":1,"maxItems":2}`, `[1]`, true},
+		{`{"minItems":1}`, `[]`, false},
+		{`{"maxItems":2}`, `[1,2,3]`, false},
+		{`{"uniqueItems":true}`, `[1,"1"]`, true},
+		{`{"uniqueItems":true}`, `[1,1.0]`, false},
+		{`{"minLength":2,"maxLength":3}`, `"héé"`, true},
+		{`{"minLength":2}`, `"é"`, false},
+		{`{"maxLength":3}`, `"abcd"`, false},
+		{`{"pattern":"^a+$"}`, `"aa"`, true},
+		{`{"pattern":"^a+$"}`, `"ab"`, false},
+		{`{"format":"date-time"}`, `"2014-01-02T03:04:05Z"`, true},
+		{`{"format":"date-time"}`, `"2014-01-02"`, false},
+		{`{"format":"date"}`, `"2014-01-02"`, true},
+		{`{"format":"date"}`, `"2014-13-02"`, false},
+		{`{"format":"time"}`, `"03:04:05+01:00"`, true},
+		{`{"format":"time"}`, `"3pm"`, false},
+		{`{"format":"email"}`, `"a@example.com"`, true},
+		{`{"format":"email"}`, `"A <a@example.com>"`, false},
+		{`{"format":"hostname"}`, `"api.example.com"`, true},
+		{`{"format":"hostname"}`, `"-api.example.com"`, false},
+		{`{"format":"ipv4"}`, `"10.0.0.1"`, true},
+		{`{"format":"ipv4"}`, `"::1"`, false},
+		{`{"format":"ipv6"}`, `"::1"`, true},
+		{`{"format":"ipv6"}`, `"10.0.0.1"`, false},
+		{`{"format":"uri"}`, `"https://example.com/x"`, true},
+		{`{"format":"uri"}`, `"example.com/x"`, false},
+		{`{"format":"uuid"}`, `"123e4567-e89b-12d3-a456-426614174000"`, true},
+		{`{"format":"uuid"}`, `"123e4567"`, false},
+		{`{"format":"ipv4"}`, `1`, true},
+		{`{"minimum":1,"maximum":2}`, `2`, true},
+		{`{"minimum":1}`, `0`, false},
+		{`{"maximum":2}`, `3`, false},
+		{`{"exclusiveMinimum":1,"exclusiveMaximum":3}`, `2`, true},
+		{`{"exclusiveMinimum":1}`, `1`, false},
+		{`{"exclusiveMaximum":3}`, `3`, false},
+		{`{"multipleOf":0.5}`, `1.5`, true},
+		{`{"multipleOf":2}`, `3`, false},
+		{`{"allOf":[{"type":"number"},{"minimum":1}]}`, `1`, true},
+		{`{"allOf":[{"type":"number"},{"minimum":1}]}`, `0`, false},
+		{`{"anyOf":[{"type":"string"},{"type":"number"}]}`, `1`, true},
+		{`{"anyOf":[{"type":"string"},{"type":"number"}]}`, `true`, false},
+		{`{"oneOf":[{"type":"number"},{"type":"integer"}]}`, `1.5`, true},
+		{`{"oneOf":[{"type":"number"},{"type":"integer"}]}`, `1`, false},
+		{`{"not":{"type":"string"}}`, `1`, true},
+		{`{"not":{"type":"string"}}`, `"x"`, false},
+		{`{"$defs":{"port":{"maximum":65535}},"$ref":"#/$defs/port"}`, `80`, true},
+		{`{"definitions":{"port":{"maximum":65535}},"items":{"$ref":"#/definitions/port"}}`, `[80,70000]`, false},
+		{`{"title":"t","description":"d","default":1,"examples":[1]}`, `"x"`, true},
+	}
+	for _, test := range tests {
+		var schema, value interface{}
+		if err := json.Unmarshal([]byte(test.schema), &schema); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(test.value), &value); err != nil {
+			t.Fatal(err)
+		}
+		v, err := newValidator(schema)
+		if err != nil {
+			t.Errorf("%s: %v", test.schema, err)
+			continue
+		}
+		if vs := v.validate(value); (len(vs) == 0) != test.ok {
+			t.Errorf("%s with %s gave %v, want ok %v", test.schema, test.value, vs, test.ok)
+		}
+	}
+}
+
+func TestValidatorUnsupported(t *testing.T) {
+	for _, schema := range []string{
+		`{"patternProperties":{"^a":{}}}`,
+		`{"if":{"type":"string"},"then":{"minLength":1}}`,
+		`{"properties":{"a":{"contains":{"const":1}}}}`,
+		`{"items":[{}, {"propertyNames":{"maxLength":3}}]}`,
+		`{"$defs":{"a":{"dependentRequired":{}}}}`,
+		`{"format":"credit-card"}`,
+		`{"anyOf":[{"format":"iri"}]}`,
+	} {
+		var s interface{}
+		if err := json.Unmarshal([]byte(schema), &s); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := newValidator(s); err == nil {
+			t.Errorf("%s gave no error", schema)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/skelterjohn/tmplcute/keys"
+)
+
+func init() {
+	options.maxBody = 1 << 20
+	optionTable = append(optionTable,
+		option{
+			names: []string{"--serve"},
+			value: "ADDR",
+			usage: `instead of executing the templates once, serve them over HTTP at ADDR, like localhost:8080: the one on stdin at /, or each -f TEMPLATE at /TEMPLATE, each --render's TEMPLATE at /OUTPUT, and each file in a -r SRC_DIR at its path in it`,
+			set: func(addr string) error {
+				options.serve = addr
+				return nil
+			},
+		},
+		option{
+			names: []string{"--max-body"},
+			value: "N",
+			usage: "with --serve, refuse requests whose bodies are over N bytes (default is 1048576)",
+			set: func(n string) error {
+				var err error
+				options.maxBody, err = strconv.ParseInt(n, 10, 64)
+				if err == nil && options.maxBody < 0 {
+					err = fmt.Errorf("%d is negative", options.maxBody)
+				}
+				return err
+			},
+		},
+		option{
+			names: []string{"--reload"},
+			usage: "with --serve, rebuild the object and reread the templates when their files change; templates that are included are always read afresh",
+			set: func(string) error {
+				options.reload = true
+				return nil
+			},
+		},
+	)
+}
+
+// A site is what is being served: the object and the templates. A new one
+// replaces it whole when --reload sees a change, so requests already being
+// answered finish with the one they started with.
+type site struct {
+	obj   map[string]interface{}
+	pages map[string]page
+}
+
+// A page is a template that is served.
+type page struct {
+	name, text string
+	// raw is set for a template that --raw says, or being binary, is served
+	// as it is.
+	raw bool
+}
+
+// serve serves the templates, built with obj, at --serve. Each request can
+// build onto its own copy of obj with its body, a JSON or YAML document, its
+// query's KEY=VALUE parameters, and "Tmplcute-Set: KEY=VALUE" headers. srcs are what built obj, for
+// --reload to build it again.
+func serve(ctx context.Context, srcs []source, obj map[string]interface{}) error {
+	pages, err := servedPages(ctx)
+	if err != nil {
+		return err
+	}
+	var current atomic.Value
+	current.Store(&site{obj, pages})
+	if options.reload {
+		go watchFiles(func() []string { return watchedFiles(reglob(srcs)) }, time.Second/2, func() {
+			s, err := reloadSite(ctx, reglob(srcs), current.Load().(*site))
+			if err != nil {
+				warnf("not reloaded: %v", err)
+				return
+			}
+			current.Store(s)
+			logMsg(logInfo, "", "reloaded")
+		})
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := current.Load().(*site)
+		p, ok := s.pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		servePage(w, r, p, s.obj)
+	})
+	logMsg(logInfo, "", fmt.Sprintf("serving on http://%s/", options.serve), "addr", options.serve)
+	server := &http.Server{
+		Addr:    options.serve,
+		Handler: handler,
+		// Clients that are slow to send or to read, or that sit on idle
+		// connections, don't get to keep them forever.
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      2 * time.Minute,
+		IdleTimeout:       2 * time.Minute,
+	}
+	return server.ListenAndServe()
+}
+
+// reloadSite builds the object again from srcs, and rereads the templates
+// from their files. The template from stdin can't be read again, so it is
+// kept from old.
+func reloadSite(ctx context.Context, srcs []source, old *site) (*site, error) {
+	obj, err := buildObject(ctx, srcs)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkObject(ctx, obj); err != nil {
+		return nil, err
+	}
+	if templateOnStdin() {
+		return &site{obj, old.pages}, nil
+	}
+	pages, err := servedPages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &site{obj, pages}, nil
+}
+
+// watchedFiles are the local files that srcs and the templates read,
+// including every file now under the -r directories. The directories are
+// watched too, for files removed from them.
+func watchedFiles(srcs []source) []string {
+	var files []string
+	for _, src := range srcs {
+		if src.load == nil && !strings.HasPrefix(src.arg, "--") && !isURL(src.arg) && !isObjectURI(src.arg) {
+			file, _ := splitNamespace(src.arg)
+			files = append(files, file)
+		}
+	}
+	templates := append([]string(nil), options.files...)
+	jobs, _ := renderJobs()
+	for _, job := range jobs {
+		templates = append(templates, job.template)
+	}
+	for _, t := range options.trees {
+		templates = append(templates, t.src)
+	}
+	for _, path := range templates {
+		if !isURL(path) && !isObjectURI(path) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// coarseMTime is how coarse file modification times can be, on the file
+// systems that keep them worst.
+const coarseMTime = 2 * time.Second
+
+// watchFiles calls changed whenever any of the files that files returns is
+// changed, added or removed, checking every interval. files is called each
+// time, so that files added since, like a new match for a glob or a new
+// template under a -r directory, are watched too.
+//
+// It polls rather than using fsnotify. Notifications never arrive for files
+// on NFS and many container bind mounts, which is where development loops
+// often keep their configs, and editors that save by renaming a new file
+// into place end the watch on the old one. Polling a few dozen files twice a
+// second costs next to nothing by comparison. Modification times can be as
+// coarse as a second or two, so a file modified within that long also has
+// its contents hashed, to catch a second write that leaves the time and
+// size as they were.
+func watchFiles(files func() []string, interval time.Duration, changed func()) {
+	last := fileStates(files(), nil)
+	for range time.Tick(interval) {
+		now := fileStates(files(), last)
+		if !reflect.DeepEqual(now, last) {
+			changed()
+		}
+		last = now
+	}
+}
+
+// A fileState is what watchFiles knows of a file. sum is only set while it
+// is recently modified, and is otherwise carried over, so that a file ageing
+// past coarseMTime doesn't look changed.
+type fileState struct {
+	modTime, size int64
+	sum           [sha256.Size]byte
+}
+
+// fileStates stats files, hashing those modified within coarseMTime. Those
+// that don't exist are left out.
+func fileStates(files []string, last map[string]fileState) map[string]fileState {
+	states := map[string]fileState{}
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		state := fileState{modTime: info.ModTime().UnixNano(), size: info.Size()}
+		if old, ok := last[f]; ok && old.modTime == state.modTime && old.size == state.size {
+			state.sum = old.sum
+		}
+		if !info.IsDir() && time.Since(info.ModTime()) < coarseMTime {
+			if data, err := ioutil.ReadFile(f); err == nil {
+				state.sum = sha256.Sum256(data)
+			}
+		}
+		states[f] = state
+	}
+	return states
+}
+
+// servedPages reads the templates, by the path they are served at.
+func servedPages(ctx context.Context) (map[string]page, error) {
+	pages := map[string]page{}
+	if templateOnStdin() {
+		text, err := stdinTemplate()
+		if err != nil {
+			return nil, err
+		}
+		pages["/"] = page{"tmplcute", text, false}
+		return pages, nil
+	}
+	for _, file := range options.files {
+		text, err := readTemplate(ctx, file)
+		if err != nil {
+			return nil, err
+		}
+		pages["/"+strings.TrimPrefix(file, "/")] = page{file, text, isRaw(file, text)}
+	}
+	jobs, err := renderJobs()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		text, err := readTemplate(ctx, job.template)
+		if err != nil {
+			return nil, err
+		}
+		path := job.output
+		if job.dir != "" {
+			// A tree is served from the top.
+			rel, _ := filepath.Rel(job.dir, job.output)
+			path = filepath.ToSlash(rel)
+		} else if path == "" {
+			path = job.template
+		}
+		pages["/"+strings.TrimPrefix(path, "/")] = page{job.template, text, isRaw(job.template, text)}
+	}
+	return pages, nil
+}
+
+func servePage(w http.ResponseWriter, r *http.Request, p page, base map[string]interface{}) {
+	if p.raw {
+		kind := mime.TypeByExtension(path.Ext(r.URL.Path))
+		if kind == "" {
+			kind = http.DetectContentType([]byte(p.text))
+		}
+		w.Header().Set("Content-Type", kind)
+		io.WriteString(w, p.text)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, options.maxBody)
+	obj, err := requestObject(r, base)
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		http.Error(w, fmt.Sprintf("the body is over %d bytes", tooBig.Limit), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, redact(err.Error()), http.StatusBadRequest)
+		return
+	}
+	if err := checkObject(r.Context(), obj); err != nil {
+		http.Error(w, redact(err.Error()), http.StatusBadRequest)
+		return
+	}
+	// Only skip means anything for a page.
+	fm, text := splitFrontMatter(p.text)
+	spec, err := fm.resolve(p.name, obj)
+	if err != nil {
+		http.Error(w, redact(err.Error()), http.StatusInternalServerError)
+		return
+	}
+	if spec.skip {
+		http.NotFound(w, r)
+		return
+	}
+	var buf bytes.Buffer
+	html := htmlFor(r.URL.Path)
+	err = render(p.name, text, html, obj, &buf)
+	skip, err := skipOutput(buf.Bytes(), err)
+	if err != nil {
+		http.Error(w, redact(err.Error()), http.StatusInternalServerError)
+		return
+	}
+	if skip {
+		http.NotFound(w, r)
+		return
+	}
+	if html {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Write(buf.Bytes())
+}
+
+// requestObject builds onto a copy of base with what r says: its body, then
+// its query's KEY=VALUE parameters, and then its Tmplcute-Set headers, the
+// way FILEs and --KEY=VALUEs do.
+func requestObject(r *http.Request, base map[string]interface{}) (map[string]interface{}, error) {
+	obj := jsonable(base).(map[string]interface{})
+	// The body's Content-Length is the client's word, so it doesn't get to
+	// size anything.
+	body, err := readText(r.Body, 0)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(body) != "" {
+		format := contentFormat(r.Header.Get("Content-Type"))
+		if format == "" {
+			format = sniffFormat(body)
+		}
+		layer := map[string]interface{}{}
+		if err := decode(format, strings.NewReader(body), &layer); err != nil {
+			return nil, fmt.Errorf("body: %v", err)
+		}
+		options.combine(obj, layer)
+	}
+	grown := 0
+	if r.URL.RawQuery != "" {
+		// In order, unlike r.URL.Query, since a later KEY can set inside an
+		// earlier one.
+		for _, param := range strings.Split(r.URL.RawQuery, "&") {
+			kv := strings.SplitN(param, "=", 2)
+			if kv[0] == "" {
+				continue
+			}
+			if len(kv) == 1 {
+				kv = append(kv, "")
+			}
+			key, kerr := url.QueryUnescape(kv[0])
+			value, verr := url.QueryUnescape(kv[1])
+			if kerr != nil || verr != nil {
+				return nil, fmt.Errorf("the query has a bad parameter, %q", param)
+			}
+			if err := requestSet(obj, key, value, &grown); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, set := range r.Header["Tmplcute-Set"] {
+		kv := strings.SplitN(set, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Tmplcute-Set: %q is not KEY=VALUE", set)
+		}
+		if err := requestSet(obj, kv[0], kv[1], &grown); err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// maxRequestIndex is the highest index a request's KEY can reach, and
+// maxRequestGrowth how many elements all of a request's KEYs can reach
+// between them, so that a client can't have much allocated for it. --max-index
+// is for the command line, which can be trusted.
+const (
+	maxRequestIndex  = 1000
+	maxRequestGrowth = 10000
+)
+
+// requestSet sets key in obj for a request, as --KEY=VALUE does, or
+// --KEY:=VALUE if key ends in a colon. grown counts the elements the
+// request's KEYs have reached so far.
+func requestSet(obj map[string]interface{}, key, value string, grown *int) error {
+	k, err := keys.ParseKey(strings.TrimSuffix(key, ":"))
+	if err != nil {
+		return err
+	}
+	for _, index := range k.Indexes() {
+		if index > maxRequestIndex {
+			return fmt.Errorf("%s: index %d is past the limit of %d for requests", key, index, maxRequestIndex)
+		}
+		if *grown += index + 1; *grown > maxRequestGrowth {
+			return fmt.Errorf("%s: the request's KEYs reach more than %d elements", key, maxRequestGrowth)
+		}
+	}
+	// Each [] adds an element.
+	if *grown += k.Appends(); *grown > maxRequestGrowth {
+		return fmt.Errorf("%s: the request's KEYs reach more than %d elements", key, maxRequestGrowth)
+	}
+	if strings.HasSuffix(key, ":") {
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			return fmt.Errorf("%s %q is not JSON: %v", key, value, err)
+		}
+		return k.ApplyValue(&obj, v)
+	}
+	return k.Apply(&obj, value)
+}
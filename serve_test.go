@@ -0,0 +1,57 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestObjectLimits(t *testing.T) {
+	var many []string
+	for i := 0; i < 20; i++ {
+		many = append(many, fmt.Sprintf("a%d[999]=x", i))
+	}
+	appends := strings.Repeat("list[]=x&", maxRequestGrowth)
+	tests := []struct {
+		query, set string
+		ok         bool
+	}{
+		{"a[3]=x&b.c=y", "d[1]=z", true},
+		{"a[1000]=x", "", true},
+		{"a[1001]=x", "", false},
+		{"", "a[99999]=x", false},
+		{strings.Join(many[:9], "&"), "", true},
+		{strings.Join(many, "&"), "", false},
+		{"", "a:=[1,2,3]", true},
+		{appends, "", true},
+		{appends + "list[]=x", "", false},
+		{strings.Join(many[:9], "&"), "list[]=x", true},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/?"+test.query, nil)
+		if test.set != "" {
+			r.Header.Set("Tmplcute-Set", test.set)
+		}
+		_, err := requestObject(r, map[string]interface{}{})
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("?%s with Tmplcute-Set %q: got %v, want ok %v", test.query, test.set, err, test.ok)
+		}
+	}
+}
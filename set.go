@@ -0,0 +1,102 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var setUsage = `Usage: tmplcute set FILE{.json,.rjson,.yaml,.toml} [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+
+set decodes FILE, builds onto it with the rest of the arguments the same way
+tmplcute does, and writes the result back to FILE in the same format. A YAML
+FILE with !includes is left alone, since writing it back would lose them.
+`
+
+func set(args []string) {
+	if len(args) == 0 || args[0] == "-h" {
+		fmt.Fprintln(os.Stderr, setUsage)
+		os.Exit(2)
+	}
+	orExit(setFile(args[0], args[1:]))
+}
+
+// setFile builds onto the document in path with args, and writes it back.
+func setFile(path string, args []string) error {
+	format := fileFormat(path)
+	if format == "" {
+		return fmt.Errorf("don't know how to write %q", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if options.writeBack, err = filepath.Abs(path); err != nil {
+		return err
+	}
+	if format == "yaml" {
+		// Writing the document back would put what the !includes name in
+		// their place.
+		includes, err := includesYAML(path)
+		if err != nil {
+			return err
+		}
+		if includes {
+			return fmt.Errorf("%s has !includes, which set can't keep; set the files they name instead", path)
+		}
+	}
+
+	obj := map[string]interface{}{}
+	if err := loadArg(context.Background(), path, &obj); err != nil {
+		return err
+	}
+	for _, src := range sources(args) {
+		src.apply(&obj)
+	}
+
+	return writeDocument(path, format, obj, info.Mode().Perm())
+}
+
+// writeDocument encodes obj in the given format and writes it to path.
+func writeDocument(path, format string, obj interface{}, perm os.FileMode) error {
+	var out string
+	var err error
+	switch format {
+	case "json":
+		out, err = formatJson(jsonable(obj))
+	case "rjson":
+		out, err = formatRjson(jsonable(obj))
+	case "yaml":
+		out, err = formatYaml(obj)
+	case "toml":
+		out, err = formatToml(obj)
+	default:
+		return fmt.Errorf("don't know how to write %q", path)
+	}
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	return ioutil.WriteFile(path, []byte(out), perm)
+}
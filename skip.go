@@ -0,0 +1,56 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"errors"
+	"strings"
+)
+
+func init() {
+	tmplFuncs = append(tmplFuncs, tmplFunc{"skipFile", skipFile,
+		"stop executing, leaving the output unwritten: the --render file, the --stream record, or the --serve page, which is then not found"})
+	optionTable = append(optionTable, option{
+		names: []string{"--skip-empty"},
+		usage: "don't write --render outputs, or --stream records, that come out empty or only whitespace",
+		set: func(string) error {
+			options.skipEmpty = true
+			return nil
+		},
+	})
+}
+
+// errSkipFile is what skipFile stops the template with.
+var errSkipFile = errors.New("skipFile was called")
+
+func skipFile() (string, error) {
+	return "", errSkipFile
+}
+
+// skipOutput reports whether out, the output of executing a template that
+// ended with err, should be left unwritten: because the template called
+// skipFile, or because it is empty and --skip-empty was given. Any other
+// error is passed on.
+func skipOutput(out []byte, err error) (bool, error) {
+	if errors.Is(err, errSkipFile) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return options.skipEmpty && strings.TrimSpace(string(out)) == "", nil
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A source is an argument that builds up the object: a --KEY=VALUE, a FILE,
+// or an option like --consul that loads data from somewhere else.
+type source struct {
+	arg string
+	// load is set for options; everything else goes to loadArg.
+	load func(ctx context.Context, obj interface{}) error
+	// mounts is set for options that know where their data goes.
+	mounts func() []string
+	// glob is set for a FILE that a glob argument, like configs/*.yaml,
+	// matched, to that argument, so that reglob can match it again.
+	glob string
+}
+
+// settings are the options that tune a source, like --vault-key, by name.
+type settings map[string]string
+
+// get returns the setting name, or def if it wasn't given.
+func (s settings) get(name, def string) string {
+	if v, ok := s[name]; ok {
+		return v
+	}
+	return def
+}
+
+// apply builds onto obj with the source, exiting if it can't.
+func (s source) apply(obj interface{}) {
+	orExit(s.add(context.Background(), obj))
+}
+
+// add builds onto obj with the source.
+func (s source) add(ctx context.Context, obj interface{}) error {
+	if s.load != nil {
+		if err := s.load(ctx, obj); err != nil {
+			return &stageError{stage: "load", err: fmt.Errorf("%s: %v", s.arg, err)}
+		}
+		return nil
+	}
+	if s.skipped() {
+		return nil
+	}
+	err := loadArg(ctx, s.arg, obj)
+	if err == nil {
+		return nil
+	}
+	if strings.HasPrefix(s.arg, "--") {
+		return &stageError{stage: "load", key: argKey(s.arg), err: err}
+	}
+	return &stageError{stage: "load", file: s.arg, err: err}
+}
+
+// skipped reports whether the source is a FILE that --ignore-missing skips,
+// warning that it is.
+func (s source) skipped() bool {
+	if !options.ignoreMissing || s.load != nil || strings.HasPrefix(s.arg, "--") || isURL(s.arg) || isObjectURI(s.arg) {
+		return false
+	}
+	file, _ := splitNamespace(s.arg)
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		return false
+	}
+	warnf("skipping %s, which doesn't exist", s.arg)
+	return true
+}
+
+// sources parses the options in args, and returns the sources among them,
+// in order.
+func sources(args []string) []source {
+	srcs, err := parseOptions(args)
+	if err == errHelp {
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+	orExit(inStage("options", err))
+	return srcs
+}
+
+// argSources returns the sources for an argument that isn't an option. A
+// FILE can be a glob, like configs/*.yaml, for every file it matches in
+// sorted order, so that shells which don't expand globs, or sort them by
+// locale, make no difference.
+func argSources(arg string) []source {
+	if strings.HasPrefix(arg, "--") || isURL(arg) || isObjectURI(arg) || !strings.ContainsAny(arg, "*?[") {
+		return []source{{arg: arg}}
+	}
+	if _, err := os.Stat(arg); err == nil {
+		// It was a file after all, like one the shell already expanded.
+		return []source{{arg: arg}}
+	}
+	pattern, namespace := splitNamespace(arg)
+	matches, err := filepath.Glob(pattern)
+	if err != nil || len(matches) == 0 {
+		// Opening it will say what is wrong.
+		return []source{{arg: arg, glob: arg}}
+	}
+	sort.Strings(matches)
+	srcs := make([]source, len(matches))
+	for i, m := range matches {
+		if namespace != "" {
+			m += "@" + namespace
+		}
+		srcs[i] = source{arg: m, glob: arg}
+	}
+	return srcs
+}
+
+// reglob returns srcs with the FILEs that each glob argument matched
+// matched again, for --watch and --reload, so that files added since are
+// used, and those removed aren't.
+func reglob(srcs []source) []source {
+	var again []source
+	for i := 0; i < len(srcs); i++ {
+		glob := srcs[i].glob
+		if glob == "" {
+			again = append(again, srcs[i])
+			continue
+		}
+		for i+1 < len(srcs) && srcs[i+1].glob == glob {
+			i++
+		}
+		again = append(again, argSources(glob)...)
+	}
+	return again
+}
+
+// mount puts value into the object obj points to, at the path of field
+// names, making maps along the way and replacing anything that isn't one.
+// Unlike keys.Overwrite, the names can contain anything, even dots. value is
+// combined with what is already there as a FILE's document would be, as
+// --merge and --array-merge say.
+func mount(obj interface{}, path []string, value interface{}) error {
+	root, ok := obj.(*map[string]interface{})
+	if !ok {
+		return fmt.Errorf("cannot mount onto %T", obj)
+	}
+	noteSecretsAt(path, value)
+	if len(path) == 0 {
+		m, ok := jsonable(value).(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("cannot mount %T at the top", value)
+		}
+		options.combine(*root, m)
+		return nil
+	}
+	cur := *root
+	for _, name := range path[:len(path)-1] {
+		switch next := cur[name].(type) {
+		case map[string]interface{}:
+			cur = next
+		case map[interface{}]interface{}:
+			m := jsonable(next).(map[string]interface{})
+			cur[name] = m
+			cur = m
+		default:
+			m := map[string]interface{}{}
+			cur[name] = m
+			cur = m
+		}
+	}
+	options.combineField(cur, path[len(path)-1], value)
+	return nil
+}
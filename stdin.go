@@ -0,0 +1,114 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--stdin"},
+		value: "WHAT",
+		usage: `what stdin holds: "template", "data", a JSON or YAML document to build the object with before the other arguments, or "auto", the default, which is data if the templates come from -f, --render or -r, there are data FILEs too, and stdin is a JSON or YAML document rather than a terminal`,
+		set: func(what string) error {
+			switch what {
+			case "template", "data", "auto":
+				options.stdin = what
+				return nil
+			}
+			return fmt.Errorf("stdin can be template, data or auto, not %q", what)
+		},
+	})
+}
+
+// stdinSource returns the source for stdin, if it holds data rather than
+// the template, or nil if it doesn't. srcs are the other sources.
+func stdinSource(srcs []source) (*source, error) {
+	switch {
+	case options.stdin == "template", options.stream == "-", options.dataStdin:
+		return nil, nil
+	case options.stdin == "data" && templateOnStdin():
+		return nil, fmt.Errorf("--stdin=data needs the templates to come from -f, --render or -r")
+	case options.stdin == "auto" || options.stdin == "":
+		// Without data FILEs, stdin is left alone: it may be a shell loop's,
+		// or a pipe that is never closed, like ones cron and ssh leave open.
+		if templateOnStdin() || !hasDataFiles(srcs) {
+			return nil, nil
+		}
+		if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice != 0 {
+			return nil, nil
+		}
+	}
+
+	text, err := readText(os.Stdin, 0)
+	if err != nil {
+		return nil, err
+	}
+	options.stdinUsed = true
+	format := sniffFormat(text)
+	layer := map[string]interface{}{}
+	if strings.TrimSpace(text) != "" {
+		if err := decode(format, strings.NewReader(text), &layer); err != nil {
+			if options.stdin != "data" {
+				warnf("stdin is not JSON or YAML, so it isn't used: %v", err)
+				return nil, nil
+			}
+			return nil, fmt.Errorf("stdin: %v", err)
+		}
+	}
+	return &source{arg: "stdin", load: func(ctx context.Context, obj interface{}) error {
+		m, ok := obj.(*map[string]interface{})
+		if !ok {
+			return fmt.Errorf("cannot build %T with stdin", obj)
+		}
+		noteSecrets(&layer)
+		configFrom(ctx).combine(*m, jsonable(layer).(map[string]interface{}))
+		return nil
+	}}, nil
+}
+
+// hasDataFiles reports whether any of srcs is a FILE, given as it is or with
+// -d.
+func hasDataFiles(srcs []source) bool {
+	for _, src := range srcs {
+		if src.load == nil && !strings.HasPrefix(src.arg, "--") {
+			return true
+		}
+		if strings.HasPrefix(src.arg, "-d=") || strings.HasPrefix(src.arg, "--data=") {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffFormat guesses whether text is JSON or YAML.
+func sniffFormat(text string) string {
+	if t := strings.TrimSpace(text); strings.HasPrefix(t, "{") {
+		return "json"
+	}
+	return "yaml"
+}
+
+// templateOnStdin reports whether the template comes from stdin, because
+// there is no -f or --render to give one.
+func templateOnStdin() bool {
+	return len(options.files) == 0 && !hasRenders()
+}
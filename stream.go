@@ -0,0 +1,195 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--stream"},
+		value: "RECORDS",
+		usage: `execute the template once for each JSON record, one per line, in the file RECORDS, or stdin if it is "-", with the record's fields on top of the object`,
+		set: func(records string) error {
+			options.stream = records
+			return nil
+		},
+	})
+}
+
+// A streamTarget is a parsed template and where its output for each record
+// goes.
+type streamTarget struct {
+	name string
+	text string
+	tmpl executor
+	w    *bufio.Writer
+	// fm is the template's front matter, which can skip records.
+	fm frontMatter
+	// out is set when the output is a file, for the manifest.
+	out *countingWriter
+}
+
+// runStream executes the templates once per record in --stream, writing as
+// it goes, so that no more than one record is ever held at once. The
+// templates are the --renders, and the -f ones or else the one on stdin.
+func runStream(ctx context.Context, obj map[string]interface{}) error {
+	var records io.Reader
+	if options.stream == "-" {
+		if templateOnStdin() {
+			return fmt.Errorf("--stream=- reads the records from stdin, so the template has to come from -f, --render or -r")
+		}
+		records = os.Stdin
+		options.stdinUsed = true
+	} else {
+		f, err := os.Open(options.stream)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		records = f
+	}
+
+	var targets []streamTarget
+	if toStdout() {
+		pages, err := stdoutTemplates(ctx)
+		if err != nil {
+			return err
+		}
+		var stdout io.Writer = os.Stdout
+		var cw *countingWriter
+		if options.output != "" {
+			out, err := createOutput(options.output, options.outputMode)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+			cw = newCountingWriter(out, options.output)
+			stdout = cw
+		}
+		for i, p := range pages {
+			fm, text, err := streamFrontMatter(p.name, p.text)
+			if err != nil {
+				return err
+			}
+			tmpl, err := cachedTemplate(p.name, text, options.html, remoteTemplate(p.name))
+			if err != nil {
+				return err
+			}
+			t := streamTarget{p.name, text, tmpl, bufio.NewWriter(stdout), fm, nil}
+			if i == 0 {
+				// The -o file is only noted for the manifest once.
+				t.out = cw
+			}
+			targets = append(targets, t)
+		}
+	}
+	jobs, err := renderJobs()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		text, err := readTemplate(ctx, job.template)
+		if err != nil {
+			return err
+		}
+		fm, text, err := streamFrontMatter(job.template, text)
+		if err != nil {
+			return err
+		}
+		tmpl, err := cachedTemplate(job.template, text, htmlFor(job.output), remoteTemplate(job.template))
+		if err != nil {
+			return err
+		}
+		out, err := createOutput(job.output, job.mode)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		cw := newCountingWriter(out, job.output)
+		targets = append(targets, streamTarget{job.template, text, tmpl, bufio.NewWriter(cw), fm, cw})
+	}
+	defer func() {
+		for _, t := range targets {
+			if t.out != nil {
+				t.out.done()
+			}
+		}
+	}()
+
+	var buf bytes.Buffer
+	dec := json.NewDecoder(bufio.NewReader(records))
+	for n := 1; ; n++ {
+		var record map[string]interface{}
+		if err := dec.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: record %d: %w", options.stream, n, err)
+		}
+		data := make(map[string]interface{}, len(obj)+len(record))
+		for k, v := range obj {
+			data[k] = v
+		}
+		for k, v := range record {
+			data[k] = v
+		}
+		for _, t := range targets {
+			spec, err := t.fm.resolve(t.name, data)
+			if err != nil {
+				return fmt.Errorf("%s: record %d: %w", options.stream, n, err)
+			}
+			if spec.skip {
+				continue
+			}
+			// Each record's output is held until it is known not to be
+			// skipped.
+			buf.Reset()
+			err = t.tmpl.Execute(&buf, data)
+			skip, err := skipOutput(buf.Bytes(), err)
+			if err != nil {
+				return fmt.Errorf("%s: record %d: %w", options.stream, n, explainExec(err, t.name, t.text))
+			}
+			if skip {
+				continue
+			}
+			t.w.Write(buf.Bytes())
+			if err := t.w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// streamFrontMatter is splitFrontMatter for --stream, where every record
+// goes to the same place, so front matter can only skip them.
+func streamFrontMatter(name, text string) (frontMatter, string, error) {
+	fm, text := splitFrontMatter(text)
+	if _, ok := fm["output"]; ok {
+		return nil, "", fmt.Errorf("%s: front matter can't give an output with --stream", name)
+	}
+	if _, ok := fm["mode"]; ok {
+		return nil, "", fmt.Errorf("%s: front matter can't give a mode with --stream", name)
+	}
+	return fm, text, nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"sync"
+)
+
+// decodedFiles holds the documents decoded from FILEs so far, for --watch
+// and --reload, by path, with the hash of the contents they were decoded
+// from. Rebuilding the object after a change then only decodes the FILEs
+// that changed.
+var decodedFiles = struct {
+	sync.Mutex
+	m map[string]decodedFile
+}{m: map[string]decodedFile{}}
+
+type decodedFile struct {
+	sum [sha256.Size]byte
+	doc map[string]interface{}
+}
+
+// cachedDocument is loadDocument, by way of the cache when the object is
+// going to be built again. Only local JSON and YAML FILEs are cached: ones
+// that include other files or refer to them, like OpenAPI specs, would
+// need those hashed too.
+func cachedDocument(ctx context.Context, arg string, doc *map[string]interface{}) error {
+	format := fileFormat(arg)
+	if !options.watch && !options.reload || isURL(arg) || isObjectURI(arg) {
+		return loadDocument(ctx, arg, doc)
+	}
+	if format != "json" && format != "yaml" && format != "rjson" {
+		return loadDocument(ctx, arg, doc)
+	}
+	data, err := ioutil.ReadFile(arg)
+	if err != nil {
+		return err
+	}
+	if format == "yaml" && bytes.Contains(data, []byte("!include")) {
+		return loadDocument(ctx, arg, doc)
+	}
+	sum := sha256.Sum256(data)
+	decodedFiles.Lock()
+	f, ok := decodedFiles.m[arg]
+	decodedFiles.Unlock()
+	if ok && f.sum == sum {
+		// A copy, since combining changes maps and lists in place.
+		*doc = jsonable(f.doc).(map[string]interface{})
+		return nil
+	}
+	if err := decode(format, bytes.NewReader(data), doc); err != nil {
+		return err
+	}
+	if isOpenAPI(*doc) && !isWriteBack(arg) {
+		return resolveOpenAPI(arg, doc)
+	}
+	decodedFiles.Lock()
+	decodedFiles.m[arg] = decodedFile{sum, jsonable(*doc).(map[string]interface{})}
+	decodedFiles.Unlock()
+	return nil
+}
+
+// parsed holds the templates parsed so far, by the hash of their name and
+// text, so that rendering the same template again, as the long-running
+// modes do, costs only its execution. A template that changes hashes
+// differently, so nothing here is ever stale, and the old version is
+// dropped.
+var parsed = struct {
+	sync.Mutex
+	m      map[[sha256.Size]byte]*parsedTemplate
+	byName map[string][sha256.Size]byte
+}{
+	m:      map[[sha256.Size]byte]*parsedTemplate{},
+	byName: map[string][sha256.Size]byte{},
+}
+
+type parsedTemplate struct {
+	once sync.Once
+	tmpl executor
+	err  error
+}
+
+// cachedTemplate is parseTemplateWith, by way of the cache. An untrusted
+// template is parsed with untrustedFuncs.
+func cachedTemplate(name, text string, html, untrusted bool) (executor, error) {
+	return cachedParse(engine(html, untrusted), name, text, html, untrusted)
+}
+
+// cachedInclude is cachedTemplate for an included template. Those are kept
+// apart, since they are only ever cloned, never executed themselves, and
+// html/template can't clone a template that has been executed.
+func cachedInclude(name, text string, html, untrusted bool) (executor, error) {
+	return cachedParse(engine(html, untrusted)+" include", name, text, html, untrusted)
+}
+
+// engine names how a template is parsed, for the cache's keys.
+func engine(html, untrusted bool) string {
+	e := "text"
+	if html {
+		e = "html"
+	}
+	if untrusted {
+		e += " untrusted"
+	}
+	return e
+}
+
+func cachedParse(engine, name, text string, html, untrusted bool) (executor, error) {
+	key := sha256.Sum256([]byte(engine + "\x00" + name + "\x00" + text))
+	slot := engine + "\x00" + name
+
+	parsed.Lock()
+	p, ok := parsed.m[key]
+	if !ok {
+		p = &parsedTemplate{}
+		parsed.m[key] = p
+		if old, ok := parsed.byName[slot]; ok {
+			delete(parsed.m, old)
+		}
+		parsed.byName[slot] = key
+	}
+	parsed.Unlock()
+
+	// Jobs rendering the same template at once wait for one of them to
+	// parse it.
+	p.once.Do(func() {
+		var extra map[string]interface{}
+		if untrusted {
+			extra = untrustedFuncs()
+		}
+		p.tmpl, p.err = parseTemplateWith(name, text, html, extra)
+	})
+	return p.tmpl, p.err
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCachedDocument(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmplcute")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(watch bool) { options.watch = watch }(options.watch)
+	options.watch = true
+
+	path := filepath.Join(dir, "data.json")
+	load := func(text string) map[string]interface{} {
+		t.Helper()
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		doc := map[string]interface{}{}
+		if err := cachedDocument(context.Background(), path, &doc); err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+
+	first := load(`{"a": {"b": 1}}`)
+	want := map[string]interface{}{"a": map[string]interface{}{"b": 1.0}}
+	if !reflect.DeepEqual(first, want) {
+		t.Fatalf("decoded %v, want %v", first, want)
+	}
+	// Changing what was handed out leaves the cache alone.
+	first["a"].(map[string]interface{})["b"] = 2.0
+	if again := load(`{"a": {"b": 1}}`); !reflect.DeepEqual(again, want) {
+		t.Errorf("from the cache, got %v, want %v", again, want)
+	}
+	if changed := load(`{"a": {"c": 3}}`); !reflect.DeepEqual(changed, map[string]interface{}{"a": map[string]interface{}{"c": 3.0}}) {
+		t.Errorf("after a change, got %v", changed)
+	}
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var testUsage = `Usage: tmplcute test [-update] [-coverage=FILE] DIR
+
+test runs the cases in DIR, each a directory holding:
+
+  template.tmpl  the template
+  *.json, ...    data files, applied in name order
+  flags          more arguments, one per line; blank ones and #s are skipped
+  expected       what executing the template should print
+
+Each case runs in its own directory, as tmplcute would from the command line,
+and its output is compared with expected. DIR can also be a case itself. With
+-update, expected is rewritten with what was printed instead. The exit status
+is 1 if any case fails.
+
+With -coverage, each case is run with --coverage, and how many times the
+actions and branches of all the templates executed is added to FILE. A
+template is named by its path there, so the cases share the counts for a
+template they all render.
+`
+
+func test(args []string) {
+	update, coverFile := false, ""
+	for len(args) != 0 && strings.HasPrefix(args[0], "-") && args[0] != "-h" {
+		switch {
+		case args[0] == "-update":
+			update = true
+		case strings.HasPrefix(args[0], "-coverage="):
+			coverFile = strings.TrimPrefix(args[0], "-coverage=")
+		default:
+			fmt.Fprintln(os.Stderr, testUsage)
+			os.Exit(2)
+		}
+		args = args[1:]
+	}
+	if len(args) != 1 || args[0] == "-h" {
+		fmt.Fprintln(os.Stderr, testUsage)
+		os.Exit(2)
+	}
+	cases, err := testCases(args[0])
+	orExit(err)
+	if len(cases) == 0 {
+		orExit(fmt.Errorf("no cases in %s", args[0]))
+	}
+	self, err := os.Executable()
+	orExit(err)
+
+	failed := 0
+	report := coverReport{}
+	for _, dir := range cases {
+		var got []byte
+		if coverFile != "" {
+			got, err = runCaseCovered(self, dir, report)
+		} else {
+			got, err = runCase(self, dir)
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s\n%s\n", dir, indent(err.Error()))
+			continue
+		}
+		golden := filepath.Join(dir, "expected")
+		if update {
+			orExit(ioutil.WriteFile(golden, got, 0644))
+			fmt.Printf("ok   %s (updated)\n", dir)
+			continue
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s\n%s\n", dir, indent(err.Error()))
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			failed++
+			fmt.Printf("FAIL %s\n%s", dir, lineDiff(string(want), string(got)))
+			continue
+		}
+		fmt.Printf("ok   %s\n", dir)
+	}
+	if coverFile != "" {
+		orExit(report.addTo(coverFile))
+		fmt.Println(report.summary())
+	}
+	if failed != 0 {
+		fmt.Printf("%d of %d cases failed\n", failed, len(cases))
+		os.Exit(1)
+	}
+}
+
+// testCases finds the case directories in dir, or dir if it is one.
+func testCases(dir string) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(dir, "template.tmpl")); err == nil {
+		return []string{dir}, nil
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var cases []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		sub := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(filepath.Join(sub, "template.tmpl")); err == nil {
+			cases = append(cases, sub)
+		}
+	}
+	sort.Strings(cases)
+	return cases, nil
+}
+
+// runCase runs self, which is tmplcute, on the case in dir, and returns what
+// it printed. A case runs in a process of its own, so its flags can't change
+// how any other case runs.
+func runCase(self, dir string, extra ...string) ([]byte, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	for _, e := range entries {
+		if !e.IsDir() && fileFormat(e.Name()) != "" {
+			args = append(args, e.Name())
+		}
+	}
+	if flags, err := ioutil.ReadFile(filepath.Join(dir, "flags")); err == nil {
+		for _, line := range strings.Split(string(flags), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				args = append(args, line)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	args = append(args, extra...)
+
+	tmpl, err := os.Open(filepath.Join(dir, "template.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	defer tmpl.Close()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(self, args...)
+	cmd.Dir = dir
+	cmd.Stdin = tmpl
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("%s", msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// runCaseCovered is runCase with --coverage, adding the counts to report
+// under the templates' paths from here.
+func runCaseCovered(self, dir string, report coverReport) ([]byte, error) {
+	f, err := ioutil.TempFile("", "tmplcute-coverage")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	got, err := runCase(self, dir, "--coverage="+f.Name())
+	if err != nil {
+		return nil, err
+	}
+	counts, err := readCoverage(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	for key, c := range counts {
+		name, _, _, _ := splitCoverKey(key)
+		path := name
+		switch {
+		case name == "tmplcute":
+			path = filepath.Join(dir, "template.tmpl")
+		case !filepath.IsAbs(name) && !isURL(name) && !isObjectURI(name):
+			path = filepath.Join(dir, name)
+		}
+		report[path+key[len(name):]] += c
+	}
+	return got, nil
+}
+
+// lineDiff shows how got differs from want, a line at a time: "-" for lines
+// only in want, and "+" for lines only in got.
+func lineDiff(want, got string) string {
+	a, b := lines(want), lines(got)
+	// lcs[i][j] is how many lines a[i:] and b[j:] have in common.
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var out strings.Builder
+	line := func(prefix, s string) {
+		if !strings.HasSuffix(s, "\n") {
+			s += "\n    \\ no newline at the end\n"
+		}
+		out.WriteString("    " + prefix + s)
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			line(" ", a[i])
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			line("-", a[i])
+			i++
+		default:
+			line("+", b[j])
+			j++
+		}
+	}
+	return out.String()
+}
+
+// lines splits s into lines, keeping their newlines.
+func lines(s string) []string {
+	l := strings.SplitAfter(s, "\n")
+	if l[len(l)-1] == "" {
+		l = l[:len(l)-1]
+	}
+	return l
+}
+
+// indent indents every line of s.
+func indent(s string) string {
+	return "    " + strings.Replace(s, "\n", "\n    ", -1)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--tfstate"},
+		value: "PATH",
+		usage: "load the Terraform state in the file (or URL or object) PATH, whatever it is named",
+		load: func(ctx context.Context, path string, obj interface{}) error {
+			text, err := readTemplate(ctx, path)
+			if err != nil {
+				return err
+			}
+			if err := decode("tfstate", strings.NewReader(text), obj); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			return nil
+		},
+	})
+}
+
+// decodeTfstate decodes a Terraform state onto obj, reshaped so templates
+// can get at it by name. Each output's value goes at outputs.NAME, and each
+// resource's attributes at resources.TYPE.NAME, or data.TYPE.NAME for data
+// sources. Resources made with count are lists of attributes, and those made
+// with for_each are maps from each key. Resources in modules go under the
+// module's address, like module.vpc.resources.TYPE.NAME.
+func decodeTfstate(r io.Reader, obj interface{}) error {
+	var state struct {
+		Version int
+		Outputs map[string]struct {
+			Value interface{}
+		}
+		Resources []struct {
+			Module    string
+			Mode      string
+			Type      string
+			Name      string
+			Instances []struct {
+				IndexKey   interface{} `json:"index_key"`
+				Attributes map[string]interface{}
+			}
+		}
+	}
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return err
+	}
+	if state.Version < 4 {
+		return fmt.Errorf("terraform state version %d is too old, it needs to be 4 or later", state.Version)
+	}
+
+	outputs := map[string]interface{}{}
+	for name, output := range state.Outputs {
+		outputs[name] = output.Value
+	}
+	if err := mount(obj, []string{"outputs"}, outputs); err != nil {
+		return err
+	}
+
+	for _, res := range state.Resources {
+		var path []string
+		if res.Module != "" {
+			path = strings.Split(res.Module, ".")
+		}
+		if res.Mode == "data" {
+			path = append(path, "data", res.Type, res.Name)
+		} else {
+			path = append(path, "resources", res.Type, res.Name)
+		}
+
+		var value interface{}
+		for _, inst := range res.Instances {
+			switch key := inst.IndexKey.(type) {
+			case nil:
+				value = inst.Attributes
+			case float64:
+				list, _ := value.([]interface{})
+				for len(list) <= int(key) {
+					list = append(list, nil)
+				}
+				list[int(key)] = inst.Attributes
+				value = list
+			default:
+				m, _ := value.(map[string]interface{})
+				if m == nil {
+					m = map[string]interface{}{}
+				}
+				m[fmt.Sprint(key)] = inst.Attributes
+				value = m
+			}
+		}
+		if err := mount(obj, path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"strings"
+	"text/template/parse"
+	"unicode/utf8"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--trace"},
+		usage: "print each action to stderr as it executes, with where it is and what it came to",
+		set: func(string) error {
+			instruments = append(instruments, instrument{
+				funcs:   map[string]interface{}{"tmplcuteTrace": traceValue},
+				rewrite: traceTree,
+			})
+			return nil
+		},
+	})
+}
+
+// traceTree makes every pipeline in tree report its value to traceValue.
+func traceTree(tree *parse.Tree) {
+	eachPipe(tree.Root, func(owner parse.Node, pipe *parse.PipeNode) {
+		location, _ := tree.ErrorContext(pipe)
+		appendCall(pipe, "tmplcuteTrace", location+" "+actionText(owner))
+	})
+}
+
+// actionText is how owner, which owns a pipeline, appears in the template.
+// Ifs, ranges and withs are only their opening.
+func actionText(owner parse.Node) string {
+	switch n := owner.(type) {
+	case *parse.ActionNode:
+		return "{{" + pipeText(n.Pipe) + "}}"
+	case *parse.IfNode:
+		return "{{if " + pipeText(n.Pipe) + "}}"
+	case *parse.RangeNode:
+		return "{{range " + pipeText(n.Pipe) + "}}"
+	case *parse.WithNode:
+		return "{{with " + pipeText(n.Pipe) + "}}"
+	case *parse.TemplateNode:
+		if n.Pipe == nil {
+			return fmt.Sprintf("{{template %q}}", n.Name)
+		}
+		return fmt.Sprintf("{{template %q %s}}", n.Name, pipeText(n.Pipe))
+	}
+	return owner.String()
+}
+
+// traceValue prints what the action came to, and passes it on.
+func traceValue(action string, v interface{}) interface{} {
+	s := redact(fmt.Sprintf("%#v", v))
+	if str, ok := v.(string); ok {
+		s = fmt.Sprintf("%q", redact(str))
+	}
+	if len(s) > 60 {
+		// Cut on a rune boundary, so the trace stays valid UTF-8.
+		end := 57
+		for end > 0 && !utf8.RuneStart(s[end]) {
+			end--
+		}
+		s = s[:end] + "..."
+	}
+	s = strings.Replace(s, "\n", `\n`, -1)
+	logMsg(logDebug, "trace: ", fmt.Sprintf("%s = %s", action, s), "action", action, "value", s)
+	return v
+}
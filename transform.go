@@ -0,0 +1,61 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--transform"},
+		value: "TEMPLATE",
+		usage: `once the object is built, execute TEMPLATE with it, and make what it prints, a JSON or YAML object, the object instead; may be repeated, each one transforming what the last made, like --transform='{"db": {{json .database}}, "name": {{json .app.name}}}'`,
+		set: func(tmpl string) error {
+			options.transforms = append(options.transforms, tmpl)
+			return nil
+		},
+	})
+}
+
+// transform reshapes obj with each --transform in turn, returning the
+// object the last one makes.
+func transform(obj map[string]interface{}) (map[string]interface{}, error) {
+	for i, text := range options.transforms {
+		name := fmt.Sprintf("--transform %d", i+1)
+		var buf bytes.Buffer
+		if err := render(name, text, false, obj, &buf); err != nil {
+			return nil, err
+		}
+		out := buf.String()
+		if strings.TrimSpace(out) == "" {
+			return nil, fmt.Errorf("%s printed nothing, not an object", name)
+		}
+		var v interface{}
+		if err := decode(sniffFormat(out), strings.NewReader(out), &v); err != nil {
+			return nil, fmt.Errorf("%s didn't print JSON or YAML: %v", name, err)
+		}
+		m, ok := jsonable(v).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s printed %s, not an object", name, article(typeName(v)))
+		}
+		obj = m
+	}
+	return obj, nil
+}
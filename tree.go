@@ -0,0 +1,84 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"-r", "--tree"},
+		value: "SRC_DIR DST_DIR",
+		usage: "execute every file under SRC_DIR as a template, writing each to the same path under DST_DIR; may be repeated",
+		setAll: func(dirs []string) error {
+			info, err := os.Stat(dirs[0])
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dirs[0])
+			}
+			options.trees = append(options.trees, tree{dirs[0], dirs[1]})
+			return nil
+		},
+	})
+}
+
+// A tree is a directory of templates executed into another directory.
+type tree struct {
+	src, dst string
+}
+
+// jobs are the renderJobs for the files in the tree, in the order they are
+// found.
+func (t tree) jobs() ([]renderJob, error) {
+	var jobs []renderJob
+	err := filepath.Walk(t.src, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(t.src, path)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, renderJob{template: path, output: filepath.Join(t.dst, rel), dir: t.dst, mode: info.Mode().Perm()})
+		return nil
+	})
+	return jobs, err
+}
+
+// renderJobs are the --renders, and then the jobs for every -r tree.
+func renderJobs() ([]renderJob, error) {
+	jobs := append([]renderJob(nil), options.renders...)
+	for _, t := range options.trees {
+		more, err := t.jobs()
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, more...)
+	}
+	return jobs, nil
+}
+
+// hasRenders reports whether anything is to be written to files, by
+// --render or -r.
+func hasRenders() bool {
+	return len(options.renders) != 0 || len(options.trees) != 0
+}
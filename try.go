@@ -0,0 +1,118 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+func init() {
+	tmplFuncs = append(tmplFuncs, tmplFunc{"try", try,
+		`call the function NAME with ARGS, like {{try "unknown" "fetch" .url}}, giving DEFAULT with a warning instead of stopping if it fails`})
+}
+
+func try(deflt interface{}, name string, args ...interface{}) (interface{}, error) {
+	return tryIn(funcMap())(deflt, name, args...)
+}
+
+// tryIn returns try for a template with funcs, so that it can call the
+// functions it was given as well as tmplcute's.
+func tryIn(funcs map[string]interface{}) func(interface{}, string, ...interface{}) (interface{}, error) {
+	return func(deflt interface{}, name string, args ...interface{}) (interface{}, error) {
+		fn, ok := funcs[name]
+		if !ok {
+			return nil, fmt.Errorf("there is no function %q", name)
+		}
+		in, err := callArgs(name, reflect.TypeOf(fn), args)
+		if err != nil {
+			// The template is wrong, which a default won't fix.
+			return nil, err
+		}
+		v, err := call(reflect.ValueOf(fn), in)
+		if errors.Is(err, errSkipFile) {
+			return nil, err
+		}
+		if err != nil {
+			warnf("%s failed, so %v is used instead: %v", name, deflt, err)
+			return deflt, nil
+		}
+		return v, nil
+	}
+}
+
+// callArgs converts args to what t, the type of the template function called
+// name, takes, as templates do.
+func callArgs(name string, t reflect.Type, args []interface{}) ([]reflect.Value, error) {
+	n := t.NumIn()
+	if t.IsVariadic() {
+		n--
+		if len(args) < n {
+			return nil, fmt.Errorf("%s takes at least %d arguments, not %d", name, n, len(args))
+		}
+	} else if len(args) != n {
+		return nil, fmt.Errorf("%s takes %d arguments, not %d", name, n, len(args))
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var pt reflect.Type
+		if i < n {
+			pt = t.In(i)
+		} else {
+			pt = t.In(n).Elem()
+		}
+		v, err := argValue(arg, pt)
+		if err != nil {
+			return nil, fmt.Errorf("%s's argument %d: %v", name, i+1, err)
+		}
+		in[i] = v
+	}
+	return in, nil
+}
+
+// call calls fn, a template function, with in, returning what it returns.
+func call(fn reflect.Value, in []reflect.Value) (interface{}, error) {
+	out := fn.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out[0].Interface(), nil
+}
+
+// argValue makes arg into a t to pass to a function.
+func argValue(arg interface{}, t reflect.Type) (reflect.Value, error) {
+	if arg == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, fmt.Errorf("can't pass nil as %s", t)
+	}
+	v := reflect.ValueOf(arg)
+	switch {
+	case v.Type().AssignableTo(t):
+		return v, nil
+	case v.Type().ConvertibleTo(t) && v.Kind() != reflect.String && t.Kind() != reflect.String:
+		// Numbers for one another, but not a number for a string.
+		return v.Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("can't pass %s as %s", v.Type(), t)
+}
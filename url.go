@@ -0,0 +1,264 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultTimeout is how long fetches take at most without --timeout.
+const defaultTimeout = 30 * time.Second
+
+func init() {
+	options.timeout = defaultTimeout
+	options.headers = map[string]http.Header{}
+	options.urlHosts = map[string]bool{}
+}
+
+// isURL reports whether arg names a document to fetch over http.
+func isURL(arg string) bool {
+	return strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://")
+}
+
+// noteURLHost notes the host of arg, if it is a URL given as a FILE, -f,
+// -d or --render, as one that --headers without a HOST are sent to.
+func noteURLHost(arg string) {
+	if !isURL(arg) {
+		return
+	}
+	if u, err := url.Parse(arg); err == nil {
+		options.urlHosts[strings.ToLower(u.Hostname())] = true
+	}
+}
+
+// fetch gets u.
+func fetch(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return httpDo(nil, req)
+}
+
+// httpDo sends req with the --headers for its host, logging in with
+// credentials from the netrc file if there is no Authorization header. A
+// redirect to another host is sent without them. Anything but a 200 OK is an
+// error. If client is nil, a plain one that honors --timeout is used.
+// Responses are kept in --cache-dir, if there is one.
+func httpDo(client *http.Client, req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	// added are the names of the headers set here, which a redirect to
+	// another host doesn't get.
+	var added []string
+	for name, values := range options.headers[host] {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+		added = append(added, name)
+	}
+	if options.urlHosts[host] {
+		for name, values := range options.headers[""] {
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+			added = append(added, name)
+		}
+	}
+	if req.Header.Get("Authorization") == "" {
+		if login, password, ok := netrcLogin(req.URL.Hostname()); ok {
+			req.SetBasicAuth(login, password)
+			added = append(added, "Authorization")
+		}
+	}
+	if client == nil {
+		client = &http.Client{Timeout: configFrom(req.Context()).timeout}
+	} else {
+		c := *client
+		client = &c
+	}
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		if !strings.EqualFold(next.URL.Hostname(), host) {
+			for _, name := range added {
+				next.Header.Del(name)
+			}
+		}
+		if checkRedirect != nil {
+			return checkRedirect(next, via)
+		}
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		return nil
+	}
+	if options.cacheDir != "" {
+		return cachedHTTP(client, req)
+	}
+	return send(client, req)
+}
+
+// send sends req, making anything but a 200 OK an error. It is tried again
+// as --retries says, unless the server says the request itself is wrong.
+func send(client *http.Client, req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	tries := 0
+	err := retry(req.Context(), func() error {
+		if tries++; tries > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			req.Body = body
+		}
+		var err error
+		resp, err = client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return &statusError{url: req.URL.String(), code: resp.StatusCode, status: resp.Status}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// A statusError is a response that wasn't 200 OK.
+type statusError struct {
+	url    string
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.url, e.status)
+}
+
+// fetchText gets the contents of u, for templates.
+func fetchText(ctx context.Context, u string) (string, error) {
+	resp, err := fetch(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	return readText(resp.Body, resp.ContentLength)
+}
+
+// fetchDocument gets the document at u and decodes it onto obj.
+func fetchDocument(ctx context.Context, u string, obj interface{}) error {
+	resp, err := fetch(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	format := contentFormat(resp.Header.Get("Content-Type"))
+	if format == "" {
+		if parsed, err := url.Parse(u); err == nil {
+			format = fileFormat(parsed.Path)
+		}
+	}
+	if format == "" {
+		return fmt.Errorf("%s: don't know how to decode %q", u, resp.Header.Get("Content-Type"))
+	}
+	if err := decode(format, resp.Body, obj); err != nil {
+		return fmt.Errorf("%s: %v", u, err)
+	}
+	return nil
+}
+
+// contentFormat returns the format for a Content-Type, or "" if it is too
+// vague to tell.
+func contentFormat(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case mediaType == "application/json", mediaType == "text/json", strings.HasSuffix(mediaType, "+json"):
+		return "json"
+	case strings.HasSuffix(mediaType, "/yaml"), strings.HasSuffix(mediaType, "/x-yaml"), strings.HasSuffix(mediaType, "+yaml"):
+		return "yaml"
+	case mediaType == "application/toml", strings.HasSuffix(mediaType, "+toml"):
+		return "toml"
+	}
+	return ""
+}
+
+// netrcLogin finds the login for host in $NETRC, or ~/.netrc.
+func netrcLogin(host string) (login, password string, ok bool) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", false
+	}
+
+	// The file is a list of "machine NAME login USER password PASS" entries,
+	// in any whitespace, with "default" matching every host.
+	fields := strings.Fields(string(data))
+	matched := false
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if matched && login != "" {
+				return login, password, true
+			}
+			i++
+			matched = i < len(fields) && fields[i] == host
+		case "default":
+			if matched && login != "" {
+				return login, password, true
+			}
+			matched = true
+		case "login", "password", "account":
+			i++
+			if !matched || i == len(fields) {
+				continue
+			}
+			if fields[i-1] == "login" {
+				login = fields[i]
+			} else if fields[i-1] == "password" {
+				password = fields[i]
+			}
+		case "macdef":
+			// Macros run until a blank line, which Fields has thrown away, so
+			// there is no telling where they end. Nothing useful follows them
+			// in practice.
+			return login, password, matched && login != ""
+		}
+	}
+	return login, password, matched && login != ""
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		in                string
+		host, name, value string
+		ok                bool
+	}{
+		{"api.example.com:Authorization: Bearer x:y", "api.example.com", "Authorization", "Bearer x:y", true},
+		{"API.Example.com:X-Trace:1", "api.example.com", "X-Trace", "1", true},
+		{"localhost:X-Trace: 1", "localhost", "X-Trace", "1", true},
+		{"Authorization: Bearer x", "", "Authorization", "Bearer x", true},
+		{"X-Trace: a:b", "", "X-Trace", "a:b", true},
+		{"X-Trace:api.example.com", "", "X-Trace", "api.example.com", true},
+		{"https://api.example.com:X-Trace: 1", "", "", "", false},
+		{":X-Trace: 1", "", "", "", false},
+		{"api.example.com:X-Trace", "", "", "", false},
+		{"X-Trace", "", "", "", false},
+	}
+	for _, test := range tests {
+		host, name, value, err := parseHeader(test.in)
+		if ok := err == nil; ok != test.ok || host != test.host || name != test.name || value != test.value {
+			t.Errorf("parseHeader(%q) = %q, %q, %q, %v; want %q, %q, %q, ok %v",
+				test.in, host, name, value, err, test.host, test.name, test.value, test.ok)
+		}
+	}
+}
+
+func TestHeadersForHost(t *testing.T) {
+	defer func(headers map[string]http.Header, hosts map[string]bool) {
+		options.headers, options.urlHosts = headers, hosts
+	}(options.headers, options.urlHosts)
+	options.headers = map[string]http.Header{
+		"127.0.0.1":       {"X-Token": {"local"}},
+		"api.example.com": {"X-Token": {"elsewhere"}},
+		"":                {"X-Any": {"given"}},
+	}
+	options.urlHosts = map[string]bool{}
+
+	var got http.Header
+	var other string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/away" {
+			http.Redirect(w, r, other, http.StatusFound)
+			return
+		}
+		got = r.Header
+	}))
+	defer server.Close()
+	local := server.URL
+	other = strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	defer func(given []string) { givenOptions = given }(givenOptions)
+	defer func(files []string) { options.files = files }(options.files)
+	if _, err := parseOptions([]string{"--webhook=" + other, "-f", local, "--", "--hook=" + other}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		u            string
+		token, given string
+	}{
+		{local, "local", "given"},
+		{other, "", ""},
+		{local + "/away", "", ""},
+	}
+	for _, test := range tests {
+		got = nil
+		resp, err := fetch(context.Background(), test.u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got.Get("X-Token") != test.token || got.Get("X-Any") != test.given {
+			t.Errorf("%s got X-Token %q and X-Any %q, want %q and %q",
+				test.u, got.Get("X-Token"), got.Get("X-Any"), test.token, test.given)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var validateUsage = `Usage: tmplcute validate --schema=SCHEMA{.json,.rjson,.yaml,.toml} [ --KEY=VALUE | FILE{.json,.rjson,.yaml,.toml} ]*
+
+validate builds the object from its arguments the same way tmplcute does, and
+checks it against the JSON Schema in SCHEMA. Every violation is printed with
+the KEY where it happened, and the exit status is 1 if there are any. A
+SCHEMA that uses a keyword or format the check doesn't support, like "if" or
+"patternProperties", is refused rather than letting anything pass.
+`
+
+func validate(args []string) {
+	for _, arg := range args {
+		if arg == "-h" {
+			fmt.Fprintln(os.Stderr, validateUsage)
+			os.Exit(2)
+		}
+	}
+	schema, args := schemaArg(args)
+	if schema == "" {
+		fmt.Fprintln(os.Stderr, validateUsage)
+		os.Exit(2)
+	}
+
+	obj := map[string]interface{}{}
+	for _, src := range sources(args) {
+		src.apply(&obj)
+	}
+
+	err := checkSchema(schema, obj)
+	if err == nil {
+		err = checkObject(context.Background(), obj)
+	}
+	if violations, ok := err.(errorList); ok {
+		for _, violation := range violations {
+			fmt.Println(violation)
+		}
+		os.Exit(1)
+	}
+	orExit(err)
+}
+
+// schemaArg takes validate's --schema=SCHEMA, or --schema SCHEMA, out of
+// args.
+func schemaArg(args []string) (schema string, rest []string) {
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--":
+			return schema, append(rest, args[i:]...)
+		case strings.HasPrefix(arg, "--schema="):
+			schema = strings.TrimPrefix(arg, "--schema=")
+		case arg == "--schema" && i+1 < len(args):
+			i++
+			schema = args[i]
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return schema, rest
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	optionTable = append(optionTable,
+		option{
+			names:    []string{"--vault"},
+			value:    "PATH",
+			usage:    "load the Vault secret at PATH, like secret/data/myapp, from $VAULT_ADDR with $VAULT_TOKEN or $VAULT_ROLE_ID and $VAULT_SECRET_ID",
+			loadWith: loadVault,
+		},
+		option{
+			names: []string{"--vault-key"},
+			value: "KEY",
+			usage: "put the --vault secrets at KEY instead of the top of the object",
+			of:    "--vault",
+		},
+	)
+}
+
+// loadVault reads the secret at path from Vault. Both versions of the KV
+// secrets engine are understood.
+func loadVault(ctx context.Context, path string, with settings, obj interface{}) error {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		addr = "https://127.0.0.1:8200"
+	}
+	addr = strings.TrimSuffix(addr, "/")
+	client, err := vaultClient()
+	if err != nil {
+		return err
+	}
+	token, err := vaultToken(ctx, client, addr)
+	if err != nil {
+		return err
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := vaultCall(ctx, client, "GET", addr+"/v1/"+strings.TrimPrefix(path, "/"), token, nil, &secret); err != nil {
+		return err
+	}
+	data := secret.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			// Version 2 wraps the secret with its metadata.
+			data = inner
+		}
+	}
+
+	var at []string
+	if key := with.get("--vault-key", ""); key != "" {
+		at = strings.Split(key, ".")
+	}
+	return mount(obj, at, data)
+}
+
+// vaultToken logs in the way the vault tool would: $VAULT_TOKEN, then
+// AppRole with $VAULT_ROLE_ID and $VAULT_SECRET_ID, then ~/.vault-token.
+func vaultToken(ctx context.Context, client *http.Client, addr string) (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	if role := os.Getenv("VAULT_ROLE_ID"); role != "" {
+		var login struct {
+			Auth struct {
+				ClientToken string `json:"client_token"`
+			} `json:"auth"`
+		}
+		if err := vaultCall(ctx, client, "POST", addr+"/v1/auth/approle/login", "", map[string]string{
+			"role_id":   role,
+			"secret_id": os.Getenv("VAULT_SECRET_ID"),
+		}, &login); err != nil {
+			return "", fmt.Errorf("approle login: %v", err)
+		}
+		return login.Auth.ClientToken, nil
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if token, err := ioutil.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+			return strings.TrimSpace(string(token)), nil
+		}
+	}
+	return "", fmt.Errorf("no Vault token: set $VAULT_TOKEN, or $VAULT_ROLE_ID and $VAULT_SECRET_ID")
+}
+
+func vaultClient() (*http.Client, error) {
+	config := &tls.Config{InsecureSkipVerify: os.Getenv("VAULT_SKIP_VERIFY") == "true"}
+	if ca := os.Getenv("VAULT_CACERT"); ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", ca)
+		}
+	}
+	return &http.Client{
+		Timeout:   options.timeout,
+		Transport: &http.Transport{TLSClientConfig: config, Proxy: http.ProxyFromEnvironment},
+	}, nil
+}
+
+func vaultCall(ctx context.Context, client *http.Client, method, u, token string, body, into interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := httpDo(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(into)
+}
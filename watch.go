@@ -0,0 +1,106 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tmplcute
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func init() {
+	optionTable = append(optionTable, option{
+		names: []string{"--watch"},
+		usage: "after executing the templates, keep watching their files and the data FILEs, and execute them again, building the object afresh, whenever any change; the files of included templates are not watched",
+		set: func(string) error {
+			options.watch = true
+			return nil
+		},
+	})
+}
+
+// renderAll executes every template with obj: the --renders and -r trees,
+// and then the -f ones or the one on stdin, onto stdout or into -o.
+func renderAll(ctx context.Context, obj map[string]interface{}) error {
+	if hasRenders() {
+		n := options.jobs
+		if options.now != nil {
+			// Random funcs would be called in whatever order the jobs ran.
+			n = 1
+		}
+		jobs, err := renderJobs()
+		if err != nil {
+			return err
+		}
+		if err := runJobs(ctx, jobs, obj, n); err != nil {
+			return err
+		}
+	}
+	if toStdout() {
+		return renderStdout(ctx, obj)
+	}
+	return nil
+}
+
+// watch executes the templates again with a new object built from srcs
+// whenever --watch sees their files change, and never returns. A change
+// that fails to build or execute is reported, and waits for the next.
+func watch(ctx context.Context, srcs []source) {
+	watchFiles(func() []string { return watchedFiles(reglob(srcs)) }, time.Second/2, func() {
+		srcs := reglob(srcs)
+		obj, err := buildObject(ctx, srcs)
+		if err == nil {
+			err = checkObject(ctx, obj)
+		}
+		if err == nil {
+			resetWritten()
+			resetArchived()
+			err = renderAll(ctx, obj)
+		}
+		if err == nil {
+			err = writeArchive()
+		}
+		if err == nil {
+			err = writeManifest()
+		}
+		if err == nil {
+			err = prune(srcs)
+		}
+		if err != nil {
+			warnf("not executed again: %v", err)
+			return
+		}
+		logMsg(logInfo, "", fmt.Sprintf("executed again at %s", time.Now().Format("15:04:05")))
+	})
+}
+
+// buildObject builds a new object from srcs, for --watch and --reload.
+func buildObject(ctx context.Context, srcs []source) (map[string]interface{}, error) {
+	obj := map[string]interface{}{}
+	for _, src := range srcs {
+		if err := src.add(ctx, &obj); err != nil {
+			if src.load == nil {
+				return nil, fmt.Errorf("%s: %w", src.arg, err)
+			}
+			return nil, err
+		}
+	}
+	if err := derive(obj); err != nil {
+		return nil, err
+	}
+	return transform(obj)
+}